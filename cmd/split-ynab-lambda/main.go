@@ -20,7 +20,8 @@ type handler struct {
 	storageAdapter storage.StorageAdapter
 }
 
-func (h *handler) HandleLambdaEvent(ctx context.Context) error {
+// HandleLambdaEvent runs the job, returning the result of each budget's run as the Lambda's response payload.
+func (h *handler) HandleLambdaEvent(ctx context.Context) ([]*internal.RunResult, error) {
 	return internal.Run(ctx, h.logger, h.config, h.storageAdapter)
 }
 
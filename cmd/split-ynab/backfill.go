@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samshadwell/split-ynab/internal"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"go.uber.org/zap"
+)
+
+// uuidList is a flag which may be repeated to build a list of IDs.
+type uuidList []uuid.UUID
+
+func (l *uuidList) String() string {
+	ids := make([]string, len(*l))
+	for i, id := range *l {
+		ids[i] = id.String()
+	}
+	return strings.Join(ids, ",")
+}
+
+func (l *uuidList) Set(value string) error {
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, id)
+	return nil
+}
+
+// dateFlag is a flag holding a date in YYYY-MM-DD format.
+type dateFlag struct {
+	time.Time
+}
+
+func (d *dateFlag) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.Format(time.DateOnly)
+}
+
+func (d *dateFlag) Set(value string) error {
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return fmt.Errorf("expected a date like 2026-01-31: %w", err)
+	}
+	d.Time = t
+	return nil
+}
+
+func backfillCommand(ctx context.Context, logger *zap.Logger, args []string) error {
+	var since, until dateFlag
+	var accountIds uuidList
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	budgetName := flags.String("budget", "", "ID or name of the budget to process. Required if more than one is configured")
+	flags.Var(&since, "since", "process transactions dated on or after this date, e.g. 2026-01-01 (required)")
+	flags.Var(&until, "until", "process transactions dated on or before this date")
+	flags.Var(&accountIds, "account", "only process transactions in this account ID. May be repeated")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if since.IsZero() {
+		return errors.New("usage: split-ynab backfill -since YYYY-MM-DD [-until YYYY-MM-DD] [-budget ID|NAME] [-account ID]...")
+	}
+	if !until.IsZero() && until.Before(since.Time) {
+		return fmt.Errorf("-until %v is before -since %v", until.String(), since.String())
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	budget, err := selectBudget(config, *budgetName)
+	if err != nil {
+		return err
+	}
+
+	storageAdapter := storage.NewLocalStorageAdapter()
+
+	result, err := internal.Backfill(ctx, logger, config, budget, storageAdapter, internal.BackfillOptions{
+		Since:      since.Time,
+		Until:      until.Time,
+		AccountIds: accountIds,
+	})
+	if printErr := result.WriteText(os.Stdout); printErr != nil {
+		logger.Warn("failed to print run result", zap.Error(printErr))
+	}
+	return err
+}
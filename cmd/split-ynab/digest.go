@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/samshadwell/split-ynab/internal"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"go.uber.org/zap"
+)
+
+func digestCommand(ctx context.Context, logger *zap.Logger, args []string) error {
+	flags := flag.NewFlagSet("digest", flag.ExitOnError)
+	period := flags.String("period", "daily", "the window to summarize, daily or weekly, ending now")
+	send := flags.Bool("send", false, "send the digest to notifications with the digest event, unless this period's was already sent")
+	asJson := flags.Bool("json", false, "print the digest as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	duration, ok := internal.DigestPeriods[*period]
+	if !ok {
+		periods := slices.Sorted(maps.Keys(internal.DigestPeriods))
+		return fmt.Errorf("unknown period %q, must be one of %v", *period, strings.Join(periods, ", "))
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	storageAdapter := storage.NewLocalStorageAdapter()
+
+	until := time.Now()
+	digest, err := internal.BuildDigest(ctx, config, storageAdapter, until.Add(-duration), until)
+	if err != nil {
+		return err
+	}
+
+	if *send {
+		sent, err := internal.SendDigest(ctx, logger, config, storageAdapter, *period, digest)
+		if err != nil {
+			return err
+		}
+		if !sent {
+			fmt.Fprintf(os.Stderr, "The %v digest was already sent\n", *period)
+		}
+		return nil
+	}
+
+	if *asJson {
+		return printJson(digest)
+	}
+	return digest.WriteText(os.Stdout)
+}
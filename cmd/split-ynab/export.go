@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/samshadwell/split-ynab/internal"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"go.uber.org/zap"
+)
+
+// stringList is a flag which may be repeated to build a list of values.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func exportCommand(ctx context.Context, logger *zap.Logger, args []string) error {
+	var since, until dateFlag
+	var accounts stringList
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	budgetName := flags.String("budget", "", "ID or name of the budget to export. Required if more than one is configured")
+	format := flags.String("format", "csv", "output format, one of csv, jsonl, ledger, or beancount")
+	out := flags.String("out", "", "write the export to this file instead of standard output")
+	flags.Var(&since, "since", "only export transactions dated on or after this date, e.g. 2026-01-01")
+	flags.Var(&until, "until", "only export transactions dated on or before this date")
+	flags.Var(&accounts, "account", "only export transactions in this account ID or name. May be repeated")
+	includeBudget := flags.Bool("include-budget", false,
+		"also export split transactions in the budget which aren't in the ledger. Requires -since")
+	plainText := internal.DefaultPlainTextOptions()
+	flags.StringVar(&plainText.ReceivableAccount, "receivable-account", plainText.ReceivableAccount,
+		"for ledger and beancount, the account holding their share")
+	flags.StringVar(&plainText.Commodity, "commodity", plainText.Commodity, "for ledger and beancount, the currency")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	writers := map[string]func(w io.Writer, rows []internal.ExportRow) error{
+		"csv":   internal.WriteCSV,
+		"jsonl": internal.WriteJSONLines,
+		"ledger": func(w io.Writer, rows []internal.ExportRow) error {
+			return internal.WriteLedger(w, rows, plainText)
+		},
+		"beancount": func(w io.Writer, rows []internal.ExportRow) error {
+			return internal.WriteBeancount(w, rows, plainText)
+		},
+	}
+	write, ok := writers[*format]
+	if !ok || (*includeBudget && since.IsZero()) {
+		return errors.New("usage: split-ynab export [-format csv|jsonl|ledger|beancount] [-out FILE] " +
+			"[-since YYYY-MM-DD] [-until YYYY-MM-DD] [-account ID|NAME]... [-include-budget] [-budget ID|NAME]")
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	budget, err := selectBudget(config, *budgetName)
+	if err != nil {
+		return err
+	}
+
+	storageAdapter := storage.NewLocalStorageAdapter()
+
+	rows, err := internal.Export(ctx, logger, budget, storageAdapter, internal.ExportOptions{
+		Since:         since.Time,
+		Until:         until.Time,
+		Accounts:      accounts,
+		IncludeBudget: *includeBudget,
+	})
+	if err != nil {
+		return err
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		w, err = os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer func() {
+			_ = w.Close()
+		}()
+	}
+
+	return write(w, rows)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samshadwell/split-ynab/internal"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"go.uber.org/zap"
+)
+
+func historyCommand(ctx context.Context, logger *zap.Logger, args []string) error {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	limit := flags.Int("limit", 20, "maximum number of runs to list")
+	asJson := flags.Bool("json", false, "print runs as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	storageAdapter := storage.NewLocalStorageAdapter()
+	records, err := storageAdapter.ListRunRecords(ctx, *limit)
+	if err != nil {
+		return fmt.Errorf("failed to list runs: %w", err)
+	}
+
+	if *asJson {
+		return printJson(records)
+	}
+
+	if len(records) == 0 {
+		fmt.Println("No runs recorded yet")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RUN ID\tKIND\tSTARTED\tDURATION\tBUDGET\tFETCHED\tSPLIT\tFAILED\tERROR")
+	for _, r := range records {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%d\t%d\t%d\t%v\n",
+			r.RunId,
+			r.Kind,
+			r.StartedAt.Local().Format(time.DateTime),
+			(time.Duration(r.DurationMs) * time.Millisecond).String(),
+			r.BudgetId,
+			r.Fetched,
+			r.Split,
+			r.Failed,
+			r.Error)
+	}
+	return tw.Flush()
+}
+
+func showCommand(ctx context.Context, logger *zap.Logger, args []string) error {
+	flags := flag.NewFlagSet("show", flag.ExitOnError)
+	asJson := flags.Bool("json", false, "print the run as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: split-ynab show [-json] <run-id>")
+	}
+
+	runId, err := uuid.Parse(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid run ID %q: %w", flags.Arg(0), err)
+	}
+
+	storageAdapter := storage.NewLocalStorageAdapter()
+	record, err := storageAdapter.GetRunRecord(ctx, runId)
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("no run found with ID %v", runId)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get run: %w", err)
+	}
+
+	result := internal.RunResultFromRecord(*record)
+	if *asJson {
+		return printJson(result)
+	}
+	return result.WriteText(os.Stdout)
+}
+
+func printJson(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
 
@@ -12,6 +13,25 @@ import (
 
 const configFile = "config.yml"
 
+const usage = `Usage: split-ynab [command] [arguments]
+
+Commands:
+  run                 Split new transactions (the default if no command is given)
+  serve               Keep running, splitting new transactions on the schedule in the config
+  history             List recent runs
+  show <run-id>       Show the details of a single run
+  backfill            Split transactions in a date range, without affecting future runs
+  owed                Show how much the other person owes for a month
+  statement           Write a statement of a month's shared expenses, to share with the other person
+  export              Export split transactions as CSV or JSON Lines
+  splitwise           Export split transactions to, or import expenses from, Splitwise
+  partner-paid        Record expenses the other person paid for us
+  digest              Summarize recent runs, or send the summary to notifications
+`
+
+// command runs a single subcommand with the arguments which follow its name.
+type command func(ctx context.Context, logger *zap.Logger, args []string) error
+
 func main() {
 	ctx := context.Background()
 	logger, err := zap.NewDevelopment()
@@ -23,20 +43,86 @@ func main() {
 		_ = logger.Sync()
 	}()
 
+	commands := map[string]command{
+		"run":          runCommand,
+		"serve":        serveCommand,
+		"history":      historyCommand,
+		"show":         showCommand,
+		"backfill":     backfillCommand,
+		"owed":         owedCommand,
+		"statement":    statementCommand,
+		"export":       exportCommand,
+		"splitwise":    splitwiseCommand,
+		"partner-paid": partnerPaidCommand,
+		"digest":       digestCommand,
+	}
+
+	name := "run"
+	args := os.Args[1:]
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err := cmd(ctx, logger, args); err != nil {
+		logger.Fatal("program did not run successfully", zap.Error(err))
+	}
+}
+
+func runCommand(ctx context.Context, logger *zap.Logger, args []string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	storageAdapter := storage.NewLocalStorageAdapter()
+
+	results, err := internal.Run(ctx, logger, config, storageAdapter)
+	for i, result := range results {
+		if i > 0 {
+			fmt.Println()
+		}
+		if printErr := result.WriteText(os.Stdout); printErr != nil {
+			logger.Warn("failed to print run result", zap.Error(printErr))
+		}
+	}
+	return err
+}
+
+func loadConfig() (*internal.Config, error) {
 	f, err := os.Open(configFile)
 	if err != nil {
-		logger.Fatal("failed to open config file", zap.Error(err))
+		return nil, fmt.Errorf("failed to open config file: %w", err)
 	}
+	defer func() {
+		_ = f.Close()
+	}()
 
 	config, err := internal.LoadConfig(f)
 	if err != nil {
-		logger.Fatal("failed to load config", zap.Error(err))
+		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
+	return config, nil
+}
 
-	storageAdapter := storage.NewLocalStorageAdapter()
+// selectBudget returns the configured budget with the given ID or name. If idOrName is empty, the config must have
+// exactly one budget, which is returned.
+func selectBudget(config *internal.Config, idOrName string) (*internal.BudgetConfig, error) {
+	if idOrName == "" {
+		if len(config.Budgets) != 1 {
+			return nil, fmt.Errorf("config has %d budgets, use -budget to choose one", len(config.Budgets))
+		}
+		return &config.Budgets[0], nil
+	}
 
-	err = internal.Run(ctx, logger, config, storageAdapter)
-	if err != nil {
-		logger.Fatal("program did not run successfully", zap.Error(err))
+	budget := config.Budget(idOrName)
+	if budget == nil {
+		return nil, fmt.Errorf("no budget with ID or name %q in config", idOrName)
 	}
+	return budget, nil
 }
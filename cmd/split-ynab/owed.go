@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/samshadwell/split-ynab/internal"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"go.uber.org/zap"
+)
+
+// monthFlag is a flag holding a month in YYYY-MM format.
+type monthFlag struct {
+	time.Time
+}
+
+func (m *monthFlag) String() string {
+	if m.IsZero() {
+		return ""
+	}
+	return m.Format("2006-01")
+}
+
+func (m *monthFlag) Set(value string) error {
+	t, err := time.Parse("2006-01", value)
+	if err != nil {
+		return fmt.Errorf("expected a month like 2026-01: %w", err)
+	}
+	m.Time = t
+	return nil
+}
+
+func owedCommand(ctx context.Context, logger *zap.Logger, args []string) error {
+	var month monthFlag
+	flags := flag.NewFlagSet("owed", flag.ExitOnError)
+	budgetName := flags.String("budget", "", "ID or name of the budget to report on. Required if more than one is configured")
+	flags.Var(&month, "month", "report on this month, e.g. 2026-09 (default the current month)")
+	asJson := flags.Bool("json", false, "print the report as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if month.IsZero() {
+		month.Time = time.Now()
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	budget, err := selectBudget(config, *budgetName)
+	if err != nil {
+		return err
+	}
+
+	storageAdapter := storage.NewLocalStorageAdapter()
+
+	report, err := internal.Owed(ctx, logger, budget, storageAdapter, month.Time)
+	if err != nil {
+		return err
+	}
+	if *asJson {
+		return printJson(report)
+	}
+	return report.WriteText(os.Stdout)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/oapi-codegen/runtime/types"
+	"github.com/samshadwell/split-ynab/internal"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"go.uber.org/zap"
+)
+
+const partnerPaidUsage = `usage: split-ynab partner-paid -date YYYY-MM-DD -payee PAYEE -amount AMOUNT -category ID [-our-share AMOUNT | -percent PCT] [-memo MEMO] [-id ID] [-dry-run] [-budget ID|NAME]
+       split-ynab partner-paid -file expenses.csv|expenses.yml [-dry-run] [-budget ID|NAME]`
+
+func partnerPaidCommand(ctx context.Context, logger *zap.Logger, args []string) error {
+	var date dateFlag
+	var amount, ourShare internal.Milliunits
+	flags := flag.NewFlagSet("partner-paid", flag.ExitOnError)
+	budgetName := flags.String("budget", "", "ID or name of the budget to record in. Required if more than one is configured")
+	file := flags.String("file", "", "read a batch of expenses from this CSV or YAML file")
+	flags.Var(&date, "date", "the date of the expense, e.g. 2026-09-01")
+	payee := flags.String("payee", "", "who was paid")
+	flags.Var(&amount, "amount", "the total the other person paid, e.g. 60.00")
+	category := flags.String("category", "", "ID of the category our share comes from")
+	flags.Var(&ourShare, "our-share", "our share of the amount (default half)")
+	percent := flags.Int("percent", 0, "our share of the amount, as a percentage")
+	memo := flags.String("memo", "", "memo for the transaction")
+	id := flags.String("id", "", "identifies the expense, to record one identical to an expense recorded before")
+	dryRun := flags.Bool("dry-run", false, "log the transactions which would be created, without creating them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var expenses []internal.PartnerExpense
+	if *file != "" {
+		var err error
+		expenses, err = loadExpensesFile(*file)
+		if err != nil {
+			return err
+		}
+	} else {
+		if date.IsZero() || *payee == "" || amount == 0 || *category == "" {
+			return errors.New(partnerPaidUsage)
+		}
+		categoryId, err := uuid.Parse(*category)
+		if err != nil {
+			return fmt.Errorf("invalid category ID %q: %w", *category, err)
+		}
+		expense := internal.PartnerExpense{
+			Date:       types.Date{Time: date.Time},
+			Payee:      *payee,
+			Amount:     amount,
+			CategoryId: categoryId,
+			Memo:       *memo,
+			Id:         *id,
+		}
+		if ourShare != 0 {
+			expense.OurShare = &ourShare
+		}
+		if *percent != 0 {
+			expense.PercentOurShare = percent
+		}
+		expenses = []internal.PartnerExpense{expense}
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	budget, err := selectBudget(config, *budgetName)
+	if err != nil {
+		return err
+	}
+
+	storageAdapter := storage.NewLocalStorageAdapter()
+
+	result, err := internal.RecordPartnerPaid(ctx, logger, budget, storageAdapter, expenses, *dryRun)
+	if result != nil {
+		verb := "Created"
+		if *dryRun {
+			verb = "Would create"
+		}
+		fmt.Printf("%v %d transactions (%d already recorded, %d failed)\n",
+			verb, result.Created, result.Duplicates, result.Failed)
+	}
+	return err
+}
+
+func loadExpensesFile(path string) ([]internal.PartnerExpense, error) {
+	format := "yaml"
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		format = "csv"
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open expenses file: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	return internal.LoadPartnerExpenses(f, format)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/samshadwell/split-ynab/internal"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"go.uber.org/zap"
+)
+
+func serveCommand(ctx context.Context, logger *zap.Logger, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// Stop waiting for the next run on SIGINT or SIGTERM. A run in progress is finished first
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return internal.Serve(ctx, logger, configFile, storage.NewLocalStorageAdapter())
+}
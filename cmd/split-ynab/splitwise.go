@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/samshadwell/split-ynab/internal"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"go.uber.org/zap"
+)
+
+const splitwiseUsage = `usage: split-ynab splitwise export -since YYYY-MM-DD [-until YYYY-MM-DD] [-currency USD] [-out FILE] [-budget ID|NAME]
+       split-ynab splitwise import [-dry-run] [-budget ID|NAME] <splitwise-export.csv>`
+
+func splitwiseCommand(ctx context.Context, logger *zap.Logger, args []string) error {
+	if len(args) == 0 {
+		return errors.New(splitwiseUsage)
+	}
+
+	switch args[0] {
+	case "export":
+		return splitwiseExportCommand(ctx, logger, args[1:])
+	case "import":
+		return splitwiseImportCommand(ctx, logger, args[1:])
+	default:
+		return errors.New(splitwiseUsage)
+	}
+}
+
+func splitwiseExportCommand(ctx context.Context, logger *zap.Logger, args []string) error {
+	var since, until dateFlag
+	flags := flag.NewFlagSet("splitwise export", flag.ExitOnError)
+	budgetName := flags.String("budget", "", "ID or name of the budget to export. Required if more than one is configured")
+	flags.Var(&since, "since", "export transactions dated on or after this date, e.g. 2026-01-01 (required)")
+	flags.Var(&until, "until", "export transactions dated on or before this date")
+	currency := flags.String("currency", "USD", "the budget's currency")
+	out := flags.String("out", "", "write the export to this file instead of standard output")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if since.IsZero() {
+		return errors.New(splitwiseUsage)
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	budget, err := selectBudget(config, *budgetName)
+	if err != nil {
+		return err
+	}
+
+	storageAdapter := storage.NewLocalStorageAdapter()
+
+	rows, err := internal.Export(ctx, logger, budget, storageAdapter, internal.ExportOptions{
+		Since: since.Time,
+		Until: until.Time,
+	})
+	if err != nil {
+		return err
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		w, err = os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer func() {
+			_ = w.Close()
+		}()
+	}
+	return internal.WriteSplitwiseCSV(w, rows, budget.Splitwise, *currency)
+}
+
+func splitwiseImportCommand(ctx context.Context, logger *zap.Logger, args []string) error {
+	flags := flag.NewFlagSet("splitwise import", flag.ExitOnError)
+	budgetName := flags.String("budget", "", "ID or name of the budget to import into. Required if more than one is configured")
+	dryRun := flags.Bool("dry-run", false, "log the transactions which would be created, without creating them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New(splitwiseUsage)
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	budget, err := selectBudget(config, *budgetName)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to open Splitwise export: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	result, err := internal.ImportSplitwise(ctx, logger, budget, f, *dryRun)
+	if result != nil {
+		verb := "Created"
+		if *dryRun {
+			verb = "Would create"
+		}
+		fmt.Printf("%v %d transactions (%d already imported, %d failed)\n",
+			verb, result.Created, result.Duplicates, result.Failed)
+	}
+	return err
+}
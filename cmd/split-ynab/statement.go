@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/samshadwell/split-ynab/internal"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"go.uber.org/zap"
+)
+
+func statementCommand(ctx context.Context, logger *zap.Logger, args []string) error {
+	var month monthFlag
+	flags := flag.NewFlagSet("statement", flag.ExitOnError)
+	budgetName := flags.String("budget", "", "ID or name of the budget to report on. Required if more than one is configured")
+	flags.Var(&month, "month", "list transactions split in this month, e.g. 2026-09 (default the current month)")
+	format := flags.String("format", "markdown", "output format, either markdown or html")
+	out := flags.String("out", "", "write the statement to this file instead of standard output")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *format != "markdown" && *format != "html" {
+		return errors.New("usage: split-ynab statement [-month YYYY-MM] [-format markdown|html] [-out FILE] [-budget ID|NAME]")
+	}
+	if month.IsZero() {
+		month.Time = time.Now()
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	budget, err := selectBudget(config, *budgetName)
+	if err != nil {
+		return err
+	}
+
+	storageAdapter := storage.NewLocalStorageAdapter()
+
+	statement, err := internal.BuildStatement(ctx, budget, storageAdapter, month.Time)
+	if err != nil {
+		return err
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		w, err = os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer func() {
+			_ = w.Close()
+		}()
+	}
+
+	if *format == "html" {
+		return statement.WriteHTML(w)
+	}
+	return statement.WriteMarkdown(w)
+}
@@ -29,13 +29,28 @@ func NewAwsStack(scope constructs.Construct, id string, props *AwsStackProps) aw
 			Path: jsii.String("config.yml"),
 		})
 
-	// DynamoDB table as key/value store
+	// DynamoDB table as key/value store. Items which belong to a collection, like run records, are also indexed by
+	// collection so they can be listed in order. See internal/storage/dynamodb_storage_adapter.go
 	table := awsdynamodb.NewTableV2(stack, jsii.String("SplitYnab"),
 		&awsdynamodb.TablePropsV2{
 			PartitionKey: &awsdynamodb.Attribute{
 				Name: jsii.String("key"),
 				Type: awsdynamodb.AttributeType_STRING,
 			},
+			TimeToLiveAttribute: jsii.String("expiresAt"),
+			GlobalSecondaryIndexes: &[]*awsdynamodb.GlobalSecondaryIndexPropsV2{
+				{
+					IndexName: jsii.String("byCollection"),
+					PartitionKey: &awsdynamodb.Attribute{
+						Name: jsii.String("collection"),
+						Type: awsdynamodb.AttributeType_STRING,
+					},
+					SortKey: &awsdynamodb.Attribute{
+						Name: jsii.String("sortKey"),
+						Type: awsdynamodb.AttributeType_STRING,
+					},
+				},
+			},
 		})
 
 	// Lambda for compute
@@ -0,0 +1,173 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samshadwell/split-ynab/internal/notify"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"go.uber.org/zap"
+)
+
+// The kinds of alert a budget may raise.
+const (
+	AlertSplitCategoryBalance = "splitCategoryBalance"
+	AlertMonthlySplit         = "monthlySplit"
+)
+
+// How long a raised alert is remembered. Alerts are keyed by month, so this only needs to outlast one.
+const alertMarkerTtl = 32 * 24 * time.Hour
+
+// Alert warns that a budget crossed one of its configured thresholds. Amounts are in YNAB milliunits.
+type Alert struct {
+	Kind   string `json:"kind"`
+	Budget string `json:"budget"`
+	// The month the alert applies to, e.g. "2026-10"
+	Month     string `json:"month"`
+	Value     int64  `json:"value"`
+	Threshold int64  `json:"threshold"`
+}
+
+// alertCheck is the outcome of comparing a budget's current value against one of its thresholds.
+type alertCheck struct {
+	alert     Alert
+	triggered bool
+}
+
+func (a Alert) title() string {
+	switch a.Kind {
+	case AlertSplitCategoryBalance:
+		return fmt.Sprintf("split-ynab: split category balance in %v is %v, below %v",
+			a.Budget, formatMilliunits(a.Value), formatMilliunits(a.Threshold))
+	case AlertMonthlySplit:
+		return fmt.Sprintf("split-ynab: shared spending in %v for %v is %v, above %v",
+			a.Budget, a.Month, formatMilliunits(a.Value), formatMilliunits(a.Threshold))
+	default:
+		panic("programmer error, unknown alert kind: " + a.Kind)
+	}
+}
+
+// checkAlerts compares the budget against its alert thresholds, and raises any newly crossed. Failures are logged
+// rather than returned, so they don't affect the outcome of the run.
+func (r *budgetRun) checkAlerts(ctx context.Context, logger *zap.Logger, now time.Time) {
+	alerts := r.budget.Alerts
+	if alerts == nil {
+		return
+	}
+
+	month := now.Format(monthFormat)
+	newAlert := func(kind string, value int64, threshold Milliunits) Alert {
+		return Alert{
+			Kind:      kind,
+			Budget:    r.budget.displayName(),
+			Month:     month,
+			Value:     value,
+			Threshold: int64(threshold),
+		}
+	}
+
+	checks := make([]alertCheck, 0, 2)
+	if threshold := alerts.SplitCategoryBalanceBelow; threshold != nil {
+		category, err := r.client.GetMonthCategory(ctx, r.budget.BudgetId, now, r.budget.SplitCategoryId)
+		if err != nil {
+			logger.Warn("failed to fetch split category, unable to check its balance", zap.Error(err))
+		} else {
+			checks = append(checks, alertCheck{
+				alert:     newAlert(AlertSplitCategoryBalance, category.Balance, *threshold),
+				triggered: category.Balance < int64(*threshold),
+			})
+		}
+	}
+	if threshold := alerts.MonthlySplitAbove; threshold != nil {
+		splits, err := r.storageAdapter.ListSplitRecords(ctx, r.budget.BudgetId)
+		if err != nil {
+			logger.Warn("failed to read ledger, unable to check this month's shared spending", zap.Error(err))
+		} else {
+			total := monthlySplitTotal(splits, month)
+			checks = append(checks, alertCheck{
+				alert:     newAlert(AlertMonthlySplit, total, *threshold),
+				triggered: total > int64(*threshold),
+			})
+		}
+	}
+
+	raiseAlerts(ctx, logger, r.cfg.notificationTargets(), r.storageAdapter, r.budget.BudgetId, checks)
+}
+
+// monthlySplitTotal returns the total of the transactions split in the given month, which is positive for spending.
+func monthlySplitTotal(splits []storage.SplitRecord, month string) int64 {
+	var total int64
+	for _, s := range splits {
+		if inMonth(s.Date, month) {
+			total += -s.Amount
+		}
+	}
+	return total
+}
+
+// raiseAlerts logs and sends each triggered alert, unless it was already raised this month. An alert which couldn't be
+// sent to any of the targets for alerts, or which is no longer triggered, is forgotten, so it's raised again by the next
+// run which finds the threshold crossed.
+func raiseAlerts(
+	ctx context.Context,
+	logger *zap.Logger,
+	targets []notificationTarget,
+	storageAdapter storage.StorageAdapter,
+	budgetId uuid.UUID,
+	checks []alertCheck,
+) {
+	for _, c := range checks {
+		logger := logger.With(
+			zap.String("alert", c.alert.Kind),
+			zap.Int64("value", c.alert.Value),
+			zap.Int64("threshold", c.alert.Threshold))
+		marker := fmt.Sprintf("ALERT#%v#%v#%v", budgetId, c.alert.Kind, c.alert.Month)
+
+		if !c.triggered {
+			if err := storageAdapter.DeleteMarker(ctx, marker); err != nil {
+				logger.Warn("failed to clear alert", zap.Error(err))
+			}
+			continue
+		}
+
+		claimed, err := storageAdapter.ClaimMarker(ctx, marker, alertMarkerTtl)
+		if err != nil {
+			logger.Warn("failed to check whether alert was already raised", zap.Error(err))
+			continue
+		}
+		if !claimed {
+			logger.Debug("alert was already raised")
+			continue
+		}
+
+		logger.Warn(c.alert.title())
+		msg := notify.Message{
+			Event: notify.EventAlert,
+			Title: c.alert.title(),
+			Text:  c.alert.title(),
+			Data:  c.alert,
+		}
+		attempted, sent := 0, 0
+		for _, target := range targets {
+			if !slices.Contains(target.events, notify.EventAlert) {
+				continue
+			}
+			attempted++
+			if err := target.notifier.Notify(ctx, msg); err != nil {
+				logger.Warn("failed to send alert", zap.Error(err))
+				continue
+			}
+			sent++
+		}
+
+		if attempted > 0 && sent == 0 {
+			// Let the next run send it
+			if err := storageAdapter.DeleteMarker(ctx, marker); err != nil {
+				logger.Warn("failed to delete alert marker", zap.String("marker", marker), zap.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/samshadwell/split-ynab/internal/notify"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"go.uber.org/zap"
+)
+
+func TestMonthlySplitTotal(t *testing.T) {
+	splits := []storage.SplitRecord{
+		{Date: "2026-09-30", Amount: -100_000},
+		{Date: "2026-10-01", Amount: -40_000},
+		{Date: "2026-10-18", Amount: -25_500},
+		{Date: "2026-11-01", Amount: -100_000},
+	}
+	if got := monthlySplitTotal(splits, "2026-10"); got != 65_500 {
+		t.Errorf("want total of 65500, got %d", got)
+	}
+}
+
+func TestRaiseAlerts(t *testing.T) {
+	t.Chdir(t.TempDir())
+	ctx := context.Background()
+	storageAdapter := storage.NewLocalStorageAdapter()
+	budgetId := uuid.New()
+
+	alerts := &fakeNotifier{}
+	errorsOnly := &fakeNotifier{}
+	targets := []notificationTarget{
+		{notifier: alerts, events: []notify.Event{notify.EventAlert}},
+		{notifier: errorsOnly, events: []notify.Event{notify.EventError}},
+	}
+	lowBalance := Alert{Kind: AlertSplitCategoryBalance, Budget: "Household", Month: "2026-10", Value: 5_000, Threshold: 20_000}
+	overSpent := Alert{Kind: AlertMonthlySplit, Budget: "Household", Month: "2026-10", Value: 600_000, Threshold: 500_000}
+	raise := func(balanceLow bool, spendingHigh bool) {
+		raiseAlerts(ctx, zap.NewNop(), targets, storageAdapter, budgetId, []alertCheck{
+			{alert: lowBalance, triggered: balanceLow},
+			{alert: overSpent, triggered: spendingHigh},
+		})
+	}
+
+	raise(true, false)
+	if len(alerts.messages) != 1 || alerts.messages[0].Data != lowBalance {
+		t.Fatalf("want one low balance alert, got %+v", alerts.messages)
+	}
+
+	// Still low an hour later, and now overspent too
+	raise(true, true)
+	if len(alerts.messages) != 2 || alerts.messages[1].Data != overSpent {
+		t.Fatalf("want only the new spending alert, got %+v", alerts.messages)
+	}
+
+	// The balance recovers, then falls again
+	raise(false, true)
+	raise(true, true)
+	if len(alerts.messages) != 3 || alerts.messages[2].Data != lowBalance {
+		t.Fatalf("want low balance alert raised again after recovering, got %+v", alerts.messages)
+	}
+
+	// Next month, alerts are raised again
+	nextMonth := lowBalance
+	nextMonth.Month = "2026-11"
+	raiseAlerts(ctx, zap.NewNop(), targets, storageAdapter, budgetId, []alertCheck{{alert: nextMonth, triggered: true}})
+	if len(alerts.messages) != 4 {
+		t.Fatalf("want low balance alert raised in the next month, got %+v", alerts.messages)
+	}
+
+	if len(errorsOnly.messages) != 0 {
+		t.Errorf("want no alerts for target without the alerts event, got %d", len(errorsOnly.messages))
+	}
+}
+
+func TestRaiseAlertsRetriesUndelivered(t *testing.T) {
+	t.Chdir(t.TempDir())
+	ctx := context.Background()
+	storageAdapter := storage.NewLocalStorageAdapter()
+	budgetId := uuid.New()
+
+	failing := &fakeNotifier{err: errors.New("unavailable")}
+	targets := []notificationTarget{{notifier: failing, events: []notify.Event{notify.EventAlert}}}
+	checks := []alertCheck{{
+		alert:     Alert{Kind: AlertSplitCategoryBalance, Budget: "Household", Month: "2026-10", Value: 5_000, Threshold: 20_000},
+		triggered: true,
+	}}
+
+	raiseAlerts(ctx, zap.NewNop(), targets, storageAdapter, budgetId, checks)
+	raiseAlerts(ctx, zap.NewNop(), targets, storageAdapter, budgetId, checks)
+	if len(failing.messages) != 2 {
+		t.Fatalf("want undelivered alert tried again, got %d attempts", len(failing.messages))
+	}
+
+	failing.err = nil
+	raiseAlerts(ctx, zap.NewNop(), targets, storageAdapter, budgetId, checks)
+	raiseAlerts(ctx, zap.NewNop(), targets, storageAdapter, budgetId, checks)
+	if len(failing.messages) != 3 {
+		t.Errorf("want alert sent once after it's delivered, got %d attempts", len(failing.messages))
+	}
+}
@@ -0,0 +1,338 @@
+package internal
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	stderrors "errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"go.uber.org/zap"
+)
+
+// The most run records read to find each budget's last run for GET /status.
+const statusRunLimit = 100
+
+// apiHandler serves the local HTTP API.
+type apiHandler struct {
+	logger         *zap.Logger
+	storageAdapter storage.StorageAdapter
+	// Returns the config currently in use, which may change when the config file is reloaded
+	config func() *Config
+	// Returns when the next scheduled run is, or the zero time if none is scheduled
+	nextRun func() time.Time
+	// Tracks runs started by POST /runs, so they can finish before the process exits
+	runs *runGroup
+	// If set, every request must send it as a bearer token
+	token string
+}
+
+// runRequest is the body of POST /runs. Every field is optional, and an empty body runs every budget.
+type runRequest struct {
+	// ID or name of the budget to run. Required for a backfill if more than one budget is configured
+	Budget string `json:"budget"`
+	DryRun bool   `json:"dryRun"`
+	// If set, backfill rather than running incrementally
+	Backfill *backfillRequest `json:"backfill"`
+}
+
+type backfillRequest struct {
+	// Dates like "2026-01-01". Since is required
+	Since      string      `json:"since"`
+	Until      string      `json:"until"`
+	AccountIds []uuid.UUID `json:"accountIds"`
+}
+
+type runResponse struct {
+	Results []*RunResult `json:"results"`
+	// Joins the errors of every run which failed
+	Error string `json:"error,omitempty"`
+}
+
+type statusResponse struct {
+	// Omitted if no run is scheduled
+	NextRun *time.Time     `json:"nextRun,omitempty"`
+	Budgets []budgetStatus `json:"budgets"`
+}
+
+type budgetStatus struct {
+	BudgetId uuid.UUID `json:"budgetId"`
+	Name     string    `json:"name,omitempty"`
+	// The latest stored server knowledge, omitted if none has been stored
+	ServerKnowledge *int64 `json:"serverKnowledge,omitempty"`
+	// Omitted if the budget hasn't run recently
+	LastRun *RunResult `json:"lastRun,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// newApiHandler returns the handler for the local HTTP API:
+//
+//   - POST /runs runs every budget, or the one named in the body, optionally as a dry run or a backfill
+//   - GET /runs/{id} returns the result of a single stored run
+//   - GET /status returns each budget's last run and server knowledge, and when the next run is scheduled
+//   - GET /owed returns how much the other person owes, for ?budget= and ?month= like the owed command
+func newApiHandler(
+	logger *zap.Logger,
+	storageAdapter storage.StorageAdapter,
+	config func() *Config,
+	nextRun func() time.Time,
+	runs *runGroup,
+	token string,
+) http.Handler {
+	h := &apiHandler{
+		logger:         logger,
+		storageAdapter: storageAdapter,
+		config:         config,
+		nextRun:        nextRun,
+		runs:           runs,
+		token:          token,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /runs", h.postRuns)
+	mux.HandleFunc("GET /runs/{id}", h.getRun)
+	mux.HandleFunc("GET /status", h.getStatus)
+	mux.HandleFunc("GET /owed", h.getOwed)
+	return h.authenticate(mux)
+}
+
+func (h *apiHandler) authenticate(next http.Handler) http.Handler {
+	if h.token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeApiError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func (h *apiHandler) postRuns(w http.ResponseWriter, req *http.Request) {
+	var body runRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		writeApiError(w, http.StatusBadRequest, errors.Wrap(err, "invalid request body"))
+		return
+	}
+
+	cfg := h.config()
+	budgets := cfg.Budgets
+	if body.Budget != "" {
+		budget := cfg.Budget(body.Budget)
+		if budget == nil {
+			writeApiError(w, http.StatusNotFound, errors.Errorf("no budget with ID or name %q", body.Budget))
+			return
+		}
+		budgets = []BudgetConfig{*budget}
+	}
+
+	var backfill *BackfillOptions
+	if body.Backfill != nil {
+		if len(budgets) != 1 {
+			writeApiError(w, http.StatusBadRequest, errors.Errorf(
+				"config has %d budgets, set `budget` to choose which to backfill", len(budgets)))
+			return
+		}
+		opts, err := body.Backfill.options()
+		if err != nil {
+			writeApiError(w, http.StatusBadRequest, err)
+			return
+		}
+		backfill = &opts
+	}
+
+	if !h.runs.add() {
+		writeApiError(w, http.StatusServiceUnavailable, errors.New("shutting down, not starting any more runs"))
+		return
+	}
+	// Finish the run even if the client goes away, like a scheduled run
+	ctx := context.WithoutCancel(req.Context())
+	results, err := h.run(ctx, cfg, budgets, body.DryRun, backfill)
+	h.runs.done()
+
+	resp := runResponse{Results: results}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	writeApiJson(w, http.StatusOK, resp)
+}
+
+// run runs each of budgets as requested, returning the result of each in the same order.
+func (h *apiHandler) run(
+	ctx context.Context,
+	cfg *Config,
+	budgets []BudgetConfig,
+	dryRun bool,
+	backfill *BackfillOptions,
+) ([]*RunResult, error) {
+	switch {
+	case dryRun:
+		results := make([]*RunResult, len(budgets))
+		var errs []error
+		for i := range budgets {
+			var err error
+			results[i], err = DryRun(ctx, h.logger, cfg, &budgets[i], h.storageAdapter, backfill)
+			if err != nil {
+				errs = append(errs, errors.Wrapf(err, "budget %v", budgets[i].displayName()))
+			}
+		}
+		return results, stderrors.Join(errs...)
+	case backfill != nil:
+		result, err := Backfill(ctx, h.logger, cfg, &budgets[0], h.storageAdapter, *backfill)
+		return []*RunResult{result}, err
+	default:
+		runCfg := *cfg
+		runCfg.Budgets = budgets
+		return Run(ctx, h.logger, &runCfg, h.storageAdapter)
+	}
+}
+
+func (b *backfillRequest) options() (BackfillOptions, error) {
+	opts := BackfillOptions{AccountIds: b.AccountIds}
+	if b.Since == "" {
+		return opts, errors.New("`backfill.since` is required")
+	}
+	var err error
+	opts.Since, err = time.Parse(time.DateOnly, b.Since)
+	if err != nil {
+		return opts, errors.Errorf("invalid `backfill.since`, expected a date like 2026-01-01: %q", b.Since)
+	}
+	if b.Until != "" {
+		opts.Until, err = time.Parse(time.DateOnly, b.Until)
+		if err != nil {
+			return opts, errors.Errorf("invalid `backfill.until`, expected a date like 2026-01-01: %q", b.Until)
+		}
+	}
+	return opts, nil
+}
+
+func (h *apiHandler) getRun(w http.ResponseWriter, req *http.Request) {
+	runId, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		writeApiError(w, http.StatusBadRequest, errors.Errorf("invalid run ID %q", req.PathValue("id")))
+		return
+	}
+
+	record, err := h.storageAdapter.GetRunRecord(req.Context(), runId)
+	if errors.Is(err, storage.ErrNotFound) {
+		writeApiError(w, http.StatusNotFound, errors.Errorf("no run with ID %v", runId))
+		return
+	}
+	if err != nil {
+		h.logger.Error("failed to get run record", zap.Error(err))
+		writeApiError(w, http.StatusInternalServerError, errors.Wrap(err, "failed to get run record"))
+		return
+	}
+	writeApiJson(w, http.StatusOK, RunResultFromRecord(*record))
+}
+
+func (h *apiHandler) getStatus(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	cfg := h.config()
+
+	records, err := h.storageAdapter.ListRunRecords(ctx, statusRunLimit)
+	if err != nil {
+		h.logger.Error("failed to list run records", zap.Error(err))
+		writeApiError(w, http.StatusInternalServerError, errors.Wrap(err, "failed to list run records"))
+		return
+	}
+	lastRuns := make(map[uuid.UUID]*RunResult, len(cfg.Budgets))
+	for _, r := range records {
+		if _, ok := lastRuns[r.BudgetId]; !ok {
+			lastRuns[r.BudgetId] = RunResultFromRecord(r)
+		}
+	}
+
+	resp := statusResponse{Budgets: make([]budgetStatus, len(cfg.Budgets))}
+	if next := h.nextRun(); !next.IsZero() {
+		resp.NextRun = &next
+	}
+	for i := range cfg.Budgets {
+		budget := &cfg.Budgets[i]
+		status := budgetStatus{
+			BudgetId: budget.BudgetId,
+			Name:     budget.Name,
+			LastRun:  lastRuns[budget.BudgetId],
+		}
+
+		// Reading server knowledge doesn't need a YNAB client
+		for _, c := range newCursors(budget, h.storageAdapter, nil) {
+			serverKnowledge, err := c.get(ctx)
+			if errors.Is(err, storage.ErrNotFound) {
+				// Nothing has been fetched yet
+				continue
+			}
+			if err != nil {
+				h.logger.Error("failed to get server knowledge", zap.String("cursor", c.name), zap.Error(err))
+				writeApiError(w, http.StatusInternalServerError, errors.Wrap(err, "failed to get server knowledge"))
+				return
+			}
+			if status.ServerKnowledge == nil || serverKnowledge > *status.ServerKnowledge {
+				status.ServerKnowledge = &serverKnowledge
+			}
+		}
+		resp.Budgets[i] = status
+	}
+	writeApiJson(w, http.StatusOK, resp)
+}
+
+func (h *apiHandler) getOwed(w http.ResponseWriter, req *http.Request) {
+	cfg := h.config()
+	query := req.URL.Query()
+
+	var budget *BudgetConfig
+	if name := query.Get("budget"); name != "" {
+		budget = cfg.Budget(name)
+		if budget == nil {
+			writeApiError(w, http.StatusNotFound, errors.Errorf("no budget with ID or name %q", name))
+			return
+		}
+	} else if len(cfg.Budgets) == 1 {
+		budget = &cfg.Budgets[0]
+	} else {
+		writeApiError(w, http.StatusBadRequest, errors.Errorf(
+			"config has %d budgets, use ?budget= to choose one", len(cfg.Budgets)))
+		return
+	}
+
+	month := time.Now()
+	if m := query.Get("month"); m != "" {
+		var err error
+		month, err = time.Parse(monthFormat, m)
+		if err != nil {
+			writeApiError(w, http.StatusBadRequest, errors.Errorf("invalid month, expected a month like 2026-01: %q", m))
+			return
+		}
+	}
+
+	report, err := Owed(req.Context(), h.logger, budget, h.storageAdapter, month)
+	if err != nil {
+		h.logger.Error("failed to build owed report", zap.Error(err))
+		writeApiError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeApiJson(w, http.StatusOK, report)
+}
+
+func writeApiJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	// The status is already sent, so there's nothing more to do if this fails
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeApiError(w http.ResponseWriter, status int, err error) {
+	writeApiJson(w, status, errorResponse{Error: err.Error()})
+}
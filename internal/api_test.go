@@ -0,0 +1,219 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+	"go.uber.org/zap"
+)
+
+// newTestApi serves the API for a single budget, using local storage in a temporary directory.
+func newTestApi(t *testing.T, token string) (*httptest.Server, *BudgetConfig, storage.StorageAdapter) {
+	t.Chdir(t.TempDir())
+	fifty := 50
+	cfg := &Config{
+		Budgets: []BudgetConfig{{
+			Name:         "Household",
+			BudgetId:     uuid.New(),
+			IouAccountId: uuid.New(),
+			Flags:        []flagConfig{{Color: ynab.TransactionFlagColorBlue, PercentTheirShare: &fifty}},
+		}},
+	}
+	storageAdapter := storage.NewLocalStorageAdapter()
+	nextRun := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+
+	handler := newApiHandler(zap.NewNop(), storageAdapter,
+		func() *Config { return cfg },
+		func() time.Time { return nextRun },
+		&runGroup{},
+		token)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server, &cfg.Budgets[0], storageAdapter
+}
+
+func doApiRequest(t *testing.T, method string, url string, token string, body string, out any) int {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestApiAuthentication(t *testing.T) {
+	server, _, _ := newTestApi(t, "secret")
+
+	if status := doApiRequest(t, "GET", server.URL+"/status", "", "", nil); status != http.StatusUnauthorized {
+		t.Errorf("want 401 without token, got %d", status)
+	}
+	if status := doApiRequest(t, "GET", server.URL+"/status", "wrong", "", nil); status != http.StatusUnauthorized {
+		t.Errorf("want 401 with wrong token, got %d", status)
+	}
+	if status := doApiRequest(t, "GET", server.URL+"/status", "secret", "", nil); status != http.StatusOK {
+		t.Errorf("want 200 with token, got %d", status)
+	}
+}
+
+func TestApiGetRun(t *testing.T) {
+	server, budget, storageAdapter := newTestApi(t, "")
+	result := newRunResult(budget.BudgetId, RunKindIncremental)
+	result.Split = 3
+	result.finish(nil)
+	if err := storageAdapter.AppendRunRecord(context.Background(), result.Record()); err != nil {
+		t.Fatalf("failed to store run record: %v", err)
+	}
+
+	var got RunResult
+	if status := doApiRequest(t, "GET", server.URL+"/runs/"+result.RunId.String(), "", "", &got); status != http.StatusOK {
+		t.Fatalf("want 200 for stored run, got %d", status)
+	}
+	if got.RunId != result.RunId || got.Split != 3 {
+		t.Errorf("want stored run with 3 splits, got %+v", got)
+	}
+
+	if status := doApiRequest(t, "GET", server.URL+"/runs/"+uuid.NewString(), "", "", nil); status != http.StatusNotFound {
+		t.Errorf("want 404 for unknown run, got %d", status)
+	}
+	if status := doApiRequest(t, "GET", server.URL+"/runs/not-a-uuid", "", "", nil); status != http.StatusBadRequest {
+		t.Errorf("want 400 for invalid run ID, got %d", status)
+	}
+}
+
+func TestApiGetStatus(t *testing.T) {
+	server, budget, storageAdapter := newTestApi(t, "")
+	ctx := context.Background()
+	if err := storageAdapter.SetLastServerKnowledge(ctx, budget.BudgetId, 42); err != nil {
+		t.Fatalf("failed to store server knowledge: %v", err)
+	}
+	older := newRunResult(budget.BudgetId, RunKindIncremental)
+	older.finish(nil)
+	latest := newRunResult(budget.BudgetId, RunKindIncremental)
+	latest.finish(nil)
+	for _, r := range []*RunResult{older, latest} {
+		if err := storageAdapter.AppendRunRecord(ctx, r.Record()); err != nil {
+			t.Fatalf("failed to store run record: %v", err)
+		}
+	}
+
+	var got statusResponse
+	if status := doApiRequest(t, "GET", server.URL+"/status", "", "", &got); status != http.StatusOK {
+		t.Fatalf("want 200, got %d", status)
+	}
+	if got.NextRun == nil || !got.NextRun.Equal(time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("want next run at 10:00, got %v", got.NextRun)
+	}
+	if len(got.Budgets) != 1 {
+		t.Fatalf("want 1 budget, got %d", len(got.Budgets))
+	}
+	b := got.Budgets[0]
+	if b.Name != "Household" || b.ServerKnowledge == nil || *b.ServerKnowledge != 42 {
+		t.Errorf("want Household with server knowledge 42, got %+v", b)
+	}
+	if b.LastRun == nil || b.LastRun.RunId != latest.RunId {
+		t.Errorf("want last run %v, got %+v", latest.RunId, b.LastRun)
+	}
+}
+
+func TestApiGetStatusStorageError(t *testing.T) {
+	server, _, _ := newTestApi(t, "")
+	if err := os.WriteFile("storage.yml", []byte("not: [valid"), 0o644); err != nil {
+		t.Fatalf("failed to corrupt storage: %v", err)
+	}
+
+	if status := doApiRequest(t, "GET", server.URL+"/status", "", "", nil); status != http.StatusInternalServerError {
+		t.Errorf("want 500 when server knowledge can't be read, got %d", status)
+	}
+}
+
+func TestApiGetOwed(t *testing.T) {
+	server, budget, storageAdapter := newTestApi(t, "")
+	err := storageAdapter.PutSplitRecords(context.Background(), budget.BudgetId, []storage.SplitRecord{
+		{TransactionId: "t1", Date: "2026-09-05", Amount: -20_000, TheirShare: -10_000},
+		{TransactionId: "t2", Date: "2026-10-05", Amount: -40_000, TheirShare: -20_000},
+	})
+	if err != nil {
+		t.Fatalf("failed to store splits: %v", err)
+	}
+
+	var got OwedReport
+	if status := doApiRequest(t, "GET", server.URL+"/owed?month=2026-09&budget=Household", "", "", &got); status != http.StatusOK {
+		t.Fatalf("want 200, got %d", status)
+	}
+	if got.Month != "2026-09" || got.Owed != 10_000 {
+		t.Errorf("want 10000 owed for 2026-09, got %+v", got)
+	}
+
+	if status := doApiRequest(t, "GET", server.URL+"/owed?month=September", "", "", nil); status != http.StatusBadRequest {
+		t.Errorf("want 400 for invalid month, got %d", status)
+	}
+	if status := doApiRequest(t, "GET", server.URL+"/owed?budget=Other", "", "", nil); status != http.StatusNotFound {
+		t.Errorf("want 404 for unknown budget, got %d", status)
+	}
+}
+
+func TestApiPostRunsInvalid(t *testing.T) {
+	server, _, _ := newTestApi(t, "")
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"malformed body", "{", http.StatusBadRequest},
+		{"unknown budget", `{"budget": "Other"}`, http.StatusNotFound},
+		{"backfill without since", `{"backfill": {}}`, http.StatusBadRequest},
+		{"backfill with invalid date", `{"backfill": {"since": "last week"}}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		var got errorResponse
+		if status := doApiRequest(t, "POST", server.URL+"/runs", "", tt.body, &got); status != tt.want || got.Error == "" {
+			t.Errorf("%v: want %d with an error, got %d, %+v", tt.name, tt.want, status, got)
+		}
+	}
+
+	if status := doApiRequest(t, "DELETE", server.URL+"/runs", "", "", nil); status != http.StatusMethodNotAllowed {
+		t.Errorf("want 405 for unsupported method, got %d", status)
+	}
+}
+
+func TestApiPostRunsWhileStopping(t *testing.T) {
+	cfg := &Config{Budgets: []BudgetConfig{{BudgetId: uuid.New()}}}
+	runs := &runGroup{}
+	runs.closeAndWait()
+
+	handler := newApiHandler(zap.NewNop(), storage.NewLocalStorageAdapter(),
+		func() *Config { return cfg },
+		func() time.Time { return time.Time{} },
+		runs,
+		"")
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	if status := doApiRequest(t, "POST", server.URL+"/runs", "", "", nil); status != http.StatusServiceUnavailable {
+		t.Errorf("want 503 once stopping, got %d", status)
+	}
+}
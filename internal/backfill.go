@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+	"go.uber.org/zap"
+)
+
+type BackfillOptions struct {
+	// Only transactions dated on or after Since are processed
+	Since time.Time
+	// If set, only transactions dated on or before Until are processed
+	Until time.Time
+	// If set, only transactions in these accounts are processed. Otherwise the whole budget is
+	AccountIds []uuid.UUID
+}
+
+// Backfill applies the current rules of the given budget to every transaction in the given date range, e.g. to split
+// older history after adding a new account rule. Unlike Run, it does not read or update the stored server knowledge.
+func Backfill(
+	ctx context.Context,
+	logger *zap.Logger,
+	cfg *Config,
+	budget *BudgetConfig,
+	storageAdapter storage.StorageAdapter,
+	opts BackfillOptions,
+) (*RunResult, error) {
+	return runJob(ctx, logger, cfg, budget, storageAdapter, RunKindBackfill,
+		func(ctx context.Context, logger *zap.Logger, r *budgetRun) error {
+			transactions, err := fetchBackfillTransactions(ctx, r.client, budget.BudgetId, opts)
+			if err != nil {
+				return errors.Wrap(err, "failed to fetch transactions from YNAB")
+			}
+
+			r.processTransactions(ctx, logger, transactions)
+			return nil
+		})
+}
+
+func fetchBackfillTransactions(
+	ctx context.Context,
+	client ynabClient,
+	budgetId uuid.UUID,
+	opts BackfillOptions,
+) ([]ynab.TransactionDetail, error) {
+	var transactions []ynab.TransactionDetail
+	if len(opts.AccountIds) == 0 {
+		resp, err := client.FetchTransactions(ctx, budgetId, 0, opts.Since)
+		if err != nil {
+			return nil, err
+		}
+		transactions = resp.JSON200.Data.Transactions
+	} else {
+		for _, accountId := range opts.AccountIds {
+			resp, err := client.FetchAccountTransactions(ctx, budgetId, accountId, 0, opts.Since)
+			if err != nil {
+				return nil, err
+			}
+			transactions = append(transactions, resp.JSON200.Data.Transactions...)
+		}
+	}
+
+	return transactionsUntil(transactions, opts.Until), nil
+}
+
+// transactionsUntil returns the transactions dated on or before until, or all transactions if until is zero. YNAB has
+// no way to filter by end date, so this happens after fetching.
+func transactionsUntil(transactions []ynab.TransactionDetail, until time.Time) []ynab.TransactionDetail {
+	if until.IsZero() {
+		return transactions
+	}
+
+	filtered := make([]ynab.TransactionDetail, 0, len(transactions))
+	for _, t := range transactions {
+		if !t.Date.After(until) {
+			filtered = append(filtered, t)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/oapi-codegen/runtime/types"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+)
+
+func TestTransactionsUntil(t *testing.T) {
+	date := func(s string) types.Date {
+		d, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			t.Fatalf("invalid date %q: %v", s, err)
+		}
+		return types.Date{Time: d}
+	}
+
+	transactions := []ynab.TransactionDetail{
+		{Id: "before", Date: date("2026-01-31")},
+		{Id: "on", Date: date("2026-02-01")},
+		{Id: "after", Date: date("2026-02-02")},
+	}
+
+	ids := func(transactions []ynab.TransactionDetail) []string {
+		got := make([]string, len(transactions))
+		for i, t := range transactions {
+			got[i] = t.Id
+		}
+		return got
+	}
+
+	got := ids(transactionsUntil(transactions, date("2026-02-01").Time))
+	if diff := cmp.Diff([]string{"before", "on"}, got); diff != "" {
+		t.Errorf("transactions did not match expected. Diff (-want +got):\n%s", diff)
+	}
+
+	got = ids(transactionsUntil(transactions, time.Time{}))
+	if diff := cmp.Diff([]string{"before", "on", "after"}, got); diff != "" {
+		t.Errorf("want all transactions with no end date. Diff (-want +got):\n%s", diff)
+	}
+}
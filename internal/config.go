@@ -3,8 +3,11 @@ package internal
 import (
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/oapi-codegen/runtime/types"
+	"github.com/samshadwell/split-ynab/internal/notify"
 	"github.com/samshadwell/split-ynab/internal/ynab"
 	"gopkg.in/yaml.v3"
 )
@@ -20,14 +23,162 @@ type flagConfig struct {
 	PercentTheirShare *int                      `yaml:"percentTheirShare"`
 }
 
+// FirstRunMode controls what happens the first time the program runs against a budget, when there is no stored server
+// knowledge.
+type FirstRunMode string
+
+const (
+	// Split matching transactions within the initial lookback window
+	FirstRunSplit FirstRunMode = "split"
+	// Only record the current server knowledge, so that only transactions changed from now on are split
+	FirstRunRecordOnly FirstRunMode = "recordOnly"
+)
+
+// settlementRule recognizes inflows which are the other person paying back what they owe. Every field which is set
+// must match.
+type settlementRule struct {
+	// Matches payees whose name contains this, ignoring case
+	Payee     string    `yaml:"payee"`
+	AccountId uuid.UUID `yaml:"accountId"`
+	// Matches memos which contain this, ignoring case
+	Memo string `yaml:"memo"`
+}
+
+// mirrorConfig describes where to mirror their share of each split transaction in the other person's own budget.
+type mirrorConfig struct {
+	YnabToken string    `yaml:"ynabToken"`
+	BudgetId  uuid.UUID `yaml:"budgetId"`
+	// The account in their budget which tracks what they owe
+	AccountId uuid.UUID `yaml:"accountId"`
+	// Maps categories in our budget to categories in theirs. Transactions in other categories use DefaultCategoryId
+	Categories map[uuid.UUID]uuid.UUID `yaml:"categories"`
+	// Optional. If unset, mirrored transactions in unmapped categories are left uncategorized
+	DefaultCategoryId *uuid.UUID `yaml:"defaultCategoryId"`
+}
+
+// splitwiseConfig describes how to exchange expenses with a Splitwise group.
+type splitwiseConfig struct {
+	// Our name, and the other person's, as they appear in the group's columns in Splitwise's CSV export
+	Name        string `yaml:"name"`
+	PartnerName string `yaml:"partnerName"`
+	// The account in which to record our share of expenses other people paid, when importing
+	AccountId uuid.UUID `yaml:"accountId"`
+	// Maps Splitwise category names to categories in our budget. Expenses in other categories use DefaultCategoryId
+	Categories map[string]uuid.UUID `yaml:"categories"`
+	// Optional. If unset, imported expenses in unmapped categories are left uncategorized
+	DefaultCategoryId *uuid.UUID `yaml:"defaultCategoryId"`
+}
+
+// notificationConfig describes a single destination for notifications about runs.
+type notificationConfig struct {
+	// One of "webhook", "ntfy", or "email"
+	Type string `yaml:"type"`
+	// For webhook and ntfy, where to send notifications
+	Url string `yaml:"url"`
+	// For webhook, extra headers to send, e.g. for authentication
+	Headers map[string]string `yaml:"headers"`
+	// For ntfy, an optional access token
+	Token string       `yaml:"token"`
+	Email *emailConfig `yaml:"email"`
+	// Which events to send. Defaults to only errors
+	Events []notify.Event `yaml:"events"`
+}
+
+type emailConfig struct {
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// scheduleConfig describes when `serve` runs. Exactly one of Cron and Interval must be set.
+type scheduleConfig struct {
+	// A cron expression with five fields: minute, hour, day of month, month, and day of week
+	Cron string `yaml:"cron"`
+	// How long to wait after each run before the next, e.g. "30m"
+	Interval time.Duration `yaml:"interval"`
+}
+
+// apiConfig describes the HTTP API served alongside `serve`. Changes take effect when `serve` is restarted.
+type apiConfig struct {
+	// The address to listen on, e.g. "127.0.0.1:8080"
+	Address string `yaml:"address"`
+	// Optional. If set, every request must send it as a bearer token
+	Token string `yaml:"token"`
+}
+
+// alertsConfig describes when to warn about a budget's shared spending. At least one threshold must be set.
+type alertsConfig struct {
+	// Optional. Alert when the split category's balance this month falls below this
+	SplitCategoryBalanceBelow *Milliunits `yaml:"splitCategoryBalanceBelow"`
+	// Optional. Alert when the total of the transactions split this month rises above this
+	MonthlySplitAbove *Milliunits `yaml:"monthlySplitAbove"`
+}
+
+// categoryTarget describes how much to keep budgeted in the split category.
+type categoryTarget struct {
+	// The balance to top the category up to
+	Amount Milliunits `yaml:"amount"`
+	// Optional. Also top up mid-month whenever the balance falls below this. If unset, the category is only topped up
+	// on the first run each month
+	Threshold *Milliunits `yaml:"threshold"`
+}
+
+// BudgetConfig holds the settings for a single budget: how to access it, and which of its transactions to split.
+type BudgetConfig struct {
+	// Optional, used to identify the budget in logs and command-line flags
+	Name            string    `yaml:"name,omitempty"`
+	YnabToken       string    `yaml:"ynabToken"`
+	BudgetId        uuid.UUID `yaml:"budgetId"`
+	SplitCategoryId uuid.UUID `yaml:"splitCategoryId"`
+	// Optional, keeps the split category funded each month. Only valid with SplitCategoryId
+	SplitCategoryTarget *categoryTarget `yaml:"splitCategoryTarget"`
+	// Instead of SplitCategoryId, transfer their share to this account, so its balance shows what they owe
+	IouAccountId uuid.UUID       `yaml:"iouAccountId"`
+	Accounts     []accountConfig `yaml:"accounts"`
+	Flags        []flagConfig    `yaml:"flags"`
+	// Optional, recognizes repayments and records them against their share
+	Settlements []settlementRule `yaml:"settlements"`
+	// Optional, mirrors their share of each split into their own budget
+	Mirror *mirrorConfig `yaml:"mirror"`
+	// Optional, used to export to and import from Splitwise
+	Splitwise *splitwiseConfig `yaml:"splitwise"`
+	// Optional, the account in which to record expenses the other person paid for us. Not used with IouAccountId, where
+	// they're recorded in the IOU account instead
+	PartnerPaidAccountId uuid.UUID `yaml:"partnerPaidAccountId"`
+	// Optional, warns when the budget's shared spending crosses a threshold
+	Alerts *alertsConfig `yaml:"alerts"`
+}
+
 type Config struct {
-	YnabToken       string          `yaml:"ynabToken"`
-	BudgetId        uuid.UUID       `yaml:"budgetId"`
-	SplitCategoryId uuid.UUID       `yaml:"splitCategoryId"`
-	Accounts        []accountConfig `yaml:"accounts"`
-	Flags           []flagConfig    `yaml:"flags"`
+	// A single budget may be configured at the top level of the file. After loading, it is moved into Budgets and
+	// this is left empty.
+	BudgetConfig `yaml:",inline"`
+	Budgets      []BudgetConfig `yaml:"budgets"`
+	// The maximum number of budgets to process at the same time
+	MaxParallelism  int `yaml:"maxParallelism"`
+	UpdateChunkSize int `yaml:"updateChunkSize"`
+	// On the first run, look at transactions from this many days ago onwards. Mutually exclusive with StartDate
+	InitialLookbackDays int `yaml:"initialLookbackDays"`
+	// On the first run, look at transactions dated on or after this date. Mutually exclusive with InitialLookbackDays
+	StartDate *types.Date  `yaml:"startDate"`
+	FirstRun  FirstRunMode `yaml:"firstRun"`
+	// Optional, where to send notifications about runs
+	Notifications []notificationConfig `yaml:"notifications"`
+	// Optional, when to run when running as a long-lived process with `serve`
+	Schedule *scheduleConfig `yaml:"schedule"`
+	// Optional, serves a local HTTP API alongside `serve`
+	Api *apiConfig `yaml:"api"`
 }
 
+const (
+	defaultMaxParallelism      = 4
+	defaultUpdateChunkSize     = 50
+	defaultInitialLookbackDays = 30
+)
+
 func LoadConfig(reader io.Reader) (*Config, error) {
 	decoder := yaml.NewDecoder(reader)
 	var cfg Config
@@ -49,15 +200,104 @@ func LoadConfig(reader io.Reader) (*Config, error) {
 	return &cfg, nil
 }
 
+// Budget returns the configured budget with the given ID or name, or nil if there isn't one.
+func (cfg *Config) Budget(idOrName string) *BudgetConfig {
+	for i, b := range cfg.Budgets {
+		if b.BudgetId.String() == idOrName || (b.Name != "" && b.Name == idOrName) {
+			return &cfg.Budgets[i]
+		}
+	}
+	return nil
+}
+
 func (cfg *Config) validate() error {
+	hasTopLevelBudget := !cfg.BudgetConfig.isEmpty()
+	if hasTopLevelBudget && len(cfg.Budgets) > 0 {
+		return fmt.Errorf("budget settings must either be at the top level or in `budgets`, not both")
+	}
+
+	if hasTopLevelBudget || len(cfg.Budgets) == 0 {
+		if err := cfg.BudgetConfig.validate(); err != nil {
+			return err
+		}
+	}
+
+	seen := make(map[uuid.UUID]bool, len(cfg.Budgets))
+	for idx, budget := range cfg.Budgets {
+		if err := budget.validate(); err != nil {
+			return fmt.Errorf("invalid budget in `budgets` at index %v: %w", idx, err)
+		}
+		if seen[budget.BudgetId] {
+			return fmt.Errorf("duplicate `budgetId` in `budgets`: %v", budget.BudgetId)
+		}
+		seen[budget.BudgetId] = true
+	}
+
+	if cfg.MaxParallelism < 0 {
+		return fmt.Errorf("invalid `maxParallelism`, must be positive: %v", cfg.MaxParallelism)
+	}
+
+	if cfg.UpdateChunkSize < 0 {
+		return fmt.Errorf("invalid `updateChunkSize`, must be positive: %v", cfg.UpdateChunkSize)
+	}
+
+	if cfg.InitialLookbackDays < 0 {
+		return fmt.Errorf("invalid `initialLookbackDays`, must be positive: %v", cfg.InitialLookbackDays)
+	}
+	if cfg.InitialLookbackDays != 0 && cfg.StartDate != nil {
+		return fmt.Errorf("only one of `initialLookbackDays` and `startDate` may be set")
+	}
+
+	switch cfg.FirstRun {
+	case "", FirstRunSplit, FirstRunRecordOnly:
+	default:
+		return fmt.Errorf("invalid `firstRun`, must be one of %q or %q: %v", FirstRunSplit, FirstRunRecordOnly, cfg.FirstRun)
+	}
+
+	for idx, n := range cfg.Notifications {
+		if err := n.validate(); err != nil {
+			return fmt.Errorf("invalid entry in `notifications` at index %v: %w", idx, err)
+		}
+	}
+
+	if cfg.Schedule != nil {
+		if err := cfg.Schedule.validate(); err != nil {
+			return fmt.Errorf("invalid `schedule`: %w", err)
+		}
+	}
+
+	if cfg.Api != nil && cfg.Api.Address == "" {
+		return fmt.Errorf("invalid `api`: missing required field `address`")
+	}
+
+	return nil
+}
+
+func (budget *BudgetConfig) isEmpty() bool {
+	return budget.Name == "" &&
+		budget.YnabToken == "" &&
+		budget.BudgetId == uuid.Nil &&
+		budget.SplitCategoryId == uuid.Nil &&
+		budget.SplitCategoryTarget == nil &&
+		budget.IouAccountId == uuid.Nil &&
+		len(budget.Accounts) == 0 &&
+		len(budget.Flags) == 0 &&
+		len(budget.Settlements) == 0 &&
+		budget.Mirror == nil &&
+		budget.Splitwise == nil &&
+		budget.PartnerPaidAccountId == uuid.Nil &&
+		budget.Alerts == nil
+}
+
+func (budget *BudgetConfig) validate() error {
 	missingFields := make([]string, 0)
-	if len(cfg.YnabToken) == 0 {
+	if len(budget.YnabToken) == 0 {
 		missingFields = append(missingFields, "ynabToken")
 	}
-	if cfg.BudgetId == uuid.Nil {
+	if budget.BudgetId == uuid.Nil {
 		missingFields = append(missingFields, "budgetId")
 	}
-	if cfg.SplitCategoryId == uuid.Nil {
+	if budget.SplitCategoryId == uuid.Nil && budget.IouAccountId == uuid.Nil {
 		missingFields = append(missingFields, "splitCategoryId")
 	}
 
@@ -65,6 +305,32 @@ func (cfg *Config) validate() error {
 		return fmt.Errorf("missing required fields: %v", missingFields)
 	}
 
+	if budget.SplitCategoryId != uuid.Nil && budget.IouAccountId != uuid.Nil {
+		return fmt.Errorf("only one of `splitCategoryId` and `iouAccountId` may be set")
+	}
+
+	if budget.PartnerPaidAccountId != uuid.Nil && budget.IouAccountId != uuid.Nil {
+		return fmt.Errorf("`partnerPaidAccountId` can't be used with `iouAccountId`, which records what they paid instead")
+	}
+
+	if budget.SplitCategoryTarget != nil {
+		if budget.IouAccountId != uuid.Nil {
+			return fmt.Errorf("`splitCategoryTarget` requires `splitCategoryId`, and can't be used with `iouAccountId`")
+		}
+		if err := budget.SplitCategoryTarget.validate(); err != nil {
+			return fmt.Errorf("invalid `splitCategoryTarget`: %w", err)
+		}
+	}
+
+	if budget.Alerts != nil {
+		if budget.Alerts.SplitCategoryBalanceBelow != nil && budget.IouAccountId != uuid.Nil {
+			return fmt.Errorf("`alerts.splitCategoryBalanceBelow` requires `splitCategoryId`, and can't be used with `iouAccountId`")
+		}
+		if err := budget.Alerts.validate(); err != nil {
+			return fmt.Errorf("invalid `alerts`: %w", err)
+		}
+	}
+
 	// Doesn't seem like there's a better way than enumerating these by hand
 	validColors := map[ynab.TransactionFlagColor]bool{
 		ynab.TransactionFlagColorBlue:   true,
@@ -76,7 +342,7 @@ func (cfg *Config) validate() error {
 		ynab.TransactionFlagColorYellow: true,
 	}
 
-	for idx, acct := range cfg.Accounts {
+	for idx, acct := range budget.Accounts {
 		if acct.Id == uuid.Nil {
 			return fmt.Errorf("invalid or mal-formatted `id` in `accounts` at index %v", idx)
 		}
@@ -93,7 +359,7 @@ func (cfg *Config) validate() error {
 		}
 	}
 
-	for _, flag := range cfg.Flags {
+	for _, flag := range budget.Flags {
 		if !validColors[flag.Color] {
 			return fmt.Errorf("invalid flag color in `flags`: %v", flag)
 		}
@@ -105,25 +371,177 @@ func (cfg *Config) validate() error {
 		}
 	}
 
-	if len(cfg.Accounts) == 0 && len(cfg.Flags) == 0 {
+	if len(budget.Accounts) == 0 && len(budget.Flags) == 0 {
 		return fmt.Errorf("config must have at least one of either account or flag")
 	}
 
+	for idx, rule := range budget.Settlements {
+		if rule.Payee == "" && rule.AccountId == uuid.Nil && rule.Memo == "" {
+			return fmt.Errorf("rule in `settlements` at index %v must set at least one of `payee`, `accountId`, or `memo`", idx)
+		}
+	}
+
+	if budget.Mirror != nil {
+		if err := budget.Mirror.validate(); err != nil {
+			return fmt.Errorf("invalid `mirror`: %w", err)
+		}
+	}
+
+	if budget.Splitwise != nil && budget.Splitwise.Name == "" {
+		return fmt.Errorf("invalid `splitwise`: missing required fields: [name]")
+	}
+
+	return nil
+}
+
+func (t *categoryTarget) validate() error {
+	if t.Amount <= 0 {
+		return fmt.Errorf("`amount` must be positive: %v", t.Amount)
+	}
+	if t.Threshold != nil && (*t.Threshold < 0 || *t.Threshold > t.Amount) {
+		return fmt.Errorf("`threshold` must be between 0 and `amount`, inclusive: %v", *t.Threshold)
+	}
+	return nil
+}
+
+func (a *alertsConfig) validate() error {
+	if a.SplitCategoryBalanceBelow == nil && a.MonthlySplitAbove == nil {
+		return fmt.Errorf("at least one of `splitCategoryBalanceBelow` and `monthlySplitAbove` must be set")
+	}
+	if a.MonthlySplitAbove != nil && *a.MonthlySplitAbove <= 0 {
+		return fmt.Errorf("`monthlySplitAbove` must be positive: %v", *a.MonthlySplitAbove)
+	}
+	return nil
+}
+
+func (m *mirrorConfig) validate() error {
+	missingFields := make([]string, 0)
+	if len(m.YnabToken) == 0 {
+		missingFields = append(missingFields, "ynabToken")
+	}
+	if m.BudgetId == uuid.Nil {
+		missingFields = append(missingFields, "budgetId")
+	}
+	if m.AccountId == uuid.Nil {
+		missingFields = append(missingFields, "accountId")
+	}
+
+	if len(missingFields) > 0 {
+		return fmt.Errorf("missing required fields: %v", missingFields)
+	}
+	return nil
+}
+
+func (n *notificationConfig) validate() error {
+	switch n.Type {
+	case "webhook", "ntfy":
+		if n.Url == "" {
+			return fmt.Errorf("missing required fields: [url]")
+		}
+	case "email":
+		if n.Email == nil {
+			return fmt.Errorf("missing required fields: [email]")
+		}
+		missingFields := make([]string, 0)
+		if n.Email.Host == "" {
+			missingFields = append(missingFields, "host")
+		}
+		if n.Email.Port == 0 {
+			missingFields = append(missingFields, "port")
+		}
+		if n.Email.From == "" {
+			missingFields = append(missingFields, "from")
+		}
+		if len(n.Email.To) == 0 {
+			missingFields = append(missingFields, "to")
+		}
+		if len(missingFields) > 0 {
+			return fmt.Errorf("missing required fields in `email`: %v", missingFields)
+		}
+	default:
+		return fmt.Errorf("invalid `type`, must be one of %q, %q, or %q: %v", "webhook", "ntfy", "email", n.Type)
+	}
+
+	for _, e := range n.Events {
+		switch e {
+		case notify.EventError, notify.EventSplit, notify.EventDigest, notify.EventAlert:
+		default:
+			return fmt.Errorf("invalid event in `events`, must be one of %q, %q, %q, or %q: %v",
+				notify.EventError, notify.EventSplit, notify.EventDigest, notify.EventAlert, e)
+		}
+	}
 	return nil
 }
 
 func (cfg *Config) setDefaults() {
+	if !cfg.BudgetConfig.isEmpty() {
+		cfg.Budgets = []BudgetConfig{cfg.BudgetConfig}
+		cfg.BudgetConfig = BudgetConfig{}
+	}
+
+	for i := range cfg.Budgets {
+		cfg.Budgets[i].setDefaults()
+	}
+
+	if cfg.MaxParallelism == 0 {
+		cfg.MaxParallelism = defaultMaxParallelism
+	}
+
+	if cfg.UpdateChunkSize == 0 {
+		cfg.UpdateChunkSize = defaultUpdateChunkSize
+	}
+
+	if cfg.InitialLookbackDays == 0 && cfg.StartDate == nil {
+		cfg.InitialLookbackDays = defaultInitialLookbackDays
+	}
+
+	if cfg.FirstRun == "" {
+		cfg.FirstRun = FirstRunSplit
+	}
+
+	for i, n := range cfg.Notifications {
+		if len(n.Events) == 0 {
+			cfg.Notifications[i].Events = []notify.Event{notify.EventError}
+		}
+	}
+}
+
+func (budget *BudgetConfig) setDefaults() {
 	fifty := new(int)
 	*fifty = 50
-	for i, acct := range cfg.Accounts {
+	for i, acct := range budget.Accounts {
 		if acct.DefaultPercentTheirShare == nil {
-			cfg.Accounts[i].DefaultPercentTheirShare = fifty
+			budget.Accounts[i].DefaultPercentTheirShare = fifty
 		}
 	}
 
-	for i, flag := range cfg.Flags {
+	for i, flag := range budget.Flags {
 		if flag.PercentTheirShare == nil {
-			cfg.Flags[i].PercentTheirShare = fifty
+			budget.Flags[i].PercentTheirShare = fifty
 		}
 	}
 }
+
+// initialSinceDate returns the date from which transactions are processed when there is no stored server knowledge.
+func (cfg *Config) initialSinceDate(now time.Time) time.Time {
+	if cfg.StartDate != nil {
+		return cfg.StartDate.Time
+	}
+	return now.AddDate(0, 0, -cfg.InitialLookbackDays)
+}
+
+// isTheirShare reports whether sub is the part of a split transaction which holds the other person's share.
+func (budget *BudgetConfig) isTheirShare(sub ynab.SubTransaction) bool {
+	if budget.IouAccountId != uuid.Nil {
+		return sub.TransferAccountId != nil && *sub.TransferAccountId == budget.IouAccountId
+	}
+	return sub.CategoryId != nil && *sub.CategoryId == budget.SplitCategoryId
+}
+
+// displayName returns the budget's name if it has one, or its ID otherwise.
+func (budget *BudgetConfig) displayName() string {
+	if budget.Name != "" {
+		return budget.Name
+	}
+	return budget.BudgetId.String()
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/uuid"
+	"github.com/samshadwell/split-ynab/internal/notify"
 	"github.com/samshadwell/split-ynab/internal/ynab"
 )
 
@@ -33,25 +34,31 @@ flags:
 	thirty := 30
 	fifty := 50
 	want := Config{
-		YnabToken:       "my-fake-token",
-		BudgetId:        uuid.MustParse("00000000-0000-0000-0000-000000000001"),
-		SplitCategoryId: uuid.MustParse("00000000-0000-0000-0000-000000000002"),
-		Accounts: []accountConfig{
-			{
-				Id:                       uuid.MustParse("00000000-0000-0000-0000-000000000003"),
-				ExceptFlags:              []ynab.TransactionFlagColor{ynab.TransactionFlagColorGreen},
-				DefaultPercentTheirShare: &fifty,
+		Budgets: []BudgetConfig{{
+			YnabToken:       "my-fake-token",
+			BudgetId:        uuid.MustParse("00000000-0000-0000-0000-000000000001"),
+			SplitCategoryId: uuid.MustParse("00000000-0000-0000-0000-000000000002"),
+			Accounts: []accountConfig{
+				{
+					Id:                       uuid.MustParse("00000000-0000-0000-0000-000000000003"),
+					ExceptFlags:              []ynab.TransactionFlagColor{ynab.TransactionFlagColorGreen},
+					DefaultPercentTheirShare: &fifty,
+				},
+				{
+					Id:                       uuid.MustParse("00000000-0000-0000-0000-000000000004"),
+					ExceptFlags:              nil,
+					DefaultPercentTheirShare: &thirty,
+				},
 			},
-			{
-				Id:                       uuid.MustParse("00000000-0000-0000-0000-000000000004"),
-				ExceptFlags:              nil,
-				DefaultPercentTheirShare: &thirty,
+			Flags: []flagConfig{
+				{Color: ynab.TransactionFlagColorOrange, PercentTheirShare: &fifty},
+				{Color: ynab.TransactionFlagColorPurple, PercentTheirShare: &thirty},
 			},
-		},
-		Flags: []flagConfig{
-			{Color: ynab.TransactionFlagColorOrange, PercentTheirShare: &fifty},
-			{Color: ynab.TransactionFlagColorPurple, PercentTheirShare: &thirty},
-		},
+		}},
+		MaxParallelism:      defaultMaxParallelism,
+		UpdateChunkSize:     defaultUpdateChunkSize,
+		InitialLookbackDays: defaultInitialLookbackDays,
+		FirstRun:            FirstRunSplit,
 	}
 
 	if diff := cmp.Diff(&want, got); diff != "" {
@@ -126,3 +133,217 @@ accounts:
 		t.Errorf("wanted error to include invalid percent their share '100', got %v", err)
 	}
 }
+
+func TestLoadConfigLookbackAndStartDate(t *testing.T) {
+	s := `---
+ynabToken: "my-fake-token"
+budgetId: "00000000-0000-0000-0000-000000000001"
+splitCategoryId: "00000000-0000-0000-0000-000000000002"
+flags:
+  - color: "orange"
+initialLookbackDays: 10
+startDate: 2026-01-01
+`
+
+	_, err := LoadConfig(strings.NewReader(s))
+	if err == nil {
+		t.Fatalf("wanted error, got nil")
+	}
+
+	if !strings.Contains(err.Error(), "startDate") {
+		t.Errorf("wanted error to mention 'startDate', got %v", err)
+	}
+}
+
+func TestLoadConfigMultipleBudgets(t *testing.T) {
+	s := `---
+maxParallelism: 2
+budgets:
+  - name: "ours"
+    ynabToken: "my-fake-token"
+    budgetId: "00000000-0000-0000-0000-000000000001"
+    splitCategoryId: "00000000-0000-0000-0000-000000000002"
+    flags:
+      - color: "orange"
+  - name: "theirs"
+    ynabToken: "their-fake-token"
+    budgetId: "00000000-0000-0000-0000-000000000011"
+    splitCategoryId: "00000000-0000-0000-0000-000000000012"
+    accounts:
+      - id: "00000000-0000-0000-0000-000000000013"
+`
+
+	got, err := LoadConfig(strings.NewReader(s))
+	if err != nil {
+		t.Fatalf("wanted nil error, got %v", err)
+	}
+
+	if len(got.Budgets) != 2 {
+		t.Fatalf("want 2 budgets, got %d", len(got.Budgets))
+	}
+	if got.MaxParallelism != 2 {
+		t.Errorf("want maxParallelism 2, got %d", got.MaxParallelism)
+	}
+	if b := got.Budget("theirs"); b == nil || b.YnabToken != "their-fake-token" {
+		t.Errorf("want budget named 'theirs' to use its own token, got %v", b)
+	}
+	if b := got.Budget("00000000-0000-0000-0000-000000000001"); b == nil || b.Name != "ours" {
+		t.Errorf("want budget to be found by ID, got %v", b)
+	}
+	if *got.Budgets[0].Flags[0].PercentTheirShare != 50 {
+		t.Errorf("want defaults to be applied to each budget, got %d", *got.Budgets[0].Flags[0].PercentTheirShare)
+	}
+}
+
+func TestLoadConfigDuplicateBudgets(t *testing.T) {
+	s := `---
+budgets:
+  - ynabToken: "my-fake-token"
+    budgetId: "00000000-0000-0000-0000-000000000001"
+    splitCategoryId: "00000000-0000-0000-0000-000000000002"
+    flags:
+      - color: "orange"
+  - ynabToken: "my-fake-token"
+    budgetId: "00000000-0000-0000-0000-000000000001"
+    splitCategoryId: "00000000-0000-0000-0000-000000000002"
+    flags:
+      - color: "blue"
+`
+
+	_, err := LoadConfig(strings.NewReader(s))
+	if err == nil {
+		t.Fatalf("wanted error, got nil")
+	}
+
+	if !strings.Contains(err.Error(), "duplicate") {
+		t.Errorf("wanted error to mention the duplicate budget, got %v", err)
+	}
+}
+
+func TestLoadConfigIouAccount(t *testing.T) {
+	s := `---
+ynabToken: "my-fake-token"
+budgetId: "00000000-0000-0000-0000-000000000001"
+iouAccountId: "00000000-0000-0000-0000-000000000005"
+flags:
+  - color: "orange"
+`
+
+	got, err := LoadConfig(strings.NewReader(s))
+	if err != nil {
+		t.Fatalf("wanted nil error without splitCategoryId, got %v", err)
+	}
+	if got.Budgets[0].IouAccountId != uuid.MustParse("00000000-0000-0000-0000-000000000005") {
+		t.Errorf("want IOU account to be loaded, got %v", got.Budgets[0].IouAccountId)
+	}
+
+	_, err = LoadConfig(strings.NewReader(s + `splitCategoryId: "00000000-0000-0000-0000-000000000002"` + "\n"))
+	if err == nil {
+		t.Fatalf("wanted error with both splitCategoryId and iouAccountId, got nil")
+	}
+}
+
+func TestLoadConfigSplitCategoryTarget(t *testing.T) {
+	s := `---
+ynabToken: "my-fake-token"
+budgetId: "00000000-0000-0000-0000-000000000001"
+splitCategoryId: "00000000-0000-0000-0000-000000000002"
+flags:
+  - color: "orange"
+splitCategoryTarget:
+  amount: 1000
+  threshold: 250.50
+`
+
+	got, err := LoadConfig(strings.NewReader(s))
+	if err != nil {
+		t.Fatalf("wanted nil error, got %v", err)
+	}
+	target := got.Budgets[0].SplitCategoryTarget
+	if target == nil || target.Amount != 1_000_000 || target.Threshold == nil || *target.Threshold != 250_500 {
+		t.Errorf("want target of 1000 with threshold 250.50, got %+v", target)
+	}
+
+	_, err = LoadConfig(strings.NewReader(strings.Replace(s, "threshold: 250.50", "threshold: 2000", 1)))
+	if err == nil {
+		t.Errorf("wanted error with threshold above amount, got nil")
+	}
+
+	_, err = LoadConfig(strings.NewReader(strings.Replace(s, "amount: 1000", "amount: lots", 1)))
+	if err == nil {
+		t.Errorf("wanted error with invalid amount, got nil")
+	}
+}
+
+func TestLoadConfigAlerts(t *testing.T) {
+	s := `---
+ynabToken: "my-fake-token"
+budgetId: "00000000-0000-0000-0000-000000000001"
+splitCategoryId: "00000000-0000-0000-0000-000000000002"
+flags:
+  - color: "orange"
+alerts:
+  splitCategoryBalanceBelow: 50
+  monthlySplitAbove: 1500.25
+`
+
+	got, err := LoadConfig(strings.NewReader(s))
+	if err != nil {
+		t.Fatalf("wanted nil error, got %v", err)
+	}
+	alerts := got.Budgets[0].Alerts
+	if alerts == nil ||
+		alerts.SplitCategoryBalanceBelow == nil || *alerts.SplitCategoryBalanceBelow != 50_000 ||
+		alerts.MonthlySplitAbove == nil || *alerts.MonthlySplitAbove != 1_500_250 {
+		t.Errorf("want alerts below 50 and above 1500.25, got %+v", alerts)
+	}
+
+	_, err = LoadConfig(strings.NewReader(strings.Replace(s, "monthlySplitAbove: 1500.25", "monthlySplitAbove: 0", 1)))
+	if err == nil {
+		t.Errorf("wanted error with zero monthly threshold, got nil")
+	}
+
+	iou := strings.Replace(s, "splitCategoryId:", "iouAccountId:", 1)
+	_, err = LoadConfig(strings.NewReader(iou))
+	if err == nil {
+		t.Errorf("wanted error with balance alert and IOU account, got nil")
+	}
+}
+
+func TestLoadConfigNotifications(t *testing.T) {
+	s := `---
+ynabToken: "my-fake-token"
+budgetId: "00000000-0000-0000-0000-000000000001"
+splitCategoryId: "00000000-0000-0000-0000-000000000002"
+flags:
+  - color: "orange"
+notifications:
+  - type: "ntfy"
+    url: "https://ntfy.sh/my-topic"
+  - type: "email"
+    email:
+      host: "smtp.example.com"
+      port: 587
+      from: "split-ynab@example.com"
+      to: ["me@example.com"]
+    events: ["splits", "errors"]
+`
+
+	got, err := LoadConfig(strings.NewReader(s))
+	if err != nil {
+		t.Fatalf("wanted nil error, got %v", err)
+	}
+	if diff := cmp.Diff([]notify.Event{notify.EventError}, got.Notifications[0].Events); diff != "" {
+		t.Errorf("want events to default to errors only. Diff (-want +got):\n%s", diff)
+	}
+
+	_, err = LoadConfig(strings.NewReader(strings.Replace(s, `port: 587`, `port: 0`, 1)))
+	if err == nil {
+		t.Errorf("wanted error with missing email port, got nil")
+	}
+
+	_, err = LoadConfig(strings.NewReader(strings.Replace(s, `"splits", "errors"`, `"everything"`, 1)))
+	if err == nil {
+		t.Errorf("wanted error with invalid event, got nil")
+	}
+}
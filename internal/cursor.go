@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+)
+
+// cursor tracks where incremental runs left off for some set of transactions, either a whole budget or one account.
+type cursor struct {
+	name string
+	// Returns the stored server knowledge, or storage.ErrNotFound
+	get func(ctx context.Context) (int64, error)
+	set func(ctx context.Context, serverKnowledge int64) error
+	// Fetches transactions changed since serverKnowledge, or dated on or after since if serverKnowledge is 0. Returns
+	// the transactions and the new server knowledge.
+	fetch func(ctx context.Context, serverKnowledge int64, since time.Time) ([]ynab.TransactionDetail, int64, error)
+}
+
+// needsBudgetWideFetch reports whether any rule can match transactions outside the configured accounts, in which case
+// the whole budget must be fetched on each run.
+func (budget *BudgetConfig) needsBudgetWideFetch() bool {
+	if len(budget.Flags) > 0 {
+		return true
+	}
+	// Repayments can arrive in any account unless every settlement rule names one which is fetched anyway
+	for _, rule := range budget.Settlements {
+		if !slices.ContainsFunc(budget.Accounts, func(a accountConfig) bool { return a.Id == rule.AccountId }) {
+			return true
+		}
+	}
+	return false
+}
+
+// newCursors returns the cursors which together cover every transaction the configured rules can match. If only
+// account rules are configured, each account is fetched on its own so large budgets don't need to be scanned.
+func newCursors(budget *BudgetConfig, storageAdapter storage.StorageAdapter, client ynabClient) []cursor {
+	if budget.needsBudgetWideFetch() {
+		return []cursor{newBudgetCursor(budget.BudgetId, storageAdapter, client)}
+	}
+
+	cursors := make([]cursor, len(budget.Accounts))
+	for i, acct := range budget.Accounts {
+		cursors[i] = newAccountCursor(budget.BudgetId, acct.Id, storageAdapter, client)
+	}
+	return cursors
+}
+
+func newBudgetCursor(budgetId uuid.UUID, storageAdapter storage.StorageAdapter, client ynabClient) cursor {
+	return cursor{
+		name: "budget",
+		get: func(ctx context.Context) (int64, error) {
+			return storageAdapter.GetLastServerKnowledge(ctx, budgetId)
+		},
+		set: func(ctx context.Context, serverKnowledge int64) error {
+			return storageAdapter.SetLastServerKnowledge(ctx, budgetId, serverKnowledge)
+		},
+		fetch: func(ctx context.Context, serverKnowledge int64, since time.Time) ([]ynab.TransactionDetail, int64, error) {
+			resp, err := client.FetchTransactions(ctx, budgetId, serverKnowledge, since)
+			if err != nil {
+				return nil, 0, err
+			}
+			return resp.JSON200.Data.Transactions, resp.JSON200.Data.ServerKnowledge, nil
+		},
+	}
+}
+
+func newAccountCursor(
+	budgetId uuid.UUID,
+	accountId uuid.UUID,
+	storageAdapter storage.StorageAdapter,
+	client ynabClient,
+) cursor {
+	return cursor{
+		name: fmt.Sprintf("account:%v", accountId),
+		get: func(ctx context.Context) (int64, error) {
+			serverKnowledge, err := storageAdapter.GetAccountServerKnowledge(ctx, budgetId, accountId)
+			if !errors.Is(err, storage.ErrNotFound) {
+				return serverKnowledge, err
+			}
+			// Server knowledge is shared by the whole budget, so if an earlier run fetched the whole budget, continue
+			// from where it left off rather than starting over
+			serverKnowledge, err = storageAdapter.GetLastServerKnowledge(ctx, budgetId)
+			if err == nil && serverKnowledge == 0 {
+				// A server knowledge of 0 means the budget-wide cursor was never advanced
+				return 0, storage.ErrNotFound
+			}
+			return serverKnowledge, err
+		},
+		set: func(ctx context.Context, serverKnowledge int64) error {
+			return storageAdapter.SetAccountServerKnowledge(ctx, budgetId, accountId, serverKnowledge)
+		},
+		fetch: func(ctx context.Context, serverKnowledge int64, since time.Time) ([]ynab.TransactionDetail, int64, error) {
+			resp, err := client.FetchAccountTransactions(ctx, budgetId, accountId, serverKnowledge, since)
+			if err != nil {
+				return nil, 0, err
+			}
+			return resp.JSON200.Data.Transactions, resp.JSON200.Data.ServerKnowledge, nil
+		},
+	}
+}
@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+)
+
+func TestNewCursors(t *testing.T) {
+	acctId1 := uuid.New()
+	acctId2 := uuid.New()
+	fifty := 50
+
+	accountsOnly := BudgetConfig{
+		BudgetId: uuid.New(),
+		Accounts: []accountConfig{
+			{Id: acctId1, DefaultPercentTheirShare: &fifty},
+			{Id: acctId2, DefaultPercentTheirShare: &fifty},
+		},
+	}
+
+	withFlags := accountsOnly
+	withFlags.Flags = []flagConfig{
+		{Color: ynab.TransactionFlagColorBlue, PercentTheirShare: &fifty},
+	}
+
+	settledInAccount := accountsOnly
+	settledInAccount.Settlements = []settlementRule{{Payee: "Venmo", AccountId: acctId1}}
+
+	settledAnywhere := accountsOnly
+	settledAnywhere.Settlements = []settlementRule{
+		{Payee: "Venmo", AccountId: acctId1},
+		{Payee: "Zelle"},
+	}
+
+	settledElsewhere := accountsOnly
+	settledElsewhere.Settlements = []settlementRule{{Payee: "Venmo", AccountId: uuid.New()}}
+
+	names := func(budget *BudgetConfig) []string {
+		cursors := newCursors(budget, nil, nil)
+		got := make([]string, len(cursors))
+		for i, c := range cursors {
+			got[i] = c.name
+		}
+		return got
+	}
+
+	want := []string{"account:" + acctId1.String(), "account:" + acctId2.String()}
+	if diff := cmp.Diff(want, names(&accountsOnly)); diff != "" {
+		t.Errorf("want one cursor per account with only account rules. Diff (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]string{"budget"}, names(&withFlags)); diff != "" {
+		t.Errorf("want a single budget-wide cursor with flag rules. Diff (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(want, names(&settledInAccount)); diff != "" {
+		t.Errorf("want one cursor per account with settlements only in configured accounts. Diff (-want +got):\n%s", diff)
+	}
+	for name, budget := range map[string]*BudgetConfig{
+		"any account":     &settledAnywhere,
+		"another account": &settledElsewhere,
+	} {
+		if diff := cmp.Diff([]string{"budget"}, names(budget)); diff != "" {
+			t.Errorf("want a single budget-wide cursor with settlements in %v. Diff (-want +got):\n%s", name, diff)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package internal
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/samshadwell/split-ynab/internal/notify"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"go.uber.org/zap"
+)
+
+// The most run records read when building a digest. Runs every 10 minutes for a few budgets still fit in a week.
+const digestRunLimit = 10000
+
+// The number of payees listed in a digest.
+const digestTopPayees = 5
+
+// DigestPeriods are the windows a digest can cover, by name.
+var DigestPeriods = map[string]time.Duration{
+	"daily":  24 * time.Hour,
+	"weekly": 7 * 24 * time.Hour,
+}
+
+// Digest summarizes every run in a window of time. Amounts are in YNAB milliunits, and are positive for spending and
+// for what they owe.
+type Digest struct {
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+	Runs  int       `json:"runs"`
+	// Runs which ended in an error
+	FailedRuns int `json:"failedRuns"`
+	// Transactions which were split
+	Split int `json:"split"`
+	// Transactions which couldn't be split
+	FailedTransactions int `json:"failedTransactions"`
+	// The total of every transaction split
+	TotalSplit int64 `json:"totalSplit"`
+	// Their share of every transaction split
+	TheirShare int64 `json:"theirShare"`
+	// The payees with the largest total shares, largest first
+	TopPayees []DigestPayee `json:"topPayees"`
+	// Runs which ended in an error, oldest first
+	Failures []DigestFailure `json:"failures"`
+}
+
+// DigestPayee is the total of the transactions split for a single payee.
+type DigestPayee struct {
+	Payee      string `json:"payee"`
+	Count      int    `json:"count"`
+	TheirShare int64  `json:"theirShare"`
+}
+
+// DigestFailure is a single run which ended in an error.
+type DigestFailure struct {
+	RunId     uuid.UUID `json:"runId"`
+	Budget    string    `json:"budget"`
+	StartedAt time.Time `json:"startedAt"`
+	Error     string    `json:"error"`
+}
+
+// BuildDigest summarizes the stored records of runs which started between since and until, across every configured
+// budget.
+func BuildDigest(
+	ctx context.Context,
+	cfg *Config,
+	storageAdapter storage.StorageAdapter,
+	since time.Time,
+	until time.Time,
+) (*Digest, error) {
+	records, err := storageAdapter.ListRunRecords(ctx, digestRunLimit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list run records")
+	}
+	return newDigest(cfg.Budgets, records, since, until), nil
+}
+
+// newDigest summarizes records, which are newest first, that started between since and until.
+func newDigest(budgets []BudgetConfig, records []storage.RunRecord, since time.Time, until time.Time) *Digest {
+	d := &Digest{
+		Since:     since,
+		Until:     until,
+		TopPayees: make([]DigestPayee, 0),
+		Failures:  make([]DigestFailure, 0),
+	}
+
+	budgetNames := make(map[uuid.UUID]string, len(budgets))
+	for i := range budgets {
+		budgetNames[budgets[i].BudgetId] = budgets[i].displayName()
+	}
+
+	payees := make(map[string]*DigestPayee)
+	for _, r := range records {
+		if r.StartedAt.Before(since) {
+			break
+		}
+		if r.StartedAt.After(until) {
+			continue
+		}
+
+		d.Runs++
+		if r.Error != "" {
+			d.FailedRuns++
+			name, ok := budgetNames[r.BudgetId]
+			if !ok {
+				name = r.BudgetId.String()
+			}
+			d.Failures = append(d.Failures, DigestFailure{
+				RunId:     r.RunId,
+				Budget:    name,
+				StartedAt: r.StartedAt,
+				Error:     r.Error,
+			})
+		}
+
+		for _, t := range r.Transactions {
+			switch TransactionStatus(t.Status) {
+			case TransactionStatusSplit, TransactionStatusUnverified:
+			case TransactionStatusFailed:
+				d.FailedTransactions++
+				continue
+			default:
+				continue
+			}
+
+			d.Split++
+			d.TotalSplit += -t.Amount
+			d.TheirShare += -t.TheirShare
+
+			payee, ok := payees[t.PayeeName]
+			if !ok {
+				payee = &DigestPayee{Payee: t.PayeeName}
+				payees[t.PayeeName] = payee
+			}
+			payee.Count++
+			payee.TheirShare += -t.TheirShare
+		}
+	}
+
+	for _, p := range payees {
+		d.TopPayees = append(d.TopPayees, *p)
+	}
+	slices.SortFunc(d.TopPayees, func(a, b DigestPayee) int {
+		return cmp.Or(cmp.Compare(b.TheirShare, a.TheirShare), cmp.Compare(a.Payee, b.Payee))
+	})
+	if len(d.TopPayees) > digestTopPayees {
+		d.TopPayees = d.TopPayees[:digestTopPayees]
+	}
+	slices.Reverse(d.Failures)
+
+	return d
+}
+
+// WriteText writes a human-readable summary of the digest to w.
+func (d *Digest) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Since:\t%v\n", d.Since.Format(time.RFC3339))
+	fmt.Fprintf(tw, "Until:\t%v\n", d.Until.Format(time.RFC3339))
+	fmt.Fprintf(tw, "Runs:\t%d (%d failed)\n", d.Runs, d.FailedRuns)
+	fmt.Fprintf(tw, "Split:\t%d (%d failed)\n", d.Split, d.FailedTransactions)
+	fmt.Fprintf(tw, "Total split:\t%v\n", formatMilliunits(d.TotalSplit))
+	fmt.Fprintf(tw, "Their share:\t%v\n", formatMilliunits(d.TheirShare))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(d.TopPayees) > 0 {
+		fmt.Fprintln(w)
+		tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "PAYEE\tCOUNT\tTHEIR SHARE")
+		for _, p := range d.TopPayees {
+			fmt.Fprintf(tw, "%v\t%d\t%v\n", p.Payee, p.Count, formatMilliunits(p.TheirShare))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(d.Failures) > 0 {
+		fmt.Fprintln(w)
+		tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "STARTED\tBUDGET\tRUN\tERROR")
+		for _, f := range d.Failures {
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", f.StartedAt.Format(time.RFC3339), f.Budget, f.RunId, f.Error)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendDigest sends the digest to each configured notification which wants digests. Each period's digest is only sent
+// once, so scheduling it more often than the period, or retrying it, doesn't send duplicates. It reports whether the
+// digest was sent.
+func SendDigest(
+	ctx context.Context,
+	logger *zap.Logger,
+	cfg *Config,
+	storageAdapter storage.StorageAdapter,
+	period string,
+	d *Digest,
+) (bool, error) {
+	return sendDigest(ctx, logger, cfg.notificationTargets(), storageAdapter, period, d)
+}
+
+func sendDigest(
+	ctx context.Context,
+	logger *zap.Logger,
+	targets []notificationTarget,
+	storageAdapter storage.StorageAdapter,
+	period string,
+	d *Digest,
+) (bool, error) {
+	duration, ok := DigestPeriods[period]
+	if !ok {
+		return false, errors.Errorf("unknown digest period %q", period)
+	}
+
+	digestTargets := make([]notificationTarget, 0, len(targets))
+	for _, t := range targets {
+		if slices.Contains(t.events, notify.EventDigest) {
+			digestTargets = append(digestTargets, t)
+		}
+	}
+	if len(digestTargets) == 0 {
+		return false, errors.New("no notifications are configured with the `digest` event")
+	}
+
+	marker := digestMarker(period, d.Until)
+	claimed, err := storageAdapter.ClaimMarker(ctx, marker, 2*duration)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to check whether digest was already sent")
+	}
+	if !claimed {
+		logger.Info("digest was already sent", zap.String("marker", marker))
+		return false, nil
+	}
+
+	message := digestMessage(period, d)
+	sent := 0
+	for _, target := range digestTargets {
+		if err := target.notifier.Notify(ctx, message); err != nil {
+			logger.Warn("failed to send digest", zap.Error(err))
+			continue
+		}
+		sent++
+	}
+
+	if sent == 0 {
+		// Let a retry send it
+		if err := storageAdapter.DeleteMarker(ctx, marker); err != nil {
+			logger.Warn("failed to delete digest marker", zap.String("marker", marker), zap.Error(err))
+		}
+		return false, errors.New("failed to send digest to any notification")
+	}
+	return true, nil
+}
+
+// digestMarker names the marker recording that the digest for the period ending at until was sent. Daily digests are
+// identified by their day, and weekly ones by their ISO week.
+func digestMarker(period string, until time.Time) string {
+	if period == "weekly" {
+		year, week := until.ISOWeek()
+		return fmt.Sprintf("DIGEST#weekly#%d-W%02d", year, week)
+	}
+	return fmt.Sprintf("DIGEST#%v#%v", period, until.Format(time.DateOnly))
+}
+
+func digestMessage(period string, d *Digest) notify.Message {
+	var text strings.Builder
+	// Writing to a strings.Builder can't fail
+	_ = d.WriteText(&text)
+
+	return notify.Message{
+		Event: notify.EventDigest,
+		Title: fmt.Sprintf("split-ynab %v digest: split %d transactions, %v their share",
+			period, d.Split, formatMilliunits(d.TheirShare)),
+		Text: text.String(),
+		Data: d,
+	}
+}
@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	"github.com/samshadwell/split-ynab/internal/notify"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"go.uber.org/zap"
+)
+
+func TestNewDigest(t *testing.T) {
+	budgetId := uuid.New()
+	failedRunId := uuid.New()
+	until := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	since := until.Add(-24 * time.Hour)
+	budgets := []BudgetConfig{{BudgetId: budgetId, Name: "Household"}}
+
+	split := func(payee string, amount int64, status TransactionStatus) storage.TransactionRecord {
+		return storage.TransactionRecord{PayeeName: payee, Amount: amount, TheirShare: amount / 2, Status: string(status)}
+	}
+	// Newest first, as listed by storage
+	records := []storage.RunRecord{
+		{
+			BudgetId:  budgetId,
+			StartedAt: until.Add(time.Minute),
+			Transactions: []storage.TransactionRecord{
+				split("Too late", -100000, TransactionStatusSplit),
+			},
+		},
+		{
+			BudgetId:  budgetId,
+			StartedAt: until.Add(-time.Hour),
+			Transactions: []storage.TransactionRecord{
+				split("Grocer", -40000, TransactionStatusSplit),
+				split("Cafe", -10000, TransactionStatusUnverified),
+				split("Broken", -20000, TransactionStatusFailed),
+				split("Settled", 30000, TransactionStatusSettled),
+			},
+		},
+		{
+			RunId:     failedRunId,
+			BudgetId:  budgetId,
+			StartedAt: until.Add(-2 * time.Hour),
+			Error:     "boom",
+			Transactions: []storage.TransactionRecord{
+				split("Grocer", -20000, TransactionStatusSplit),
+			},
+		},
+		{
+			BudgetId:  budgetId,
+			StartedAt: since.Add(-time.Minute),
+			Transactions: []storage.TransactionRecord{
+				split("Too early", -100000, TransactionStatusSplit),
+			},
+		},
+	}
+
+	want := &Digest{
+		Since:              since,
+		Until:              until,
+		Runs:               2,
+		FailedRuns:         1,
+		Split:              3,
+		FailedTransactions: 1,
+		TotalSplit:         70000,
+		TheirShare:         35000,
+		TopPayees: []DigestPayee{
+			{Payee: "Grocer", Count: 2, TheirShare: 30000},
+			{Payee: "Cafe", Count: 1, TheirShare: 5000},
+		},
+		Failures: []DigestFailure{
+			{RunId: failedRunId, Budget: "Household", StartedAt: until.Add(-2 * time.Hour), Error: "boom"},
+		},
+	}
+	got := newDigest(budgets, records, since, until)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("digest mismatch (-want +got):\n%v", diff)
+	}
+
+	var text strings.Builder
+	if err := got.WriteText(&text); err != nil {
+		t.Fatalf("want nil error writing text, got %v", err)
+	}
+	for _, s := range []string{"Runs:", "2 (1 failed)", "35.00", "Grocer", "boom"} {
+		if !strings.Contains(text.String(), s) {
+			t.Errorf("want text to contain %q, got:\n%v", s, text.String())
+		}
+	}
+}
+
+func TestSendDigest(t *testing.T) {
+	t.Chdir(t.TempDir())
+	ctx := context.Background()
+	storageAdapter := storage.NewLocalStorageAdapter()
+	until := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	d := &Digest{Since: until.Add(-24 * time.Hour), Until: until, Split: 2}
+
+	failing := &fakeNotifier{err: errors.New("unreachable")}
+	targets := []notificationTarget{{notifier: failing, events: []notify.Event{notify.EventDigest}}}
+	if sent, err := sendDigest(ctx, zap.NewNop(), targets, storageAdapter, "daily", d); sent || err == nil {
+		t.Fatalf("want error when no notification succeeds, got %v, %v", sent, err)
+	}
+
+	digests := &fakeNotifier{}
+	errorsOnly := &fakeNotifier{}
+	targets = []notificationTarget{
+		{notifier: digests, events: []notify.Event{notify.EventDigest}},
+		{notifier: errorsOnly, events: []notify.Event{notify.EventError}},
+	}
+	if sent, err := sendDigest(ctx, zap.NewNop(), targets, storageAdapter, "daily", d); !sent || err != nil {
+		t.Fatalf("want digest sent after failed attempt, got %v, %v", sent, err)
+	}
+	if len(digests.messages) != 1 || digests.messages[0].Event != notify.EventDigest {
+		t.Errorf("want one digest message, got %+v", digests.messages)
+	}
+	if len(errorsOnly.messages) != 0 {
+		t.Errorf("want no digest for target without the digest event, got %d", len(errorsOnly.messages))
+	}
+
+	later := &Digest{Since: d.Since.Add(time.Hour), Until: until.Add(time.Hour)}
+	if sent, err := sendDigest(ctx, zap.NewNop(), targets, storageAdapter, "daily", later); sent || err != nil {
+		t.Fatalf("want digest for the same day not sent again, got %v, %v", sent, err)
+	}
+	if sent, err := sendDigest(ctx, zap.NewNop(), targets, storageAdapter, "weekly", later); !sent || err != nil {
+		t.Fatalf("want weekly digest sent, got %v, %v", sent, err)
+	}
+}
@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+	"go.uber.org/zap"
+)
+
+// DryRun reports which of the given budget's transactions Run would split, or Backfill would if backfill is set,
+// without changing anything in YNAB or storage. Those transactions are reported with TransactionStatusWouldSplit.
+// Repayments, mirroring, funding, and alerts aren't previewed, and the result isn't stored.
+func DryRun(
+	ctx context.Context,
+	logger *zap.Logger,
+	cfg *Config,
+	budget *BudgetConfig,
+	storageAdapter storage.StorageAdapter,
+	backfill *BackfillOptions,
+) (*RunResult, error) {
+	kind := RunKindIncremental
+	if backfill != nil {
+		kind = RunKindBackfill
+	}
+	result := newRunResult(budget.BudgetId, kind)
+	result.DryRun = true
+	logger = logger.With(
+		zap.String("budget", budget.displayName()),
+		zap.String("runId", result.RunId.String()),
+		zap.String("kind", string(kind)),
+		zap.Bool("dryRun", true),
+	)
+
+	err := dryRun(ctx, logger, cfg, budget, storageAdapter, backfill, result)
+	result.finish(err)
+	return result, err
+}
+
+func dryRun(
+	ctx context.Context,
+	logger *zap.Logger,
+	cfg *Config,
+	budget *BudgetConfig,
+	storageAdapter storage.StorageAdapter,
+	backfill *BackfillOptions,
+	result *RunResult,
+) error {
+	client, err := ynab.NewYnabAdapter(logger, budget.YnabToken)
+	if err != nil {
+		return errors.Wrap(err, "failed to construct client")
+	}
+	theirLine, err := theirShareLine(ctx, client, budget)
+	if err != nil {
+		return err
+	}
+
+	var transactions []ynab.TransactionDetail
+	if backfill != nil {
+		transactions, err = fetchBackfillTransactions(ctx, client, budget.BudgetId, *backfill)
+		if err != nil {
+			return errors.Wrap(err, "failed to fetch transactions from YNAB")
+		}
+	} else {
+		for _, c := range newCursors(budget, storageAdapter, client) {
+			serverKnowledge, err := c.get(ctx)
+			firstRun := errors.Is(err, storage.ErrNotFound)
+			if err != nil && !firstRun {
+				logger.Warn("failed to get last server knowledge", zap.String("cursor", c.name), zap.Error(err))
+			}
+			result.ServerKnowledgeBefore = max(result.ServerKnowledgeBefore, serverKnowledge)
+			result.ServerKnowledgeAfter = max(result.ServerKnowledgeAfter, serverKnowledge)
+			if firstRun && cfg.FirstRun == FirstRunRecordOnly {
+				// The first real run wouldn't split anything
+				continue
+			}
+
+			fetched, _, err := c.fetch(ctx, serverKnowledge, cfg.initialSinceDate(time.Now()))
+			if err != nil {
+				return errors.Wrap(err, "failed to fetch transactions from YNAB")
+			}
+			transactions = append(transactions, fetched...)
+		}
+	}
+
+	planSplits(result, transactions, budget, theirLine)
+	logger.Info("dry run complete", zap.Int("wouldSplit", result.Split))
+	return nil
+}
+
+// planSplits records in result each of transactions which would be split, as processTransactions would.
+func planSplits(
+	result *RunResult,
+	transactions []ynab.TransactionDetail,
+	budget *BudgetConfig,
+	theirLine ynab.SaveSubTransaction,
+) {
+	settlementIds := make(map[string]bool)
+	for _, t := range settlementCandidates(transactions, budget) {
+		settlementIds[t.Id] = true
+	}
+	splittable := slices.DeleteFunc(slices.Clone(transactions), func(t ynab.TransactionDetail) bool {
+		return settlementIds[t.Id]
+	})
+
+	filteredTransactions := filterTransactions(splittable, budget)
+	result.Fetched += len(transactions)
+	result.Matched += len(filteredTransactions)
+	result.Skipped += len(transactions) - len(filteredTransactions)
+
+	updatedTransactions := splitTransactions(filteredTransactions, theirLine)
+	for i := range filteredTransactions {
+		result.addOutcome(filteredTransactions[i], updatedTransactions[i], TransactionStatusWouldSplit, nil, nil)
+	}
+}
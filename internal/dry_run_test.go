@@ -0,0 +1,39 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+)
+
+func TestPlanSplits(t *testing.T) {
+	accountId := uuid.New()
+	categoryId := uuid.New()
+	splitCategoryId := uuid.New()
+	fifty := 50
+	budget := &BudgetConfig{
+		SplitCategoryId: splitCategoryId,
+		Accounts:        []accountConfig{{Id: accountId, DefaultPercentTheirShare: &fifty}},
+	}
+	payee := "Grocer"
+	transactions := []ynab.TransactionDetail{
+		{Id: "split-me", AccountId: accountId, Amount: -10_000, CategoryId: &categoryId, PayeeName: &payee},
+		{Id: "other-account", AccountId: uuid.New(), Amount: -10_000, CategoryId: &categoryId},
+	}
+
+	result := newRunResult(uuid.New(), RunKindIncremental)
+	planSplits(result, transactions, budget, ynab.SaveSubTransaction{CategoryId: &splitCategoryId})
+
+	if result.Fetched != 2 || result.Matched != 1 || result.Skipped != 1 || result.Split != 1 || result.Failed != 0 {
+		t.Errorf("want 2 fetched, 1 matched, 1 skipped, 1 split, got %+v", result)
+	}
+	if len(result.Transactions) != 1 {
+		t.Fatalf("want 1 transaction outcome, got %d", len(result.Transactions))
+	}
+	got := result.Transactions[0]
+	if got.TransactionId != "split-me" || got.Status != TransactionStatusWouldSplit || got.TheirShare != -5_000 ||
+		got.PayeeName != payee {
+		t.Errorf("want would-split outcome with their share of -5000, got %+v", got)
+	}
+}
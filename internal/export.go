@@ -0,0 +1,246 @@
+package internal
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+	"go.uber.org/zap"
+)
+
+type ExportOptions struct {
+	// If set, only transactions dated on or after Since are exported
+	Since time.Time
+	// If set, only transactions dated on or before Until are exported
+	Until time.Time
+	// If set, only transactions in these accounts are exported. Each may be an account ID or name
+	Accounts []string
+	// Also export split transactions found in the budget which aren't in the ledger, e.g. those split by hand or before
+	// the ledger existed. Requires Since
+	IncludeBudget bool
+}
+
+// ExportRow describes a single split transaction. Amounts are in YNAB milliunits.
+type ExportRow struct {
+	TransactionId string    `json:"transactionId"`
+	Date          string    `json:"date"`
+	AccountId     uuid.UUID `json:"accountId"`
+	AccountName   string    `json:"accountName"`
+	PayeeName     string    `json:"payeeName"`
+	// The category the transaction was in before it was split, which holds our share
+	CategoryName string    `json:"categoryName"`
+	Amount       int64     `json:"amount"`
+	OurShare     int64     `json:"ourShare"`
+	TheirShare   int64     `json:"theirShare"`
+	Rule         string    `json:"rule"`
+	RunId        uuid.UUID `json:"runId"`
+}
+
+var exportCsvHeader = []string{
+	"transaction_id",
+	"date",
+	"account_id",
+	"account",
+	"payee",
+	"category",
+	"amount",
+	"our_share",
+	"their_share",
+	"rule",
+	"run_id",
+}
+
+// Export returns every split transaction in the given budget's ledger, and in the budget itself if
+// opts.IncludeBudget is set, which matches opts, oldest first.
+func Export(
+	ctx context.Context,
+	logger *zap.Logger,
+	budget *BudgetConfig,
+	storageAdapter storage.StorageAdapter,
+	opts ExportOptions,
+) ([]ExportRow, error) {
+	splits, err := storageAdapter.ListSplitRecords(ctx, budget.BudgetId)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read split transactions from ledger")
+	}
+
+	if opts.IncludeBudget {
+		if opts.Since.IsZero() {
+			return nil, errors.New("a start date is required to export split transactions from the budget")
+		}
+		client, err := ynab.NewYnabAdapter(logger, budget.YnabToken)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to construct client")
+		}
+		resp, err := client.FetchTransactions(ctx, budget.BudgetId, 0, opts.Since)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to fetch transactions from YNAB")
+		}
+		splits = mergeBudgetSplits(splits, resp.JSON200.Data.Transactions, budget)
+	}
+
+	return exportRows(splits, opts), nil
+}
+
+// mergeBudgetSplits adds the split transactions in transactions which aren't already in the ledger splits, and
+// returns them all, oldest first. Transactions only found in the budget have no rule or run.
+func mergeBudgetSplits(
+	splits []storage.SplitRecord,
+	transactions []ynab.TransactionDetail,
+	budget *BudgetConfig,
+) []storage.SplitRecord {
+	merged := slices.Clone(splits)
+	inLedger := make(map[string]bool, len(splits))
+	for _, s := range splits {
+		inLedger[s.TransactionId] = true
+	}
+
+	for _, t := range transactions {
+		if t.Deleted || inLedger[t.Id] {
+			continue
+		}
+
+		record := storage.SplitRecord{
+			TransactionId: t.Id,
+			Date:          t.Date.String(),
+			AccountId:     t.AccountId,
+			AccountName:   t.AccountName,
+			Amount:        t.Amount,
+		}
+		isSplit := false
+		for _, sub := range t.Subtransactions {
+			if sub.Deleted {
+				continue
+			}
+			if budget.isTheirShare(sub) {
+				record.TheirShare += sub.Amount
+				isSplit = true
+			} else if record.CategoryName == "" && sub.CategoryName != nil {
+				record.CategoryName = *sub.CategoryName
+			}
+		}
+		if !isSplit {
+			continue
+		}
+		if t.PayeeName != nil {
+			record.PayeeName = *t.PayeeName
+		}
+		merged = append(merged, record)
+	}
+
+	slices.SortStableFunc(merged, func(a, b storage.SplitRecord) int {
+		return cmp.Compare(a.Date, b.Date)
+	})
+	return merged
+}
+
+func exportRows(splits []storage.SplitRecord, opts ExportOptions) []ExportRow {
+	since, until := "", ""
+	if !opts.Since.IsZero() {
+		since = opts.Since.Format(time.DateOnly)
+	}
+	if !opts.Until.IsZero() {
+		until = opts.Until.Format(time.DateOnly)
+	}
+
+	rows := make([]ExportRow, 0, len(splits))
+	for _, s := range splits {
+		if (since != "" && s.Date < since) || (until != "" && s.Date > until) {
+			continue
+		}
+		if len(opts.Accounts) > 0 && !matchesAccount(s, opts.Accounts) {
+			continue
+		}
+
+		rows = append(rows, ExportRow{
+			TransactionId: s.TransactionId,
+			Date:          s.Date,
+			AccountId:     s.AccountId,
+			AccountName:   s.AccountName,
+			PayeeName:     s.PayeeName,
+			CategoryName:  s.CategoryName,
+			Amount:        s.Amount,
+			OurShare:      s.Amount - s.TheirShare,
+			TheirShare:    s.TheirShare,
+			Rule:          s.Rule,
+			RunId:         s.RunId,
+		})
+	}
+	return rows
+}
+
+func matchesAccount(s storage.SplitRecord, accounts []string) bool {
+	for _, a := range accounts {
+		if a == s.AccountName || (s.AccountId != uuid.Nil && a == s.AccountId.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteCSV writes rows to w as CSV with a header row. Amounts are written as decimal currency amounts.
+func WriteCSV(w io.Writer, rows []ExportRow) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(exportCsvHeader); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		err := cw.Write([]string{
+			r.TransactionId,
+			r.Date,
+			uuidOrEmpty(r.AccountId),
+			r.AccountName,
+			r.PayeeName,
+			r.CategoryName,
+			formatMilliunitsExact(r.Amount),
+			formatMilliunitsExact(r.OurShare),
+			formatMilliunitsExact(r.TheirShare),
+			r.Rule,
+			uuidOrEmpty(r.RunId),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSONLines writes rows to w as JSON, one row per line. Amounts are written in milliunits.
+func WriteJSONLines(w io.Writer, rows []ExportRow) error {
+	encoder := json.NewEncoder(w)
+	for _, r := range rows {
+		if err := encoder.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uuidOrEmpty formats id, or returns an empty string if it's unset, e.g. for splits recorded before it was tracked.
+func uuidOrEmpty(id uuid.UUID) string {
+	if id == uuid.Nil {
+		return ""
+	}
+	return id.String()
+}
+
+// formatMilliunitsExact formats a YNAB milliunit amount as a decimal currency amount without losing precision, e.g.
+// -10015 becomes "-10.015" and -10010 becomes "-10.010"
+func formatMilliunitsExact(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%03d", sign, amount/1000, amount%1000)
+}
@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	"github.com/oapi-codegen/runtime/types"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+)
+
+func TestExportRows(t *testing.T) {
+	card := uuid.New()
+	runId := uuid.New()
+	splits := []storage.SplitRecord{
+		{TransactionId: "old", Date: "2026-08-31", AccountId: card, AccountName: "Card", Amount: -10_000, TheirShare: -5_000},
+		{TransactionId: "card", Date: "2026-09-01", AccountId: card, AccountName: "Card", Amount: -10_010, TheirShare: -3_000, RunId: runId},
+		{TransactionId: "checking", Date: "2026-09-02", AccountName: "Checking", Amount: -20_000, TheirShare: -10_000},
+		{TransactionId: "late", Date: "2026-10-01", AccountId: card, AccountName: "Card", Amount: -10_000, TheirShare: -5_000},
+	}
+
+	tests := []struct {
+		name string
+		opts ExportOptions
+		want []string
+	}{
+		{"no filters", ExportOptions{}, []string{"old", "card", "checking", "late"}},
+		{"date range", ExportOptions{
+			Since: time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC),
+			Until: time.Date(2026, 9, 30, 0, 0, 0, 0, time.UTC),
+		}, []string{"card", "checking"}},
+		{"account by ID", ExportOptions{Accounts: []string{card.String()}}, []string{"old", "card", "late"}},
+		{"account by name", ExportOptions{Accounts: []string{"Checking"}}, []string{"checking"}},
+	}
+	for _, tt := range tests {
+		rows := exportRows(splits, tt.opts)
+		got := make([]string, len(rows))
+		for i, r := range rows {
+			got[i] = r.TransactionId
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("%v: exported transactions did not match expected. Diff (-want +got):\n%s", tt.name, diff)
+		}
+	}
+
+	rows := exportRows(splits[1:2], ExportOptions{})
+	if rows[0].OurShare != -7_010 {
+		t.Errorf("want our share of -7.010, got %d", rows[0].OurShare)
+	}
+
+	var csv strings.Builder
+	if err := WriteCSV(&csv, rows); err != nil {
+		t.Fatalf("want nil error writing CSV, got %v", err)
+	}
+	wantCsv := "transaction_id,date,account_id,account,payee,category,amount,our_share,their_share,rule,run_id\n" +
+		"card,2026-09-01," + card.String() + ",Card,,,-10.010,-7.010,-3.000,," + runId.String() + "\n"
+	if diff := cmp.Diff(wantCsv, csv.String()); diff != "" {
+		t.Errorf("CSV did not match expected. Diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestMergeBudgetSplits(t *testing.T) {
+	splitCategory := uuid.New()
+	groceries := "Groceries"
+	date := func(s string) types.Date {
+		d, _ := time.Parse(time.DateOnly, s)
+		return types.Date{Time: d}
+	}
+	budget := &BudgetConfig{SplitCategoryId: splitCategory}
+	ledger := []storage.SplitRecord{
+		{TransactionId: "in-ledger", Date: "2026-09-02", Amount: -10_000, TheirShare: -5_000, Rule: "flag:orange"},
+	}
+	transactions := []ynab.TransactionDetail{
+		{Id: "in-ledger", Date: date("2026-09-02"), Amount: -10_000, Subtransactions: []ynab.SubTransaction{
+			{Amount: -5_000, CategoryName: &groceries},
+			{Amount: -5_000, CategoryId: &splitCategory},
+		}},
+		{Id: "by-hand", Date: date("2026-09-01"), Amount: -20_000, Subtransactions: []ynab.SubTransaction{
+			{Amount: -15_000, CategoryName: &groceries},
+			{Amount: -5_000, CategoryId: &splitCategory},
+		}},
+		{Id: "unsplit", Date: date("2026-09-03"), Amount: -20_000, CategoryName: &groceries},
+	}
+
+	got := mergeBudgetSplits(ledger, transactions, budget)
+
+	want := []storage.SplitRecord{
+		{TransactionId: "by-hand", Date: "2026-09-01", CategoryName: "Groceries", Amount: -20_000, TheirShare: -5_000},
+		ledger[0],
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("merged splits did not match expected. Diff (-want +got):\n%s", diff)
+	}
+}
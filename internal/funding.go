@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+	"go.uber.org/zap"
+)
+
+// How long the marker recording a month's first funding is kept. Markers are keyed by month, so this only needs to
+// outlast one.
+const fundingMarkerTtl = 32 * 24 * time.Hour
+
+// fundSplitCategory tops up the amount budgeted to the split category this month, if the budget has a target and the
+// category needs it. The amount moved is recorded in the run's result.
+func (r *budgetRun) fundSplitCategory(ctx context.Context, logger *zap.Logger, now time.Time) error {
+	target := r.budget.SplitCategoryTarget
+	if target == nil {
+		return nil
+	}
+
+	category, err := r.client.GetMonthCategory(ctx, r.budget.BudgetId, now, r.budget.SplitCategoryId)
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch split category")
+	}
+
+	// The first run each month brings the category up to the target. Claiming the marker records that it happened, so
+	// later runs only top up below the threshold, even if nothing is budgeted to the category yet
+	marker := fmt.Sprintf("FUNDED#%v#%v", r.budget.BudgetId, now.Format(monthFormat))
+	firstThisMonth, err := r.storageAdapter.ClaimMarker(ctx, marker, fundingMarkerTtl)
+	if err != nil {
+		// Treat it as funded already, since funding twice would move more than the target
+		logger.Warn("failed to check whether split category was funded this month", zap.Error(err))
+		firstThisMonth = false
+	}
+
+	topUp := target.topUp(category, firstThisMonth)
+	if topUp == 0 {
+		logger.Info("split category does not need funding", zap.Int64("balance", category.Balance))
+		return nil
+	}
+
+	logger.Info("funding split category",
+		zap.Int64("balance", category.Balance),
+		zap.Int64("topUp", topUp),
+		zap.Bool("firstThisMonth", firstThisMonth))
+	_, err = r.client.SetMonthCategoryBudgeted(ctx, r.budget.BudgetId, now, r.budget.SplitCategoryId,
+		category.Budgeted+topUp)
+	if err != nil {
+		if firstThisMonth {
+			// Let the next run try again
+			if err := r.storageAdapter.DeleteMarker(ctx, marker); err != nil {
+				logger.Warn("failed to clear record of this month's funding", zap.Error(err))
+			}
+		}
+		return errors.Wrap(err, "failed to fund split category")
+	}
+	r.result.Funded += topUp
+	return nil
+}
+
+// topUp returns how much to add to the category's budgeted amount this month. The first time each month, the
+// category is brought back up to the target, and otherwise only once its balance falls below the threshold.
+func (t *categoryTarget) topUp(category *ynab.Category, firstThisMonth bool) int64 {
+	belowThreshold := t.Threshold != nil && category.Balance < int64(*t.Threshold)
+	if !firstThisMonth && !belowThreshold {
+		return 0
+	}
+	return max(int64(t.Amount)-category.Balance, 0)
+}
@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+	"go.uber.org/zap"
+)
+
+func TestCategoryTargetTopUp(t *testing.T) {
+	threshold := Milliunits(250_000)
+	withThreshold := &categoryTarget{Amount: 1_000_000, Threshold: &threshold}
+	withoutThreshold := &categoryTarget{Amount: 1_000_000}
+
+	tests := []struct {
+		name           string
+		target         *categoryTarget
+		firstThisMonth bool
+		balance        int64
+		want           int64
+	}{
+		{"first this month", withoutThreshold, true, 400_000, 600_000},
+		{"first this month, already funded", withoutThreshold, true, 1_200_000, 0},
+		{"later, no threshold", withoutThreshold, false, 100_000, 0},
+		{"later, above threshold", withThreshold, false, 300_000, 0},
+		{"later, below threshold", withThreshold, false, 100_000, 900_000},
+		{"later, overspent", withThreshold, false, -50_000, 1_050_000},
+	}
+	for _, tt := range tests {
+		got := tt.target.topUp(&ynab.Category{Balance: tt.balance}, tt.firstThisMonth)
+		if got != tt.want {
+			t.Errorf("%v: want top-up of %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
+
+// fakeFundingClient holds a single category, and fails to budget to it if failBudgeting is set. Other client methods
+// aren't used by these tests.
+type fakeFundingClient struct {
+	ynabClient
+	category      ynab.Category
+	failBudgeting bool
+}
+
+func (f *fakeFundingClient) GetMonthCategory(
+	ctx context.Context,
+	budgetId uuid.UUID,
+	month time.Time,
+	categoryId uuid.UUID,
+) (*ynab.Category, error) {
+	category := f.category
+	return &category, nil
+}
+
+func (f *fakeFundingClient) SetMonthCategoryBudgeted(
+	ctx context.Context,
+	budgetId uuid.UUID,
+	month time.Time,
+	categoryId uuid.UUID,
+	budgeted int64,
+) (*ynab.Category, error) {
+	if f.failBudgeting {
+		return nil, errors.New("rejected")
+	}
+	f.category.Balance += budgeted - f.category.Budgeted
+	f.category.Budgeted = budgeted
+	category := f.category
+	return &category, nil
+}
+
+func TestFundSplitCategoryOncePerMonth(t *testing.T) {
+	t.Chdir(t.TempDir())
+	storageAdapter := storage.NewLocalStorageAdapter()
+	budget := &BudgetConfig{
+		BudgetId:            uuid.New(),
+		SplitCategoryId:     uuid.New(),
+		SplitCategoryTarget: &categoryTarget{Amount: 1_000_000},
+	}
+	// Nothing is budgeted this month, and the balance carried over is below the target
+	client := &fakeFundingClient{category: ynab.Category{Balance: 400_000}}
+	fund := func(now time.Time) (int64, error) {
+		r := &budgetRun{
+			cfg:            &Config{},
+			budget:         budget,
+			storageAdapter: storageAdapter,
+			client:         client,
+			result:         newRunResult(budget.BudgetId, RunKindIncremental),
+		}
+		err := r.fundSplitCategory(context.Background(), zap.NewNop(), now)
+		return r.result.Funded, err
+	}
+	october := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+
+	client.failBudgeting = true
+	if _, err := fund(october); err == nil {
+		t.Errorf("want error when budgeting fails, got nil")
+	}
+	client.failBudgeting = false
+	if got, err := fund(october.Add(time.Hour)); err != nil || got != 600_000 {
+		t.Errorf("want first successful run of the month to fund 600_000, got %d, %v", got, err)
+	}
+
+	// Spending more this month, or budgeting it back to zero by hand, doesn't fund it again until next month
+	client.category = ynab.Category{Budgeted: 0, Balance: 300_000}
+	if got, err := fund(october.Add(2 * time.Hour)); err != nil || got != 0 {
+		t.Errorf("want no more funding this month, got %d, %v", got, err)
+	}
+	if got, err := fund(october.AddDate(0, 1, 0)); err != nil || got != 700_000 {
+		t.Errorf("want first run of next month to fund 700_000, got %d, %v", got, err)
+	}
+}
@@ -0,0 +1,35 @@
+package internal
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+)
+
+// newSplitRecord builds the ledger entry for a transaction split by update during the given run.
+func newSplitRecord(st splitTransaction, update ynab.SaveTransactionWithId, runId uuid.UUID) storage.SplitRecord {
+	t := st.transaction
+	record := storage.SplitRecord{
+		TransactionId: t.Id,
+		Date:          t.Date.String(),
+		AccountId:     t.AccountId,
+		AccountName:   t.AccountName,
+		Amount:        t.Amount,
+		TheirShare:    theirShareOf(update),
+		Rule:          st.rule,
+		RunId:         runId,
+		SplitAt:       time.Now(),
+	}
+	if t.PayeeName != nil {
+		record.PayeeName = *t.PayeeName
+	}
+	if t.CategoryName != nil {
+		record.CategoryName = *t.CategoryName
+	}
+	if t.Memo != nil {
+		record.Memo = *t.Memo
+	}
+	return record
+}
@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Milliunits is an amount of money in YNAB's milliunits, e.g. 1000 is $1. In the config file it's written as a decimal
+// currency amount, e.g. 1000.50, without a currency symbol.
+type Milliunits int64
+
+func (m *Milliunits) UnmarshalYAML(value *yaml.Node) error {
+	parsed, err := parseMilliunits(value.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", value.Line, err)
+	}
+	*m = parsed
+	return nil
+}
+
+// Set parses a decimal currency amount, so a Milliunits can be used as a command-line flag.
+func (m *Milliunits) Set(value string) error {
+	parsed, err := parseMilliunits(value)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+func (m Milliunits) String() string {
+	return formatMilliunits(int64(m))
+}
+
+// parseMilliunits parses a decimal currency amount with at most three decimal places, e.g. "-12.34", as milliunits.
+func parseMilliunits(s string) (Milliunits, error) {
+	invalid := fmt.Errorf("invalid amount %q, must be a number like 1000 or 1000.50", s)
+
+	negative := strings.HasPrefix(s, "-")
+	whole, fraction, _ := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+	if whole == "" || len(fraction) > 3 || strings.HasPrefix(whole, "+") {
+		return 0, invalid
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, invalid
+	}
+	var thousandths int64
+	if fraction != "" {
+		thousandths, err = strconv.ParseInt(fraction+strings.Repeat("0", 3-len(fraction)), 10, 64)
+		if err != nil || thousandths < 0 {
+			return 0, invalid
+		}
+	}
+
+	amount := units*1000 + thousandths
+	if negative {
+		amount = -amount
+	}
+	return Milliunits(amount), nil
+}
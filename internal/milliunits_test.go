@@ -0,0 +1,29 @@
+package internal
+
+import "testing"
+
+func TestParseMilliunits(t *testing.T) {
+	valid := map[string]Milliunits{
+		"1000":    1_000_000,
+		"1000.5":  1_000_500,
+		"1000.50": 1_000_500,
+		"0.001":   1,
+		"-12.34":  -12_340,
+	}
+	for s, want := range valid {
+		got, err := parseMilliunits(s)
+		if err != nil {
+			t.Errorf("want nil error parsing %q, got %v", s, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("want %q to parse as %d, got %d", s, want, got)
+		}
+	}
+
+	for _, s := range []string{"", "abc", "1.2345", "$100", "1,000", ".5", "1.-5"} {
+		if _, err := parseMilliunits(s); err == nil {
+			t.Errorf("want error parsing %q, got nil", s)
+		}
+	}
+}
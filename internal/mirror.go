@@ -0,0 +1,207 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+	"go.uber.org/zap"
+)
+
+// Prefix of the import ID given to mirrored transactions. YNAB limits import IDs to 36 characters.
+const mirrorImportIdPrefix = "SPLIT-YNAB:"
+
+// When looking for existing mirrored transactions, also look this far before the earliest transaction being synced, in
+// case its date was changed since it was mirrored.
+const mirrorLookbackMargin = 31 * 24 * time.Hour
+
+// mirrorClient is the subset of the YNAB adapter's methods used to maintain mirrored transactions in the other
+// person's budget.
+type mirrorClient interface {
+	FetchAccountTransactions(
+		ctx context.Context,
+		budgetId uuid.UUID,
+		accountId uuid.UUID,
+		serverKnowledge int64,
+		since time.Time,
+	) (*ynab.GetTransactionsByAccountResponse, error)
+	CreateTransaction(ctx context.Context, budgetId uuid.UUID, t ynab.SaveTransaction) (*ynab.TransactionDetail, error)
+	UpdateTransaction(
+		ctx context.Context,
+		budgetId uuid.UUID,
+		transactionId string,
+		t ynab.SaveTransaction,
+	) (*ynab.TransactionDetail, error)
+	DeleteTransaction(ctx context.Context, budgetId uuid.UUID, transactionId string) error
+}
+
+// mirror keeps a transaction in the other person's budget for each of our split transactions, holding their share.
+// Mirrored transactions are found again by their import ID, which is derived from our transaction's ID, so no state
+// needs to be stored and rerunning never creates duplicates.
+type mirror struct {
+	cfg    *mirrorConfig
+	budget *BudgetConfig
+	client mirrorClient
+}
+
+// newMirror returns the mirror configured for budget, or nil if mirroring isn't configured.
+func newMirror(logger *zap.Logger, budget *BudgetConfig) (*mirror, error) {
+	if budget.Mirror == nil {
+		return nil, nil
+	}
+
+	client, err := ynab.NewYnabAdapter(logger, budget.Mirror.YnabToken)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to construct client for mirror budget")
+	}
+	return &mirror{
+		cfg:    budget.Mirror,
+		budget: budget,
+		client: client,
+	}, nil
+}
+
+// mirrorImportId returns the import ID of the mirrored copy of our transaction with the given ID.
+func mirrorImportId(transactionId string) string {
+	sum := sha256.Sum256([]byte(transactionId))
+	return mirrorImportIdPrefix + hex.EncodeToString(sum[:])[:36-len(mirrorImportIdPrefix)]
+}
+
+// sync creates, updates, or deletes mirrored transactions so they match transactions, which should be the latest known
+// state of each transaction in our budget. Transactions which aren't split have no mirrored copy.
+func (m *mirror) sync(ctx context.Context, logger *zap.Logger, transactions []ynab.TransactionDetail, result *RunResult) {
+	if len(transactions) == 0 {
+		return
+	}
+
+	existing, err := m.fetchExisting(ctx, transactions)
+	if err != nil {
+		logger.Error("failed to fetch mirrored transactions", zap.Error(err))
+		result.MirrorFailed += len(transactions)
+		return
+	}
+
+	for _, t := range transactions {
+		logger := logger.With(zap.String("transactionId", t.Id))
+		want := m.mirrored(t)
+		got := existing[mirrorImportId(t.Id)]
+
+		var err error
+		switch {
+		case want == nil && got == nil:
+			continue
+		case want == nil:
+			logger.Info("deleting mirrored transaction")
+			err = m.client.DeleteTransaction(ctx, m.cfg.BudgetId, got.Id)
+		case got == nil:
+			logger.Info("creating mirrored transaction")
+			_, err = m.client.CreateTransaction(ctx, m.cfg.BudgetId, *want)
+		case !mirrorMatches(*want, got):
+			logger.Info("updating mirrored transaction")
+			_, err = m.client.UpdateTransaction(ctx, m.cfg.BudgetId, got.Id, *want)
+		default:
+			continue
+		}
+
+		if err != nil {
+			logger.Error("failed to mirror transaction", zap.Error(err))
+			result.MirrorFailed++
+			continue
+		}
+		result.Mirrored++
+	}
+}
+
+// fetchExisting returns the mirrored transactions which might correspond to transactions, keyed by import ID.
+func (m *mirror) fetchExisting(
+	ctx context.Context,
+	transactions []ynab.TransactionDetail,
+) (map[string]*ynab.TransactionDetail, error) {
+	since := transactions[0].Date.Time
+	for _, t := range transactions {
+		if t.Date.Before(since) {
+			since = t.Date.Time
+		}
+	}
+
+	resp, err := m.client.FetchAccountTransactions(ctx, m.cfg.BudgetId, m.cfg.AccountId, 0,
+		since.Add(-mirrorLookbackMargin))
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]*ynab.TransactionDetail)
+	for _, t := range resp.JSON200.Data.Transactions {
+		if t.Deleted || t.ImportId == nil {
+			continue
+		}
+		existing[*t.ImportId] = &t
+	}
+	return existing, nil
+}
+
+// mirrored returns the transaction which should exist in the other person's budget for t, or nil if there shouldn't
+// be one.
+func (m *mirror) mirrored(t ynab.TransactionDetail) *ynab.SaveTransaction {
+	if t.Deleted {
+		return nil
+	}
+
+	var theirShare int64
+	var isSplit bool
+	var ourCategoryId *uuid.UUID
+	for _, sub := range t.Subtransactions {
+		if sub.Deleted {
+			continue
+		}
+		if m.budget.isTheirShare(sub) {
+			theirShare += sub.Amount
+			isSplit = true
+		} else if ourCategoryId == nil {
+			ourCategoryId = sub.CategoryId
+		}
+	}
+	if !isSplit || theirShare == 0 {
+		return nil
+	}
+
+	categoryId := m.cfg.DefaultCategoryId
+	if ourCategoryId != nil {
+		if mapped, ok := m.cfg.Categories[*ourCategoryId]; ok {
+			categoryId = &mapped
+		}
+	}
+
+	accountId := m.cfg.AccountId
+	importId := mirrorImportId(t.Id)
+	date := t.Date
+	return &ynab.SaveTransaction{
+		AccountId:  &accountId,
+		Amount:     &theirShare,
+		CategoryId: categoryId,
+		Date:       &date,
+		ImportId:   &importId,
+		Memo:       t.Memo,
+		PayeeName:  t.PayeeName,
+	}
+}
+
+// mirrorMatches reports whether the existing mirrored transaction got already matches want.
+func mirrorMatches(want ynab.SaveTransaction, got *ynab.TransactionDetail) bool {
+	return *want.Amount == got.Amount &&
+		want.Date.Equal(got.Date.Time) &&
+		equalPtr(want.CategoryId, got.CategoryId) &&
+		equalPtr(want.Memo, got.Memo) &&
+		equalPtr(want.PayeeName, got.PayeeName)
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
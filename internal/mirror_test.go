@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	"github.com/oapi-codegen/runtime/types"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+	"go.uber.org/zap"
+)
+
+// fakeMirrorClient holds the transactions in the other person's account, and records the changes made to them.
+type fakeMirrorClient struct {
+	existing []ynab.TransactionDetail
+	created  []ynab.SaveTransaction
+	updated  []string
+	deleted  []string
+}
+
+func (f *fakeMirrorClient) FetchAccountTransactions(
+	ctx context.Context,
+	budgetId uuid.UUID,
+	accountId uuid.UUID,
+	serverKnowledge int64,
+	since time.Time,
+) (*ynab.GetTransactionsByAccountResponse, error) {
+	resp := &ynab.GetTransactionsByAccountResponse{JSON200: &ynab.TransactionsResponse{}}
+	resp.JSON200.Data.Transactions = f.existing
+	return resp, nil
+}
+
+func (f *fakeMirrorClient) CreateTransaction(
+	ctx context.Context,
+	budgetId uuid.UUID,
+	t ynab.SaveTransaction,
+) (*ynab.TransactionDetail, error) {
+	f.created = append(f.created, t)
+	return &ynab.TransactionDetail{}, nil
+}
+
+func (f *fakeMirrorClient) UpdateTransaction(
+	ctx context.Context,
+	budgetId uuid.UUID,
+	transactionId string,
+	t ynab.SaveTransaction,
+) (*ynab.TransactionDetail, error) {
+	f.updated = append(f.updated, transactionId)
+	return &ynab.TransactionDetail{}, nil
+}
+
+func (f *fakeMirrorClient) DeleteTransaction(ctx context.Context, budgetId uuid.UUID, transactionId string) error {
+	f.deleted = append(f.deleted, transactionId)
+	return nil
+}
+
+func TestMirrorImportId(t *testing.T) {
+	id := uuid.New().String()
+	got := mirrorImportId(id)
+	if len(got) > 36 {
+		t.Errorf("want import ID of at most 36 characters, got %d: %q", len(got), got)
+	}
+	if got != mirrorImportId(id) {
+		t.Errorf("want import ID to be deterministic")
+	}
+	if got == mirrorImportId(uuid.New().String()) {
+		t.Errorf("want different transactions to have different import IDs")
+	}
+}
+
+func TestMirrorSync(t *testing.T) {
+	splitCategory := uuid.New()
+	ourCategory := uuid.New()
+	theirCategory := uuid.New()
+	date := types.Date{Time: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)}
+
+	split := func(id string, theirShare int64) ynab.TransactionDetail {
+		return ynab.TransactionDetail{
+			Id:     id,
+			Date:   date,
+			Amount: -10_000,
+			Subtransactions: []ynab.SubTransaction{
+				{CategoryId: &ourCategory, Amount: -10_000 - theirShare},
+				{CategoryId: &splitCategory, Amount: theirShare},
+			},
+		}
+	}
+	mirrored := func(id string, mirrorId string, amount int64) ynab.TransactionDetail {
+		importId := mirrorImportId(id)
+		return ynab.TransactionDetail{
+			Id:         mirrorId,
+			Date:       date,
+			Amount:     amount,
+			CategoryId: &theirCategory,
+			ImportId:   &importId,
+		}
+	}
+
+	newSplit := split("new", -5_000)
+	unchanged := split("unchanged", -5_000)
+	changed := split("changed", -3_000)
+	deleted := split("deleted", -5_000)
+	deleted.Deleted = true
+	unsplit := ynab.TransactionDetail{Id: "unsplit", Date: date, Amount: -10_000, CategoryId: &ourCategory}
+
+	client := &fakeMirrorClient{
+		existing: []ynab.TransactionDetail{
+			mirrored("unchanged", "mirror-unchanged", -5_000),
+			mirrored("changed", "mirror-changed", -5_000),
+			mirrored("deleted", "mirror-deleted", -5_000),
+		},
+	}
+	m := &mirror{
+		cfg: &mirrorConfig{
+			BudgetId:   uuid.New(),
+			AccountId:  uuid.New(),
+			Categories: map[uuid.UUID]uuid.UUID{ourCategory: theirCategory},
+		},
+		budget: &BudgetConfig{SplitCategoryId: splitCategory},
+		client: client,
+	}
+
+	result := newRunResult(uuid.New(), RunKindIncremental)
+	m.sync(context.Background(), zap.NewNop(), []ynab.TransactionDetail{newSplit, unchanged, changed, deleted, unsplit}, result)
+
+	if len(client.created) != 1 {
+		t.Fatalf("want 1 created transaction, got %d", len(client.created))
+	}
+	created := client.created[0]
+	if *created.ImportId != mirrorImportId("new") || *created.Amount != -5_000 || *created.CategoryId != theirCategory {
+		t.Errorf("created transaction did not match expected, got import ID %q, amount %d, category %v",
+			*created.ImportId, *created.Amount, *created.CategoryId)
+	}
+	if diff := cmp.Diff([]string{"mirror-changed"}, client.updated); diff != "" {
+		t.Errorf("updated transactions did not match expected. Diff (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"mirror-deleted"}, client.deleted); diff != "" {
+		t.Errorf("deleted transactions did not match expected. Diff (-want +got):\n%s", diff)
+	}
+	if result.Mirrored != 3 || result.MirrorFailed != 0 {
+		t.Errorf("want 3 mirrored and 0 failed, got %d and %d", result.Mirrored, result.MirrorFailed)
+	}
+}
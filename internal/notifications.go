@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/samshadwell/split-ynab/internal/notify"
+	"go.uber.org/zap"
+)
+
+// notificationTarget is a configured notifier, and the events it should be sent.
+type notificationTarget struct {
+	notifier notify.Notifier
+	events   []notify.Event
+}
+
+// notificationTargets returns a target for each of the configured notifications.
+func (cfg *Config) notificationTargets() []notificationTarget {
+	targets := make([]notificationTarget, 0, len(cfg.Notifications))
+	for _, n := range cfg.Notifications {
+		var notifier notify.Notifier
+		switch n.Type {
+		case "webhook":
+			notifier = notify.NewWebhookNotifier(n.Url, n.Headers)
+		case "ntfy":
+			notifier = notify.NewNtfyNotifier(n.Url, n.Token)
+		case "email":
+			notifier = notify.NewEmailNotifier(notify.EmailConfig{
+				Host:     n.Email.Host,
+				Port:     n.Email.Port,
+				Username: n.Email.Username,
+				Password: n.Email.Password,
+				From:     n.Email.From,
+				To:       n.Email.To,
+			})
+		default:
+			panic("programmer error, notification type should have been validated: " + n.Type)
+		}
+		targets = append(targets, notificationTarget{notifier: notifier, events: n.Events})
+	}
+	return targets
+}
+
+// notifyRuns sends each target a message about each run it's interested in. A run which failed is only reported as an
+// error, even if it also split transactions. Failures to notify are logged rather than returned, so they don't affect
+// the outcome of the run.
+func notifyRuns(
+	ctx context.Context,
+	logger *zap.Logger,
+	targets []notificationTarget,
+	budgets []BudgetConfig,
+	results []*RunResult,
+) {
+	for i, result := range results {
+		if result == nil {
+			continue
+		}
+		budget := &budgets[i]
+
+		for _, target := range targets {
+			var event notify.Event
+			switch {
+			case result.Error != "" && slices.Contains(target.events, notify.EventError):
+				event = notify.EventError
+			case result.Error == "" && result.Split > 0 && slices.Contains(target.events, notify.EventSplit):
+				event = notify.EventSplit
+			default:
+				continue
+			}
+
+			if err := target.notifier.Notify(ctx, runMessage(event, budget, result)); err != nil {
+				logger.Warn("failed to send notification",
+					zap.String("budget", budget.displayName()),
+					zap.String("event", string(event)),
+					zap.Error(err))
+			}
+		}
+	}
+}
+
+func runMessage(event notify.Event, budget *BudgetConfig, result *RunResult) notify.Message {
+	title := fmt.Sprintf("split-ynab: split %d transactions in %v", result.Split, budget.displayName())
+	if event == notify.EventError {
+		title = fmt.Sprintf("split-ynab: run failed for %v", budget.displayName())
+	}
+
+	var text strings.Builder
+	// Writing to a strings.Builder can't fail
+	_ = result.WriteText(&text)
+
+	return notify.Message{
+		Event: event,
+		Title: title,
+		Text:  text.String(),
+		Data:  result,
+	}
+}
@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	"github.com/samshadwell/split-ynab/internal/notify"
+	"go.uber.org/zap"
+)
+
+// fakeNotifier records the messages sent to it.
+type fakeNotifier struct {
+	messages []notify.Message
+	err      error
+}
+
+func (f *fakeNotifier) Notify(ctx context.Context, msg notify.Message) error {
+	f.messages = append(f.messages, msg)
+	return f.err
+}
+
+func TestNotifyRuns(t *testing.T) {
+	budgets := []BudgetConfig{{Name: "failed"}, {Name: "split"}, {Name: "quiet"}}
+	failed := newRunResult(uuid.New(), RunKindIncremental)
+	failed.Split = 1
+	failed.finish(errors.New("boom"))
+	split := newRunResult(uuid.New(), RunKindIncremental)
+	split.Split = 2
+	split.finish(nil)
+	quiet := newRunResult(uuid.New(), RunKindIncremental)
+	quiet.finish(nil)
+
+	errorsOnly := &fakeNotifier{}
+	everything := &fakeNotifier{err: errors.New("unreachable")}
+	digestOnly := &fakeNotifier{}
+	targets := []notificationTarget{
+		{notifier: errorsOnly, events: []notify.Event{notify.EventError}},
+		{notifier: everything, events: []notify.Event{notify.EventError, notify.EventSplit}},
+		{notifier: digestOnly, events: []notify.Event{notify.EventDigest}},
+	}
+
+	notifyRuns(context.Background(), zap.NewNop(), targets, budgets, []*RunResult{failed, split, quiet})
+
+	titles := func(f *fakeNotifier) []string {
+		got := make([]string, len(f.messages))
+		for i, m := range f.messages {
+			got[i] = m.Title
+		}
+		return got
+	}
+	if diff := cmp.Diff([]string{"split-ynab: run failed for failed"}, titles(errorsOnly)); diff != "" {
+		t.Errorf("errors-only notifications did not match expected. Diff (-want +got):\n%s", diff)
+	}
+	want := []string{"split-ynab: run failed for failed", "split-ynab: split 2 transactions in split"}
+	if diff := cmp.Diff(want, titles(everything)); diff != "" {
+		t.Errorf("notifications did not match expected. Diff (-want +got):\n%s", diff)
+	}
+	if len(digestOnly.messages) != 0 {
+		t.Errorf("want no run notifications for digest-only target, got %d", len(digestOnly.messages))
+	}
+	if everything.messages[1].Data != split {
+		t.Errorf("want notification data to be the run result")
+	}
+}
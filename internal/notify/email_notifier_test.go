@@ -0,0 +1,149 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSmtpServer accepts a single SMTP session on a local port, without TLS or authentication, and records what it
+// was sent.
+type fakeSmtpServer struct {
+	listener   net.Listener
+	recipients []string
+	data       chan string
+}
+
+func newFakeSmtpServer(t *testing.T) *fakeSmtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := &fakeSmtpServer{listener: listener, data: make(chan string, 1)}
+	go s.serve()
+	return s
+}
+
+func (s *fakeSmtpServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSmtpServer) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		_, _ = conn.Write([]byte(line + "\r\n"))
+	}
+	reply("220 localhost ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			s.recipients = append(s.recipients, strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil || line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			s.data <- data.String()
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	server := newFakeSmtpServer(t)
+	defer func() {
+		_ = server.listener.Close()
+	}()
+
+	n := NewEmailNotifier(EmailConfig{
+		Host: "127.0.0.1",
+		Port: server.port(),
+		From: "split-ynab@example.com",
+		To:   []string{"me@example.com", "partner@example.com"},
+	})
+	err := n.Notify(context.Background(), Message{Event: EventSplit, Title: "Split 2 transactions", Text: "Split: 2\nFailed: 0"})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	data := <-server.data
+	for _, want := range []string{
+		"Subject: Split 2 transactions\r\n",
+		"To: me@example.com, partner@example.com\r\n",
+		"\r\n\r\nSplit: 2\r\nFailed: 0",
+	} {
+		if !strings.Contains(data, want) {
+			t.Errorf("want email to contain %q, got:\n%s", want, data)
+		}
+	}
+	if got := strings.Join(server.recipients, ","); got != "me@example.com,partner@example.com" {
+		t.Errorf("want both recipients, got %v", got)
+	}
+}
+
+func TestEmailNotifierStopsWhenContextIsDone(t *testing.T) {
+	// Accepts connections but never greets, like a server which has stopped responding
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer func() {
+				_ = conn.Close()
+			}()
+		}
+	}()
+
+	n := NewEmailNotifier(EmailConfig{
+		Host: "127.0.0.1",
+		Port: listener.Addr().(*net.TCPAddr).Port,
+		From: "split-ynab@example.com",
+		To:   []string{"me@example.com"},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := n.Notify(ctx, Message{Event: EventSplit, Title: "Split 1 transaction"}); err == nil {
+		t.Fatal("want error from a server which never responds, got nil")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("want Notify to give up when the context is done, took %v", elapsed)
+	}
+}
@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Event is a kind of occurrence a notifier may be configured to report.
+type Event string
+
+const (
+	// A run failed
+	EventError Event = "errors"
+	// A run split at least one transaction
+	EventSplit Event = "splits"
+	// A periodic summary of recent runs
+	EventDigest Event = "digest"
+	// A budget crossed one of its alert thresholds
+	EventAlert Event = "alerts"
+)
+
+// Message is a single notification.
+type Message struct {
+	Event Event
+	// A short, one-line summary
+	Title string
+	// The full, human-readable message
+	Text string
+	// Structured details, for notifiers which send JSON
+	Data any
+}
+
+// Notifier delivers messages to a single destination.
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+const requestTimeout = 30 * time.Second
+
+var httpClient = &http.Client{Timeout: requestTimeout}
@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ntfyNotifier publishes each message as plain text to an ntfy topic, or any service accepting the same requests.
+type ntfyNotifier struct {
+	url   string
+	token string
+}
+
+// NewNtfyNotifier returns a notifier which publishes to the topic at url, e.g. https://ntfy.sh/my-topic. token is
+// optional, and is sent as a bearer token.
+func NewNtfyNotifier(url string, token string) *ntfyNotifier {
+	return &ntfyNotifier{
+		url:   url,
+		token: token,
+	}
+}
+
+func (n *ntfyNotifier) Notify(ctx context.Context, msg Message) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, strings.NewReader(msg.Text))
+	if err != nil {
+		return fmt.Errorf("failed to build ntfy request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("Title", msg.Title)
+	req.Header.Set("Tags", string(msg.Event))
+	if msg.Event == EventError {
+		req.Header.Set("Priority", "high")
+	}
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+
+	return send(req)
+}
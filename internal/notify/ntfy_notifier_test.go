@@ -0,0 +1,40 @@
+package notify
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNtfyNotifier(t *testing.T) {
+	var gotBody string
+	var gotHeaders http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		gotHeaders = r.Header
+	}))
+	defer server.Close()
+
+	n := NewNtfyNotifier(server.URL+"/split-ynab", "tk_secret")
+	err := n.Notify(context.Background(), Message{Event: EventError, Title: "Run failed", Text: "Error: boom"})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	if gotBody != "Error: boom" {
+		t.Errorf("want plain text body, got %q", gotBody)
+	}
+	for header, want := range map[string]string{
+		"Title":         "Run failed",
+		"Tags":          "errors",
+		"Priority":      "high",
+		"Authorization": "Bearer tk_secret",
+	} {
+		if got := gotHeaders.Get(header); got != want {
+			t.Errorf("want %v header %q, got %q", header, want, got)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// webhookNotifier POSTs each message as a JSON object to a URL.
+type webhookNotifier struct {
+	url     string
+	headers map[string]string
+}
+
+// webhookPayload is the body of each request sent by a webhookNotifier.
+type webhookPayload struct {
+	Event Event  `json:"event"`
+	Title string `json:"title"`
+	Text  string `json:"text"`
+	Data  any    `json:"data,omitempty"`
+}
+
+// NewWebhookNotifier returns a notifier which POSTs each message to url as JSON, with the given extra headers, e.g. for
+// authentication.
+func NewWebhookNotifier(url string, headers map[string]string) *webhookNotifier {
+	return &webhookNotifier{
+		url:     url,
+		headers: headers,
+	}
+}
+
+func (w *webhookNotifier) Notify(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(webhookPayload{
+		Event: msg.Event,
+		Title: msg.Title,
+		Text:  msg.Text,
+		Data:  msg.Data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+
+	return send(req)
+}
+
+// send sends req, returning an error unless it succeeds with a 2xx status code.
+func send(req *http.Request) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("non-2xx status code %v from %v", resp.StatusCode, req.URL.Host)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var got map[string]any
+	var gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("want JSON body, got error %v", err)
+		}
+	}))
+	defer server.Close()
+
+	n := NewWebhookNotifier(server.URL, map[string]string{"Authorization": "Bearer secret"})
+	err := n.Notify(context.Background(), Message{
+		Event: EventSplit,
+		Title: "Split 1 transaction",
+		Text:  "Split: 1",
+		Data:  map[string]int{"split": 1},
+	})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	want := map[string]any{
+		"event": "splits",
+		"title": "Split 1 transaction",
+		"text":  "Split: 1",
+		"data":  map[string]any{"split": float64(1)},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("webhook payload did not match expected. Diff (-want +got):\n%s", diff)
+	}
+	if gotAuth != "Bearer secret" {
+		t.Errorf("want configured header to be sent, got %q", gotAuth)
+	}
+}
+
+func TestWebhookNotifierErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	err := NewWebhookNotifier(server.URL, nil).Notify(context.Background(), Message{Event: EventError})
+	if err == nil {
+		t.Errorf("want error for non-2xx status, got nil")
+	}
+}
@@ -0,0 +1,245 @@
+package internal
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+	"go.uber.org/zap"
+)
+
+// The format of months in reports, e.g. "2026-09"
+const monthFormat = "2006-01"
+
+// OwedReport describes how much the other person owes for the split transactions dated in a single month. Amounts are
+// in YNAB milliunits, and are positive when they owe money.
+type OwedReport struct {
+	BudgetId uuid.UUID `json:"budgetId"`
+	// The month covered, e.g. "2026-09"
+	Month string `json:"month"`
+	// Their share of the month's splits which haven't been covered by a repayment yet
+	Owed int64 `json:"owed"`
+	// Repayments received which haven't covered a whole split yet, across every month. They count towards the next
+	// repayment, which covers splits from the oldest first
+	Credit int64 `json:"credit"`
+	// The split category this month. Nil when using an IOU account
+	SplitCategory *SplitCategorySummary `json:"splitCategory,omitempty"`
+	ByCategory    []OwedGroup           `json:"byCategory"`
+	ByAccount     []OwedGroup           `json:"byAccount"`
+	Transactions  []OwedTransaction     `json:"transactions"`
+}
+
+// SplitCategorySummary is the state of the split category in a single month.
+type SplitCategorySummary struct {
+	Budgeted int64 `json:"budgeted"`
+	Activity int64 `json:"activity"`
+	Balance  int64 `json:"balance"`
+	// Set if the budget has a splitCategoryTarget
+	Target *int64 `json:"target,omitempty"`
+	// What they owe according to the category: the target less its balance. Set if Target is
+	OwedByBalance *int64 `json:"owedByBalance,omitempty"`
+}
+
+// OwedGroup totals what's owed for the transactions sharing a category or account.
+type OwedGroup struct {
+	Name         string `json:"name"`
+	Owed         int64  `json:"owed"`
+	Transactions int    `json:"transactions"`
+}
+
+// OwedTransaction is a single split transaction which hasn't been repaid.
+type OwedTransaction struct {
+	TransactionId string `json:"transactionId"`
+	Date          string `json:"date"`
+	AccountName   string `json:"accountName"`
+	PayeeName     string `json:"payeeName,omitempty"`
+	CategoryName  string `json:"categoryName,omitempty"`
+	Amount        int64  `json:"amount"`
+	Owed          int64  `json:"owed"`
+}
+
+// Owed reports how much the other person owes for the split transactions dated in the month containing month, using
+// the ledger of splits and repayments, and the split category's balance if one is configured.
+func Owed(
+	ctx context.Context,
+	logger *zap.Logger,
+	budget *BudgetConfig,
+	storageAdapter storage.StorageAdapter,
+	month time.Time,
+) (*OwedReport, error) {
+	splits, err := storageAdapter.ListSplitRecords(ctx, budget.BudgetId)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read split transactions from ledger")
+	}
+	settlements, err := storageAdapter.ListSettlementRecords(ctx, budget.BudgetId)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read repayments from ledger")
+	}
+
+	var category *ynab.Category
+	if budget.SplitCategoryId != uuid.Nil {
+		client, err := ynab.NewYnabAdapter(logger, budget.YnabToken)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to construct client")
+		}
+		category, err = client.GetMonthCategory(ctx, budget.BudgetId, month, budget.SplitCategoryId)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to fetch split category")
+		}
+	}
+
+	return newOwedReport(budget, month, splits, settlements, category), nil
+}
+
+// newOwedReport builds the report for the month containing month. category is the split category that month, or nil
+// if there isn't one.
+func newOwedReport(
+	budget *BudgetConfig,
+	month time.Time,
+	splits []storage.SplitRecord,
+	settlements []storage.SettlementRecord,
+	category *ynab.Category,
+) *OwedReport {
+	report := &OwedReport{
+		BudgetId:     budget.BudgetId,
+		Month:        month.Format(monthFormat),
+		ByCategory:   make([]OwedGroup, 0),
+		ByAccount:    make([]OwedGroup, 0),
+		Transactions: make([]OwedTransaction, 0),
+	}
+
+	report.Credit = ledgerCredit(splits, settlements)
+
+	if category != nil {
+		summary := &SplitCategorySummary{
+			Budgeted: category.Budgeted,
+			Activity: category.Activity,
+			Balance:  category.Balance,
+		}
+		if budget.SplitCategoryTarget != nil {
+			target := int64(budget.SplitCategoryTarget.Amount)
+			owed := target - category.Balance
+			summary.Target = &target
+			summary.OwedByBalance = &owed
+		}
+		report.SplitCategory = summary
+	}
+
+	byCategory := make(map[string]*OwedGroup)
+	byAccount := make(map[string]*OwedGroup)
+	for _, s := range splits {
+		if s.SettledBy != "" || !inMonth(s.Date, report.Month) {
+			continue
+		}
+
+		owed := -s.TheirShare
+		report.Owed += owed
+		report.Transactions = append(report.Transactions, OwedTransaction{
+			TransactionId: s.TransactionId,
+			Date:          s.Date,
+			AccountName:   s.AccountName,
+			PayeeName:     s.PayeeName,
+			CategoryName:  s.CategoryName,
+			Amount:        s.Amount,
+			Owed:          owed,
+		})
+		addToGroup(byCategory, s.CategoryName, owed)
+		addToGroup(byAccount, s.AccountName, owed)
+	}
+
+	report.ByCategory = sortedGroups(byCategory)
+	report.ByAccount = sortedGroups(byAccount)
+	return report
+}
+
+// inMonth reports whether date, in YYYY-MM-DD format, is in month, in YYYY-MM format.
+func inMonth(date string, month string) bool {
+	return strings.HasPrefix(date, month+"-")
+}
+
+func addToGroup(groups map[string]*OwedGroup, name string, owed int64) {
+	if name == "" {
+		name = "(none)"
+	}
+	g, ok := groups[name]
+	if !ok {
+		g = &OwedGroup{Name: name}
+		groups[name] = g
+	}
+	g.Owed += owed
+	g.Transactions++
+}
+
+// sortedGroups returns the groups with the largest amount owed first.
+func sortedGroups(groups map[string]*OwedGroup) []OwedGroup {
+	sorted := make([]OwedGroup, 0, len(groups))
+	for _, g := range groups {
+		sorted = append(sorted, *g)
+	}
+	slices.SortFunc(sorted, func(a, b OwedGroup) int {
+		return cmp.Or(cmp.Compare(b.Owed, a.Owed), cmp.Compare(a.Name, b.Name))
+	})
+	return sorted
+}
+
+// WriteText writes a human-readable version of the report to w.
+func (r *OwedReport) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Budget:\t%v\n", r.BudgetId)
+	fmt.Fprintf(tw, "Month:\t%v\n", r.Month)
+	fmt.Fprintf(tw, "Owed:\t%v\n", formatMilliunits(r.Owed))
+	if r.Credit != 0 {
+		fmt.Fprintf(tw, "Credit:\t%v\n", formatMilliunits(r.Credit))
+	}
+	if c := r.SplitCategory; c != nil {
+		fmt.Fprintf(tw, "Split category:\t%v budgeted, %v activity, %v balance\n",
+			formatMilliunits(c.Budgeted), formatMilliunits(c.Activity), formatMilliunits(c.Balance))
+		if c.OwedByBalance != nil {
+			fmt.Fprintf(tw, "Owed by balance:\t%v (target %v)\n",
+				formatMilliunits(*c.OwedByBalance), formatMilliunits(*c.Target))
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(r.Transactions) == 0 {
+		return nil
+	}
+
+	for _, section := range []struct {
+		heading string
+		groups  []OwedGroup
+	}{
+		{"CATEGORY", r.ByCategory},
+		{"ACCOUNT", r.ByAccount},
+	} {
+		fmt.Fprintln(w)
+		tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(tw, "%v\tTRANSACTIONS\tOWED\n", section.heading)
+		for _, g := range section.groups {
+			fmt.Fprintf(tw, "%v\t%d\t%v\n", g.Name, g.Transactions, formatMilliunits(g.Owed))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DATE\tPAYEE\tCATEGORY\tACCOUNT\tAMOUNT\tOWED")
+	for _, t := range r.Transactions {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\n",
+			t.Date, t.PayeeName, t.CategoryName, t.AccountName, formatMilliunits(t.Amount), formatMilliunits(t.Owed))
+	}
+	return tw.Flush()
+}
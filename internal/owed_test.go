@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+)
+
+func TestNewOwedReport(t *testing.T) {
+	budget := &BudgetConfig{
+		BudgetId:            uuid.New(),
+		SplitCategoryId:     uuid.New(),
+		SplitCategoryTarget: &categoryTarget{Amount: 1_000_000},
+	}
+	splits := []storage.SplitRecord{
+		{TransactionId: "august", Date: "2026-08-31", AccountName: "Card", CategoryName: "Groceries", Amount: -10_000, TheirShare: -5_000},
+		{TransactionId: "settled", Date: "2026-09-01", AccountName: "Card", CategoryName: "Groceries", Amount: -8_000, TheirShare: -4_000, SettledBy: "venmo"},
+		{TransactionId: "groceries", Date: "2026-09-02", AccountName: "Card", CategoryName: "Groceries", Amount: -20_000, TheirShare: -10_000},
+		{TransactionId: "dinner", Date: "2026-09-03", AccountName: "Checking", CategoryName: "Restaurants", Amount: -60_000, TheirShare: -30_000},
+		{TransactionId: "refund", Date: "2026-09-04", AccountName: "Card", CategoryName: "Groceries", Amount: 4_000, TheirShare: 2_000},
+	}
+	settlements := []storage.SettlementRecord{{TransactionId: "venmo", Amount: 5_000, Unapplied: 1_000}}
+	category := &ynab.Category{Budgeted: 0, Activity: -38_000, Balance: 962_000}
+
+	got := newOwedReport(budget, time.Date(2026, 9, 15, 0, 0, 0, 0, time.UTC), splits, settlements, category)
+
+	if got.Month != "2026-09" || got.Owed != 38_000 || got.Credit != 1_000 {
+		t.Errorf("want month 2026-09 with 38.00 owed and 1.00 credit, got %v with %d and %d", got.Month, got.Owed, got.Credit)
+	}
+	if got.SplitCategory == nil || got.SplitCategory.OwedByBalance == nil || *got.SplitCategory.OwedByBalance != 38_000 {
+		t.Errorf("want 38.00 owed by balance, got %+v", got.SplitCategory)
+	}
+
+	wantByCategory := []OwedGroup{
+		{Name: "Restaurants", Owed: 30_000, Transactions: 1},
+		{Name: "Groceries", Owed: 8_000, Transactions: 2},
+	}
+	if diff := cmp.Diff(wantByCategory, got.ByCategory); diff != "" {
+		t.Errorf("by category did not match expected. Diff (-want +got):\n%s", diff)
+	}
+	wantByAccount := []OwedGroup{
+		{Name: "Checking", Owed: 30_000, Transactions: 1},
+		{Name: "Card", Owed: 8_000, Transactions: 2},
+	}
+	if diff := cmp.Diff(wantByAccount, got.ByAccount); diff != "" {
+		t.Errorf("by account did not match expected. Diff (-want +got):\n%s", diff)
+	}
+
+	gotIds := make([]string, len(got.Transactions))
+	for i, tr := range got.Transactions {
+		gotIds[i] = tr.TransactionId
+	}
+	if diff := cmp.Diff([]string{"groceries", "dinner", "refund"}, gotIds); diff != "" {
+		t.Errorf("transactions did not match expected. Diff (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,310 @@
+package internal
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/oapi-codegen/runtime/types"
+	"github.com/pkg/errors"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// Prefix of the import ID given to expenses the other person paid for. YNAB limits import IDs to 36 characters.
+const partnerPaidImportIdPrefix = "PARTNER-PAID:"
+
+// PartnerExpense is an expense the other person paid, part or all of which was ours.
+type PartnerExpense struct {
+	Date  types.Date `yaml:"date"`
+	Payee string     `yaml:"payee"`
+	// The total they paid
+	Amount Milliunits `yaml:"amount"`
+	// The category our share is taken from
+	CategoryId uuid.UUID `yaml:"categoryId"`
+	// Optional, our share of Amount. Mutually exclusive with PercentOurShare
+	OurShare *Milliunits `yaml:"ourShare"`
+	// Optional, our share of Amount as a percentage. If neither this nor OurShare is set, our share is half
+	PercentOurShare *int   `yaml:"percentOurShare"`
+	Memo            string `yaml:"memo"`
+	// Optional, identifies the expense instead of its contents, so identical expenses recorded separately aren't
+	// mistaken for the same one
+	Id string `yaml:"id"`
+}
+
+// ImportResult summarizes the transactions created from an import.
+type ImportResult struct {
+	Created int `json:"created"`
+	// Expenses which were already imported
+	Duplicates int `json:"duplicates"`
+	Failed     int `json:"failed"`
+}
+
+func (e PartnerExpense) validate() error {
+	if e.Date.IsZero() {
+		return errors.New("missing `date`")
+	}
+	if e.Payee == "" {
+		return errors.New("missing `payee`")
+	}
+	if e.Amount <= 0 {
+		return errors.Errorf("`amount` must be positive: %v", e.Amount)
+	}
+	if e.CategoryId == uuid.Nil {
+		return errors.New("missing `categoryId`")
+	}
+	if e.OurShare != nil && e.PercentOurShare != nil {
+		return errors.New("only one of `ourShare` and `percentOurShare` may be set")
+	}
+	if e.OurShare != nil && (*e.OurShare <= 0 || *e.OurShare > e.Amount) {
+		return errors.Errorf("`ourShare` must be positive and at most `amount`: %v", *e.OurShare)
+	}
+	if e.PercentOurShare != nil && (*e.PercentOurShare < 1 || *e.PercentOurShare > 100) {
+		return errors.Errorf("`percentOurShare` must be between 1 and 100, inclusive: %v", *e.PercentOurShare)
+	}
+	return nil
+}
+
+// ourShare returns how much of the expense was ours, rounded to the cent like splitTransactions.
+func (e PartnerExpense) ourShare() int64 {
+	if e.OurShare != nil {
+		return int64(*e.OurShare)
+	}
+	pct := 50
+	if e.PercentOurShare != nil {
+		pct = *e.PercentOurShare
+	}
+	return int64(e.Amount) / 10 * int64(pct) / 100 * 10
+}
+
+// importId returns the import ID of the transaction recording e, which is the same each time e is recorded.
+// occurrence is how many identical expenses came before e in the same batch, so that each gets its own import ID. It's
+// ignored if e has an Id.
+func (e PartnerExpense) importId(occurrence int) string {
+	if e.Id != "" {
+		return hashedImportId(partnerPaidImportIdPrefix, "id|"+e.Id, 0)
+	}
+	return hashedImportId(partnerPaidImportIdPrefix, e.key(), occurrence)
+}
+
+// key identifies e by its contents, which identical expenses share.
+func (e PartnerExpense) key() string {
+	return fmt.Sprintf("%v|%v|%v|%v|%v", e.Date, e.Payee, int64(e.Amount), e.ourShare(), e.CategoryId)
+}
+
+// partnerPaidImportIds returns the import ID of each of expenses, numbering identical expenses by their order.
+func partnerPaidImportIds(expenses []PartnerExpense) []string {
+	importIds := make([]string, len(expenses))
+	occurrences := make(map[string]int)
+	for i, e := range expenses {
+		importIds[i] = e.importId(occurrences[e.key()])
+		occurrences[e.key()]++
+	}
+	return importIds
+}
+
+// partnerPaidTransaction builds the transaction recording our share of e, the reverse of a split. With an IOU account,
+// our share is taken from the category by a transaction in the IOU account, so what they're owed goes down. Otherwise
+// a transaction with no net amount moves our share from the category into the split category.
+func partnerPaidTransaction(e PartnerExpense, importId string, budget *BudgetConfig) ynab.SaveTransaction {
+	ourShare := e.ourShare()
+	categoryId := e.CategoryId
+	memo := e.Memo
+	if memo == "" {
+		memo = fmt.Sprintf("Paid by partner: our share of %v", e.Amount)
+	}
+
+	if budget.IouAccountId != uuid.Nil {
+		return ourShareTransaction(budget.IouAccountId, e.Date, e.Payee, memo, &categoryId, ourShare, importId)
+	}
+
+	t := ourShareTransaction(budget.PartnerPaidAccountId, e.Date, e.Payee, memo, nil, 0, importId)
+	splitCategoryId := budget.SplitCategoryId
+	t.Subtransactions = &[]ynab.SaveSubTransaction{
+		{Amount: -ourShare, CategoryId: &categoryId},
+		{Amount: ourShare, CategoryId: &splitCategoryId},
+	}
+	return t
+}
+
+// ourShareTransaction builds a transaction which takes our share of an expense someone else paid from categoryId.
+func ourShareTransaction(
+	accountId uuid.UUID,
+	date types.Date,
+	payee string,
+	memo string,
+	categoryId *uuid.UUID,
+	ourShare int64,
+	importId string,
+) ynab.SaveTransaction {
+	amount := -ourShare
+	return ynab.SaveTransaction{
+		AccountId:  &accountId,
+		Amount:     &amount,
+		CategoryId: categoryId,
+		Date:       &date,
+		ImportId:   &importId,
+		Memo:       &memo,
+		PayeeName:  &payee,
+	}
+}
+
+// RecordPartnerPaid creates a transaction in the given budget for our share of each expense, and records each in the
+// ledger as a repayment of what they owe. Recording the same expense again doesn't create a duplicate, so identical
+// expenses must be recorded in the same batch, or given an Id. If dryRun is set, the transactions are logged instead of
+// created.
+func RecordPartnerPaid(
+	ctx context.Context,
+	logger *zap.Logger,
+	budget *BudgetConfig,
+	storageAdapter storage.StorageAdapter,
+	expenses []PartnerExpense,
+	dryRun bool,
+) (*ImportResult, error) {
+	if budget.IouAccountId == uuid.Nil && budget.PartnerPaidAccountId == uuid.Nil {
+		return nil, errors.New("the budget must set `partnerPaidAccountId` or `iouAccountId` to record what they paid")
+	}
+	for i, e := range expenses {
+		if err := e.validate(); err != nil {
+			return nil, errors.Wrapf(err, "invalid expense at index %d", i)
+		}
+	}
+
+	client, err := ynab.NewYnabAdapter(logger, budget.YnabToken)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to construct client")
+	}
+
+	splits, credit := readLedgerBalance(ctx, logger, storageAdapter, budget.BudgetId)
+
+	importIds := partnerPaidImportIds(expenses)
+	result := &ImportResult{}
+	for i, e := range expenses {
+		logger := logger.With(
+			zap.String("date", e.Date.String()),
+			zap.String("payee", e.Payee),
+			zap.Int64("ourShare", e.ourShare()))
+		if dryRun {
+			logger.Info("would create transaction for expense paid by partner")
+			result.Created++
+			continue
+		}
+
+		created, err := client.CreateTransaction(ctx, budget.BudgetId, partnerPaidTransaction(e, importIds[i], budget))
+		switch {
+		case errors.Is(err, ynab.ErrDuplicateImportId):
+			result.Duplicates++
+			continue
+		case err != nil:
+			logger.Error("failed to create transaction for expense paid by partner", zap.Error(err))
+			result.Failed++
+			continue
+		}
+		logger.Info("created transaction for expense paid by partner")
+		result.Created++
+
+		// Paying for our share is as good as paying us back
+		payee := e.Payee
+		record, covered := coverSplits(splits, credit, ynab.TransactionDetail{
+			Id:          created.Id,
+			Date:        e.Date,
+			AccountName: created.AccountName,
+			PayeeName:   &payee,
+			Amount:      e.ourShare(),
+		})
+		credit = record.Unapplied
+		if err := storageAdapter.PutSettlementRecord(ctx, budget.BudgetId, record); err != nil {
+			logger.Warn("failed to record expense in ledger", zap.Error(err))
+		}
+		if len(covered) > 0 {
+			if err := storageAdapter.PutSplitRecords(ctx, budget.BudgetId, covered); err != nil {
+				logger.Warn("failed to mark settled splits in ledger", zap.Error(err))
+			}
+		}
+	}
+
+	if result.Failed > 0 {
+		return result, errors.Errorf("failed to record %d of %d expenses", result.Failed, len(expenses))
+	}
+	return result, nil
+}
+
+// LoadPartnerExpenses reads a batch of expenses in the given format, either "yaml" or "csv". YAML holds a list of
+// expenses. CSV has a header row naming the columns, using the same names as YAML.
+func LoadPartnerExpenses(r io.Reader, format string) ([]PartnerExpense, error) {
+	switch format {
+	case "yaml":
+		var expenses []PartnerExpense
+		if err := yaml.NewDecoder(r).Decode(&expenses); err != nil {
+			return nil, errors.Wrap(err, "failed to decode expenses")
+		}
+		return expenses, nil
+	case "csv":
+		return loadPartnerExpensesCsv(r)
+	default:
+		return nil, errors.Errorf("unknown format %q, must be yaml or csv", format)
+	}
+}
+
+func loadPartnerExpensesCsv(r io.Reader) ([]PartnerExpense, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read expenses")
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := make(map[string]int, len(records[0]))
+	for i, name := range records[0] {
+		columns[strings.TrimSpace(name)] = i
+	}
+
+	expenses := make([]PartnerExpense, 0, len(records)-1)
+	for line, record := range records[1:] {
+		get := func(column string) string {
+			if i, ok := columns[column]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		e := PartnerExpense{Payee: get("payee"), Memo: get("memo"), Id: get("id")}
+		date, err := time.Parse(time.DateOnly, get("date"))
+		if err != nil {
+			return nil, errors.Errorf("invalid date on line %d: %q", line+2, get("date"))
+		}
+		e.Date = types.Date{Time: date}
+		e.Amount, err = parseMilliunits(get("amount"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid amount on line %d", line+2)
+		}
+		e.CategoryId, err = uuid.Parse(get("categoryId"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid categoryId on line %d", line+2)
+		}
+		if s := get("ourShare"); s != "" {
+			ourShare, err := parseMilliunits(s)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid ourShare on line %d", line+2)
+			}
+			e.OurShare = &ourShare
+		}
+		if s := get("percentOurShare"); s != "" {
+			pct, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid percentOurShare on line %d", line+2)
+			}
+			e.PercentOurShare = &pct
+		}
+		expenses = append(expenses, e)
+	}
+	return expenses, nil
+}
@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	"github.com/oapi-codegen/runtime/types"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+)
+
+func TestPartnerExpenseOurShare(t *testing.T) {
+	ourShare := Milliunits(10_000)
+	seventy := 70
+	tests := []struct {
+		name    string
+		expense PartnerExpense
+		want    int64
+	}{
+		{"default half", PartnerExpense{Amount: 45_550}, 22_770},
+		{"percentage", PartnerExpense{Amount: 60_000, PercentOurShare: &seventy}, 42_000},
+		{"explicit", PartnerExpense{Amount: 60_000, OurShare: &ourShare}, 10_000},
+	}
+	for _, tt := range tests {
+		if got := tt.expense.ourShare(); got != tt.want {
+			t.Errorf("%v: want our share of %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestPartnerPaidTransaction(t *testing.T) {
+	dining := uuid.New()
+	expense := PartnerExpense{
+		Date:       types.Date{Time: time.Date(2026, 9, 4, 0, 0, 0, 0, time.UTC)},
+		Payee:      "Dinner",
+		Amount:     60_000,
+		CategoryId: dining,
+	}
+
+	iou := &BudgetConfig{IouAccountId: uuid.New()}
+	got := partnerPaidTransaction(expense, expense.importId(0), iou)
+	if *got.AccountId != iou.IouAccountId || *got.Amount != -30_000 || *got.CategoryId != dining || got.Subtransactions != nil {
+		t.Errorf("want -30.00 in dining from the IOU account, got %d in %v from %v", *got.Amount, got.CategoryId, *got.AccountId)
+	}
+
+	category := &BudgetConfig{SplitCategoryId: uuid.New(), PartnerPaidAccountId: uuid.New()}
+	got = partnerPaidTransaction(expense, expense.importId(0), category)
+	if *got.AccountId != category.PartnerPaidAccountId || *got.Amount != 0 || got.CategoryId != nil {
+		t.Errorf("want a zero amount split in the partner paid account, got %d in %v from %v", *got.Amount, got.CategoryId, *got.AccountId)
+	}
+	wantSubs := []ynab.SaveSubTransaction{
+		{Amount: -30_000, CategoryId: &dining},
+		{Amount: 30_000, CategoryId: &category.SplitCategoryId},
+	}
+	if diff := cmp.Diff(wantSubs, *got.Subtransactions); diff != "" {
+		t.Errorf("subtransactions did not match expected. Diff (-want +got):\n%s", diff)
+	}
+	if len(*got.ImportId) > 36 || *got.ImportId != *partnerPaidTransaction(expense, expense.importId(0), category).ImportId {
+		t.Errorf("want a stable import ID of at most 36 characters, got %q", *got.ImportId)
+	}
+}
+
+func TestPartnerPaidImportIds(t *testing.T) {
+	dinner := PartnerExpense{
+		Date:       types.Date{Time: time.Date(2026, 9, 4, 0, 0, 0, 0, time.UTC)},
+		Payee:      "Dinner",
+		Amount:     60_000,
+		CategoryId: uuid.New(),
+	}
+	lunch := dinner
+	lunch.Payee = "Lunch"
+	withId := dinner
+	withId.Id = "receipt-1"
+
+	got := partnerPaidImportIds([]PartnerExpense{dinner, lunch, dinner, withId})
+	if got[0] != dinner.importId(0) || got[1] != lunch.importId(0) {
+		t.Errorf("want the first of each expense to keep its own import ID, got %q", got)
+	}
+	if got[2] == got[0] {
+		t.Errorf("want identical expenses to get different import IDs, both got %q", got[0])
+	}
+	if diff := cmp.Diff(got, partnerPaidImportIds([]PartnerExpense{dinner, lunch, dinner, withId})); diff != "" {
+		t.Errorf("want the same import IDs when recorded again. Diff (-first +second):\n%s", diff)
+	}
+	if got[3] == got[0] || got[3] != withId.importId(5) {
+		t.Errorf("want an expense with an ID to be identified by it alone, got %q", got[3])
+	}
+	for _, id := range got {
+		if len(id) > 36 {
+			t.Errorf("want import ID of at most 36 characters, got %q", id)
+		}
+	}
+}
+
+func TestLoadPartnerExpenses(t *testing.T) {
+	dining := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	ourShare := Milliunits(12_500)
+	seventy := 70
+	want := []PartnerExpense{
+		{Date: types.Date{Time: time.Date(2026, 9, 4, 0, 0, 0, 0, time.UTC)}, Payee: "Dinner", Amount: 60_000, CategoryId: dining},
+		{Date: types.Date{Time: time.Date(2026, 9, 5, 0, 0, 0, 0, time.UTC)}, Payee: "Movies", Amount: 25_000, CategoryId: dining, OurShare: &ourShare, Memo: "Tickets"},
+		{Date: types.Date{Time: time.Date(2026, 9, 6, 0, 0, 0, 0, time.UTC)}, Payee: "Lunch", Amount: 20_000, CategoryId: dining, PercentOurShare: &seventy, Id: "lunch-1"},
+	}
+
+	yml := `
+- date: 2026-09-04
+  payee: Dinner
+  amount: 60
+  categoryId: 00000000-0000-0000-0000-000000000001
+- date: 2026-09-05
+  payee: Movies
+  amount: 25.00
+  categoryId: 00000000-0000-0000-0000-000000000001
+  ourShare: 12.50
+  memo: Tickets
+- date: 2026-09-06
+  payee: Lunch
+  amount: 20
+  categoryId: 00000000-0000-0000-0000-000000000001
+  percentOurShare: 70
+  id: lunch-1
+`
+	got, err := LoadPartnerExpenses(strings.NewReader(yml), "yaml")
+	if err != nil {
+		t.Fatalf("want nil error loading YAML, got %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("expenses from YAML did not match expected. Diff (-want +got):\n%s", diff)
+	}
+
+	csv := `date,payee,amount,categoryId,ourShare,percentOurShare,memo,id
+2026-09-04,Dinner,60,00000000-0000-0000-0000-000000000001,,,,
+2026-09-05,Movies,25.00,00000000-0000-0000-0000-000000000001,12.50,,Tickets,
+2026-09-06,Lunch,20,00000000-0000-0000-0000-000000000001,,70,,lunch-1
+`
+	got, err = LoadPartnerExpenses(strings.NewReader(csv), "csv")
+	if err != nil {
+		t.Fatalf("want nil error loading CSV, got %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("expenses from CSV did not match expected. Diff (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// PlainTextOptions controls the account names and commodity used when exporting to plain-text accounting formats.
+type PlainTextOptions struct {
+	// Parent of the account holding our share, which is named after the transaction's original category
+	ExpensesRoot string
+	// Parent of the account the transaction was paid from, which is named after the YNAB account
+	AccountsRoot string
+	// The account holding their share
+	ReceivableAccount string
+	Commodity         string
+}
+
+// DefaultPlainTextOptions returns the options used unless others are given.
+func DefaultPlainTextOptions() PlainTextOptions {
+	return PlainTextOptions{
+		ExpensesRoot:      "Expenses",
+		AccountsRoot:      "Assets",
+		ReceivableAccount: "Receivable:Partner",
+		Commodity:         "USD",
+	}
+}
+
+// plainTextPosting is a single line of a plain-text accounting entry.
+type plainTextPosting struct {
+	account string
+	amount  int64
+}
+
+// plainTextPostings returns the postings for a split transaction: our share to its original category, their share to
+// the receivable account, and the total from the account it was paid from. They always balance.
+func plainTextPostings(r ExportRow, opts PlainTextOptions, component func(string) string) []plainTextPosting {
+	category := component(r.CategoryName)
+	if category == "" {
+		category = "Uncategorized"
+	}
+	account := component(r.AccountName)
+	if account == "" {
+		account = "Unknown"
+	}
+
+	return []plainTextPosting{
+		{account: opts.ExpensesRoot + ":" + category, amount: -r.OurShare},
+		{account: opts.ReceivableAccount, amount: -r.TheirShare},
+		{account: opts.AccountsRoot + ":" + account, amount: r.Amount},
+	}
+}
+
+// WriteLedger writes rows to w as ledger entries, which hledger can also read. Each entry's code is the YNAB
+// transaction ID, so exporting the same transactions again produces identical entries.
+func WriteLedger(w io.Writer, rows []ExportRow, opts PlainTextOptions) error {
+	var b strings.Builder
+	for i, r := range rows {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%v * (%v) %v\n", r.Date, r.TransactionId, singleLine(r.PayeeName))
+		fmt.Fprintf(&b, "    ; split-ynab-id: %v\n", r.TransactionId)
+		if r.Rule != "" {
+			fmt.Fprintf(&b, "    ; split-ynab-rule: %v\n", r.Rule)
+		}
+		for _, p := range plainTextPostings(r, opts, ledgerAccountComponent) {
+			fmt.Fprintf(&b, "    %-40v  %12v %v\n", p.account, formatMilliunitsExact(p.amount), opts.Commodity)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteBeancount writes rows to w as beancount entries. Each entry is linked and tagged with the YNAB transaction ID,
+// so exporting the same transactions again produces identical entries. The accounts used must be opened elsewhere, or
+// by the auto_accounts plugin.
+func WriteBeancount(w io.Writer, rows []ExportRow, opts PlainTextOptions) error {
+	var b strings.Builder
+	for i, r := range rows {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%v * %q \"\" ^split-ynab-%v\n", r.Date, singleLine(r.PayeeName), r.TransactionId)
+		fmt.Fprintf(&b, "  split-ynab-id: %q\n", r.TransactionId)
+		if r.Rule != "" {
+			fmt.Fprintf(&b, "  split-ynab-rule: %q\n", r.Rule)
+		}
+		for _, p := range plainTextPostings(r, opts, beancountAccountComponent) {
+			fmt.Fprintf(&b, "  %-40v  %12v %v\n", p.account, formatMilliunitsExact(p.amount), opts.Commodity)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ledgerAccountComponent turns a YNAB account or category name into part of a ledger account name. Colons would start
+// a sub-account, and two spaces in a row would end the account name, so neither may appear.
+func ledgerAccountComponent(name string) string {
+	name = strings.ReplaceAll(name, ":", "-")
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// beancountAccountComponent turns a YNAB account or category name into part of a beancount account name, which may
+// only contain letters, numbers, and dashes, and must start with a capital letter or number. For example,
+// "🛒 Groceries & household" becomes "Groceries-Household".
+func beancountAccountComponent(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r))
+	})
+	for i, w := range words {
+		words[i] = strings.ToUpper(w[:1]) + w[1:]
+	}
+	return strings.Join(words, "-")
+}
+
+func singleLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var plainTextRows = []ExportRow{
+	{
+		TransactionId: "abc-123",
+		Date:          "2026-09-02",
+		AccountName:   "Shared Card",
+		PayeeName:     "Trader Joe's",
+		CategoryName:  "🛒 Groceries & household",
+		Amount:        -30_010,
+		OurShare:      -15_010,
+		TheirShare:    -15_000,
+		Rule:          "flag:orange",
+	},
+}
+
+func TestWriteLedger(t *testing.T) {
+	var b strings.Builder
+	if err := WriteLedger(&b, plainTextRows, DefaultPlainTextOptions()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	want := `2026-09-02 * (abc-123) Trader Joe's
+    ; split-ynab-id: abc-123
+    ; split-ynab-rule: flag:orange
+    Expenses:🛒 Groceries & household                15.010 USD
+    Receivable:Partner                              15.000 USD
+    Assets:Shared Card                             -30.010 USD
+`
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Errorf("ledger output did not match expected. Diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteBeancount(t *testing.T) {
+	var b strings.Builder
+	if err := WriteBeancount(&b, plainTextRows, DefaultPlainTextOptions()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	want := `2026-09-02 * "Trader Joe's" "" ^split-ynab-abc-123
+  split-ynab-id: "abc-123"
+  split-ynab-rule: "flag:orange"
+  Expenses:Groceries-Household                    15.010 USD
+  Receivable:Partner                              15.000 USD
+  Assets:Shared-Card                             -30.010 USD
+`
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Errorf("beancount output did not match expected. Diff (-want +got):\n%s", diff)
+	}
+}
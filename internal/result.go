@@ -0,0 +1,280 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+)
+
+type TransactionStatus string
+
+const (
+	// The transaction was split and YNAB saved it as expected
+	TransactionStatusSplit TransactionStatus = "split"
+	// The transaction was split, but we were unable to read it back to verify it
+	TransactionStatusUnverified TransactionStatus = "unverified"
+	// YNAB accepted the update but did not save the split we sent
+	TransactionStatusMismatched TransactionStatus = "mismatched"
+	// YNAB rejected the update
+	TransactionStatusFailed TransactionStatus = "failed"
+	// The transaction was a repayment, and was recorded against their share
+	TransactionStatusSettled TransactionStatus = "settled"
+	// The transaction would have been split, but the run was a dry run
+	TransactionStatusWouldSplit TransactionStatus = "would-split"
+)
+
+type RunKind string
+
+const (
+	// Processes transactions changed since the last run, tracked by server knowledge
+	RunKindIncremental RunKind = "incremental"
+	// Reprocesses transactions in an explicit date range, without touching server knowledge
+	RunKindBackfill RunKind = "backfill"
+)
+
+// TransactionOutcome describes what happened to a single transaction which matched one of the configured rules, or
+// which was recognized as a repayment.
+type TransactionOutcome struct {
+	TransactionId string            `json:"transactionId"`
+	Date          string            `json:"date"`
+	AccountName   string            `json:"accountName"`
+	PayeeName     string            `json:"payeeName,omitempty"`
+	Amount        int64             `json:"amount"`
+	TheirShare    int64             `json:"theirShare"`
+	Rule          string            `json:"rule"`
+	Status        TransactionStatus `json:"status"`
+	Error         string            `json:"error,omitempty"`
+	Mismatches    []string          `json:"mismatches,omitempty"`
+}
+
+// RunResult summarizes a single run against a budget. Amounts are in YNAB milliunits.
+type RunResult struct {
+	RunId    uuid.UUID `json:"runId"`
+	Kind     RunKind   `json:"kind"`
+	BudgetId uuid.UUID `json:"budgetId"`
+	// Set if nothing was changed, and the run only reports what it would have done. Dry runs aren't stored
+	DryRun                bool      `json:"dryRun,omitempty"`
+	StartedAt             time.Time `json:"startedAt"`
+	FinishedAt            time.Time `json:"finishedAt"`
+	ServerKnowledgeBefore int64     `json:"serverKnowledgeBefore"`
+	ServerKnowledgeAfter  int64     `json:"serverKnowledgeAfter"`
+	// Set if the server knowledge wasn't stored because another run had already stored a later one
+	ServerKnowledgeConflict bool                 `json:"serverKnowledgeConflict,omitempty"`
+	Fetched                 int                  `json:"fetched"`
+	Matched                 int                  `json:"matched"`
+	Split                   int                  `json:"split"`
+	Skipped                 int                  `json:"skipped"`
+	Failed                  int                  `json:"failed"`
+	Settled                 int                  `json:"settled,omitempty"`
+	Mirrored                int                  `json:"mirrored,omitempty"`
+	MirrorFailed            int                  `json:"mirrorFailed,omitempty"`
+	Funded                  int64                `json:"funded,omitempty"`
+	Transactions            []TransactionOutcome `json:"transactions"`
+	// Set if some outcomes were left out of Transactions when the run was stored, to fit in DynamoDB's item size limit
+	TransactionsOmitted int    `json:"transactionsOmitted,omitempty"`
+	Error               string `json:"error,omitempty"`
+}
+
+func newRunResult(budgetId uuid.UUID, kind RunKind) *RunResult {
+	return &RunResult{
+		RunId:        uuid.New(),
+		Kind:         kind,
+		BudgetId:     budgetId,
+		StartedAt:    time.Now(),
+		Transactions: make([]TransactionOutcome, 0),
+	}
+}
+
+func (r *RunResult) finish(err error) {
+	r.FinishedAt = time.Now()
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// addOutcome records the outcome of a split transaction and updates the summary counts to match.
+func (r *RunResult) addOutcome(st splitTransaction, update ynab.SaveTransactionWithId, status TransactionStatus, err error, mismatches []string) {
+	t := st.transaction
+	outcome := TransactionOutcome{
+		TransactionId: t.Id,
+		Date:          t.Date.String(),
+		AccountName:   t.AccountName,
+		Amount:        t.Amount,
+		TheirShare:    theirShareOf(update),
+		Rule:          st.rule,
+		Status:        status,
+		Mismatches:    mismatches,
+	}
+	if t.PayeeName != nil {
+		outcome.PayeeName = *t.PayeeName
+	}
+	if err != nil {
+		outcome.Error = err.Error()
+	}
+	r.Transactions = append(r.Transactions, outcome)
+
+	switch status {
+	case TransactionStatusSplit, TransactionStatusUnverified, TransactionStatusWouldSplit:
+		r.Split++
+	case TransactionStatusSettled:
+		r.Settled++
+	default:
+		r.Failed++
+	}
+}
+
+// WriteText writes a human-readable summary of the run to w.
+func (r *RunResult) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if r.DryRun {
+		fmt.Fprintf(tw, "Run:\t%v (%v, dry run)\n", r.RunId, r.Kind)
+	} else {
+		fmt.Fprintf(tw, "Run:\t%v (%v)\n", r.RunId, r.Kind)
+	}
+	fmt.Fprintf(tw, "Budget:\t%v\n", r.BudgetId)
+	fmt.Fprintf(tw, "Started:\t%v\n", r.StartedAt.Format(time.RFC3339))
+	fmt.Fprintf(tw, "Duration:\t%v\n", r.FinishedAt.Sub(r.StartedAt).Round(time.Millisecond))
+	fmt.Fprintf(tw, "Server knowledge:\t%d -> %d\n", r.ServerKnowledgeBefore, r.ServerKnowledgeAfter)
+	if r.ServerKnowledgeConflict {
+		fmt.Fprintf(tw, "Conflict:\tanother run already stored a later server knowledge\n")
+	}
+	fmt.Fprintf(tw, "Fetched:\t%d\n", r.Fetched)
+	fmt.Fprintf(tw, "Matched:\t%d\n", r.Matched)
+	fmt.Fprintf(tw, "Split:\t%d\n", r.Split)
+	fmt.Fprintf(tw, "Skipped:\t%d\n", r.Skipped)
+	fmt.Fprintf(tw, "Failed:\t%d\n", r.Failed)
+	if r.Settled > 0 {
+		fmt.Fprintf(tw, "Settled:\t%d\n", r.Settled)
+	}
+	if r.Mirrored > 0 || r.MirrorFailed > 0 {
+		fmt.Fprintf(tw, "Mirrored:\t%d (%d failed)\n", r.Mirrored, r.MirrorFailed)
+	}
+	if r.Funded != 0 {
+		fmt.Fprintf(tw, "Funded:\t%v\n", formatMilliunits(r.Funded))
+	}
+	if r.Error != "" {
+		fmt.Fprintf(tw, "Error:\t%v\n", r.Error)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(r.Transactions) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DATE\tPAYEE\tAMOUNT\tTHEIR SHARE\tRULE\tSTATUS")
+	for _, t := range r.Transactions {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\n",
+			t.Date, t.PayeeName, formatMilliunits(t.Amount), formatMilliunits(t.TheirShare), t.Rule, t.Status)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if r.TransactionsOmitted > 0 {
+		fmt.Fprintf(w, "\n%d more transactions weren't stored with this run\n", r.TransactionsOmitted)
+	}
+	return nil
+}
+
+// formatMilliunits formats a YNAB milliunit amount as a decimal currency amount, e.g. -10010 becomes "-10.01"
+func formatMilliunits(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/1000, (amount%1000)/10)
+}
+
+// Record converts the result into the form persisted in storage.
+func (r *RunResult) Record() storage.RunRecord {
+	transactions := make([]storage.TransactionRecord, len(r.Transactions))
+	for i, t := range r.Transactions {
+		transactions[i] = storage.TransactionRecord{
+			TransactionId: t.TransactionId,
+			Date:          t.Date,
+			AccountName:   t.AccountName,
+			PayeeName:     t.PayeeName,
+			Amount:        t.Amount,
+			TheirShare:    t.TheirShare,
+			Rule:          t.Rule,
+			Status:        string(t.Status),
+			Error:         t.Error,
+			Mismatches:    t.Mismatches,
+		}
+	}
+
+	return storage.RunRecord{
+		RunId:                   r.RunId,
+		Kind:                    string(r.Kind),
+		BudgetId:                r.BudgetId,
+		StartedAt:               r.StartedAt,
+		FinishedAt:              r.FinishedAt,
+		DurationMs:              r.FinishedAt.Sub(r.StartedAt).Milliseconds(),
+		ServerKnowledgeBefore:   r.ServerKnowledgeBefore,
+		ServerKnowledgeAfter:    r.ServerKnowledgeAfter,
+		ServerKnowledgeConflict: r.ServerKnowledgeConflict,
+		Fetched:                 r.Fetched,
+		Matched:                 r.Matched,
+		Split:                   r.Split,
+		Skipped:                 r.Skipped,
+		Failed:                  r.Failed,
+		Settled:                 r.Settled,
+		Mirrored:                r.Mirrored,
+		MirrorFailed:            r.MirrorFailed,
+		Funded:                  r.Funded,
+		Transactions:            transactions,
+		TransactionsOmitted:     r.TransactionsOmitted,
+		Error:                   r.Error,
+	}
+}
+
+// RunResultFromRecord converts a run record read from storage back into a RunResult.
+func RunResultFromRecord(record storage.RunRecord) *RunResult {
+	transactions := make([]TransactionOutcome, len(record.Transactions))
+	for i, t := range record.Transactions {
+		transactions[i] = TransactionOutcome{
+			TransactionId: t.TransactionId,
+			Date:          t.Date,
+			AccountName:   t.AccountName,
+			PayeeName:     t.PayeeName,
+			Amount:        t.Amount,
+			TheirShare:    t.TheirShare,
+			Rule:          t.Rule,
+			Status:        TransactionStatus(t.Status),
+			Error:         t.Error,
+			Mismatches:    t.Mismatches,
+		}
+	}
+
+	return &RunResult{
+		RunId:                   record.RunId,
+		Kind:                    RunKind(record.Kind),
+		BudgetId:                record.BudgetId,
+		StartedAt:               record.StartedAt,
+		FinishedAt:              record.FinishedAt,
+		ServerKnowledgeBefore:   record.ServerKnowledgeBefore,
+		ServerKnowledgeAfter:    record.ServerKnowledgeAfter,
+		ServerKnowledgeConflict: record.ServerKnowledgeConflict,
+		Fetched:                 record.Fetched,
+		Matched:                 record.Matched,
+		Split:                   record.Split,
+		Skipped:                 record.Skipped,
+		Failed:                  record.Failed,
+		Settled:                 record.Settled,
+		Mirrored:                record.Mirrored,
+		MirrorFailed:            record.MirrorFailed,
+		Funded:                  record.Funded,
+		Transactions:            transactions,
+		TransactionsOmitted:     record.TransactionsOmitted,
+		Error:                   record.Error,
+	}
+}
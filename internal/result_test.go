@@ -0,0 +1,215 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+	"go.uber.org/zap"
+)
+
+func TestRunResultAddOutcome(t *testing.T) {
+	payee := "Grocer"
+	st := splitTransaction{
+		transaction: &ynab.TransactionDetail{Id: "t1", AccountName: "Checking", PayeeName: &payee, Amount: -10_000},
+		rule:        "flag:blue",
+	}
+	update := ynab.SaveTransactionWithId{Subtransactions: &[]ynab.SaveSubTransaction{
+		{Amount: -5_000},
+		{Amount: -5_000, CategoryId: &uuid.Nil},
+	}}
+
+	tests := []struct {
+		status      TransactionStatus
+		err         error
+		wantSplit   int
+		wantSettled int
+		wantFailed  int
+	}{
+		{TransactionStatusSplit, nil, 1, 0, 0},
+		{TransactionStatusUnverified, errors.New("read back failed"), 1, 0, 0},
+		{TransactionStatusWouldSplit, nil, 1, 0, 0},
+		{TransactionStatusSettled, nil, 0, 1, 0},
+		{TransactionStatusMismatched, nil, 0, 0, 1},
+		{TransactionStatusFailed, errors.New("rejected"), 0, 0, 1},
+	}
+	for _, tt := range tests {
+		result := newRunResult(uuid.New(), RunKindIncremental)
+		result.addOutcome(st, update, tt.status, tt.err, nil)
+
+		if result.Split != tt.wantSplit || result.Settled != tt.wantSettled || result.Failed != tt.wantFailed {
+			t.Errorf("%v: want split %d, settled %d, failed %d, got %d, %d, %d", tt.status,
+				tt.wantSplit, tt.wantSettled, tt.wantFailed, result.Split, result.Settled, result.Failed)
+		}
+		if len(result.Transactions) != 1 {
+			t.Fatalf("%v: want 1 outcome, got %d", tt.status, len(result.Transactions))
+		}
+		got := result.Transactions[0]
+		if got.Status != tt.status || got.PayeeName != payee || got.TheirShare != -5_000 || got.Rule != "flag:blue" {
+			t.Errorf("%v: unexpected outcome %+v", tt.status, got)
+		}
+		if (got.Error != "") != (tt.err != nil) {
+			t.Errorf("%v: want error %v, got %q", tt.status, tt.err, got.Error)
+		}
+	}
+}
+
+func TestRunResultFinish(t *testing.T) {
+	ok := newRunResult(uuid.New(), RunKindIncremental)
+	ok.finish(nil)
+	if ok.Error != "" || ok.FinishedAt.Before(ok.StartedAt) {
+		t.Errorf("want no error and finish after start, got %+v", ok)
+	}
+
+	failed := newRunResult(uuid.New(), RunKindIncremental)
+	failed.finish(errors.New("boom"))
+	if failed.Error != "boom" {
+		t.Errorf("want error boom, got %q", failed.Error)
+	}
+
+	var text strings.Builder
+	if err := failed.WriteText(&text); err != nil {
+		t.Fatalf("want nil error writing text, got %v", err)
+	}
+	if !strings.Contains(text.String(), "boom") || !strings.Contains(text.String(), failed.RunId.String()) {
+		t.Errorf("want text to include run ID and error, got:\n%v", text.String())
+	}
+}
+
+// fakeUpdateClient saves every update except those in rejected, which YNAB rejects as invalid, and those in
+// unavailable, which fail as if YNAB couldn't be reached. Other client methods aren't used by these tests.
+type fakeUpdateClient struct {
+	ynabClient
+	transactions map[string]ynab.TransactionDetail
+	rejected     map[string]bool
+	unavailable  map[string]bool
+}
+
+func (f *fakeUpdateClient) UpdateTransactions(
+	ctx context.Context,
+	budgetId uuid.UUID,
+	updatedTransactions []ynab.SaveTransactionWithId,
+	chunkSize int,
+) []ynab.TransactionUpdateResult {
+	results := make([]ynab.TransactionUpdateResult, len(updatedTransactions))
+	for i, u := range updatedTransactions {
+		results[i].TransactionId = *u.Id
+		if f.rejected[*u.Id] {
+			results[i].Err = fmt.Errorf("%w: bad transaction", ynab.ErrRejected)
+			continue
+		}
+		if f.unavailable[*u.Id] {
+			results[i].Err = errors.New("connection reset")
+			continue
+		}
+		saved := f.transactions[*u.Id]
+		if u.Subtransactions != nil {
+			saved = withSplit(saved, u)
+		} else {
+			saved.CategoryId = u.CategoryId
+		}
+		results[i].Saved = &saved
+	}
+	return results
+}
+
+func TestProcessTransactionsCounts(t *testing.T) {
+	t.Chdir(t.TempDir())
+	accountId := uuid.New()
+	categoryId := uuid.New()
+	splitCategoryId := uuid.New()
+	fifty := 50
+	budget := &BudgetConfig{
+		BudgetId:        uuid.New(),
+		SplitCategoryId: splitCategoryId,
+		Accounts:        []accountConfig{{Id: accountId, DefaultPercentTheirShare: &fifty}},
+	}
+	transactions := []ynab.TransactionDetail{
+		{Id: "split", AccountId: accountId, Amount: -10_000, CategoryId: &categoryId},
+		{Id: "rejected", AccountId: accountId, Amount: -20_000, CategoryId: &categoryId},
+		{Id: "other-account", AccountId: uuid.New(), Amount: -30_000, CategoryId: &categoryId},
+	}
+	client := &fakeUpdateClient{
+		transactions: map[string]ynab.TransactionDetail{},
+		rejected:     map[string]bool{"rejected": true},
+	}
+	for _, tr := range transactions {
+		client.transactions[tr.Id] = tr
+	}
+
+	r := &budgetRun{
+		cfg:            &Config{},
+		budget:         budget,
+		storageAdapter: storage.NewLocalStorageAdapter(),
+		client:         client,
+		theirLine:      ynab.SaveSubTransaction{CategoryId: &splitCategoryId},
+		result:         newRunResult(budget.BudgetId, RunKindIncremental),
+	}
+	r.processTransactions(context.Background(), zap.NewNop(), transactions)
+
+	got := r.result
+	if got.Fetched != 3 || got.Matched != 2 || got.Skipped != 1 || got.Split != 1 || got.Failed != 1 {
+		t.Errorf("want 3 fetched, 2 matched, 1 skipped, 1 split, 1 failed, got %+v", got)
+	}
+	statuses := make(map[string]TransactionStatus, len(got.Transactions))
+	for _, o := range got.Transactions {
+		statuses[o.TransactionId] = o.Status
+	}
+	want := map[string]TransactionStatus{"split": TransactionStatusSplit, "rejected": TransactionStatusFailed}
+	if diff := cmp.Diff(want, statuses); diff != "" {
+		t.Errorf("outcome statuses mismatch (-want +got):\n%v", diff)
+	}
+}
+
+func TestRunResultRecordRoundTrip(t *testing.T) {
+	startedAt := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	result := &RunResult{
+		RunId:                   uuid.New(),
+		Kind:                    RunKindBackfill,
+		BudgetId:                uuid.New(),
+		StartedAt:               startedAt,
+		FinishedAt:              startedAt.Add(1500 * time.Millisecond),
+		ServerKnowledgeBefore:   10,
+		ServerKnowledgeAfter:    20,
+		ServerKnowledgeConflict: true,
+		Fetched:                 5,
+		Matched:                 3,
+		Split:                   1,
+		Skipped:                 2,
+		Failed:                  1,
+		Settled:                 1,
+		Mirrored:                1,
+		MirrorFailed:            1,
+		Funded:                  100_000,
+		Transactions: []TransactionOutcome{
+			{
+				TransactionId: "t1",
+				Date:          "2026-10-17",
+				AccountName:   "Checking",
+				PayeeName:     "Grocer",
+				Amount:        -10_000,
+				TheirShare:    -5_000,
+				Rule:          "flag:blue",
+				Status:        TransactionStatusMismatched,
+				Mismatches:    []string{"amount"},
+			},
+			{TransactionId: "t2", Status: TransactionStatusFailed, Error: "rejected"},
+		},
+		Error: "failed to process 1 of 3 transactions",
+	}
+
+	record := result.Record()
+	if record.DurationMs != 1500 {
+		t.Errorf("want duration of 1500ms, got %d", record.DurationMs)
+	}
+	if diff := cmp.Diff(result, RunResultFromRecord(record)); diff != "" {
+		t.Errorf("round trip mismatch (-want +got):\n%v", diff)
+	}
+}
@@ -2,8 +2,12 @@ package internal
 
 import (
 	"context"
+	stderrors "errors"
+	"fmt"
 	"math/rand"
 	"slices"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
@@ -12,68 +16,390 @@ import (
 	"go.uber.org/zap"
 )
 
+// How long a run may hold the budget's lock before it is considered abandoned. Matches the maximum Lambda timeout.
+const runLockLease = 15 * time.Minute
+
+// ynabClient is the subset of the YNAB adapter's methods used to process a budget.
+type ynabClient interface {
+	FetchTransactions(
+		ctx context.Context,
+		budgetId uuid.UUID,
+		serverKnowledge int64,
+		since time.Time,
+	) (*ynab.GetTransactionsResponse, error)
+	FetchAccountTransactions(
+		ctx context.Context,
+		budgetId uuid.UUID,
+		accountId uuid.UUID,
+		serverKnowledge int64,
+		since time.Time,
+	) (*ynab.GetTransactionsByAccountResponse, error)
+	UpdateTransactions(
+		ctx context.Context,
+		budgetId uuid.UUID,
+		updatedTransactions []ynab.SaveTransactionWithId,
+		chunkSize int,
+	) []ynab.TransactionUpdateResult
+	GetTransaction(ctx context.Context, budgetId uuid.UUID, transactionId string) (*ynab.TransactionDetail, error)
+	GetTransferPayeeId(ctx context.Context, budgetId uuid.UUID, accountId uuid.UUID) (uuid.UUID, error)
+	GetMonthCategory(ctx context.Context, budgetId uuid.UUID, month time.Time, categoryId uuid.UUID) (*ynab.Category, error)
+	SetMonthCategoryBudgeted(
+		ctx context.Context,
+		budgetId uuid.UUID,
+		month time.Time,
+		categoryId uuid.UUID,
+		budgeted int64,
+	) (*ynab.Category, error)
+}
+
 type splitTransaction struct {
 	transaction   *ynab.TransactionDetail
 	pctTheirShare int
+	// Describes the config entry which caused this transaction to be split, e.g. "flag:orange"
+	rule string
+}
+
+// budgetRun holds everything needed to process a budget's transactions during a single run.
+type budgetRun struct {
+	cfg            *Config
+	budget         *BudgetConfig
+	storageAdapter storage.StorageAdapter
+	client         ynabClient
+	// The subtransaction, without an amount, which holds their share of each split
+	theirLine ynab.SaveSubTransaction
+	// Nil if mirroring isn't configured
+	mirror *mirror
+	result *RunResult
+	// How many updates failed in a way which may succeed if retried, such as a network error or rate limit
+	transientFailures int
+}
+
+// job is the work done by a single run against a budget, while holding the budget's lock.
+type job func(ctx context.Context, logger *zap.Logger, r *budgetRun) error
+
+// Run fetches transactions which have changed since the last run, splits those which match the configured rules, and
+// records the new server knowledge. Each configured budget is processed independently, up to cfg.MaxParallelism at a
+// time. The returned results are in the same order as cfg.Budgets, and are non-nil even if an error is returned. The
+// error joins the errors of every budget which failed. Once every budget is done, the configured notifications are
+// sent.
+func Run(ctx context.Context, logger *zap.Logger, cfg *Config, storageAdapter storage.StorageAdapter) ([]*RunResult, error) {
+	results := make([]*RunResult, len(cfg.Budgets))
+	errs := make([]error, len(cfg.Budgets))
+
+	sem := make(chan struct{}, max(cfg.MaxParallelism, 1))
+	var wg sync.WaitGroup
+	for i := range cfg.Budgets {
+		budget := &cfg.Budgets[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i], errs[i] = runJob(ctx, logger, cfg, budget, storageAdapter, RunKindIncremental, runIncremental)
+			if errs[i] != nil {
+				errs[i] = errors.Wrapf(errs[i], "budget %v", budget.displayName())
+			}
+		}()
+	}
+	wg.Wait()
+
+	notifyRuns(ctx, logger, cfg.notificationTargets(), cfg.Budgets, results)
+
+	return results, stderrors.Join(errs...)
+}
+
+// runJob runs j while holding the budget's lock, then stores the record of the run.
+func runJob(
+	ctx context.Context,
+	logger *zap.Logger,
+	cfg *Config,
+	budget *BudgetConfig,
+	storageAdapter storage.StorageAdapter,
+	kind RunKind,
+	j job,
+) (*RunResult, error) {
+	result := newRunResult(budget.BudgetId, kind)
+	logger = logger.With(
+		zap.String("budget", budget.displayName()),
+		zap.String("runId", result.RunId.String()),
+		zap.String("kind", string(kind)),
+	)
+
+	err := runLocked(ctx, logger, cfg, budget, storageAdapter, result, j)
+	result.finish(err)
+
+	if recordErr := storageAdapter.AppendRunRecord(ctx, result.Record()); recordErr != nil {
+		logger.Warn("failed to store run record", zap.Error(recordErr))
+	}
+	return result, err
 }
 
-func Run(ctx context.Context, logger *zap.Logger, cfg *Config, storageAdapter storage.StorageAdapter) error {
-	client, err := ynab.NewYnabAdapter(logger, cfg.YnabToken)
+func runLocked(
+	ctx context.Context,
+	logger *zap.Logger,
+	cfg *Config,
+	budget *BudgetConfig,
+	storageAdapter storage.StorageAdapter,
+	result *RunResult,
+	j job,
+) error {
+	client, err := ynab.NewYnabAdapter(logger, budget.YnabToken)
 	if err != nil {
 		return errors.Wrap(err, "failed to construct client")
 	}
 
-	// In case of error we'll process more transactions than we need to, but don't need to exit.
-	logger.Info("getting last server knowledge")
-	serverKnowledge, err := storageAdapter.GetLastServerKnowledge(ctx, cfg.BudgetId)
+	// Hold the lock for the whole run so an overlapping run can't split the same transactions or move the server
+	// knowledge backwards
+	owner := result.RunId.String()
+	err = storageAdapter.AcquireLock(ctx, budget.BudgetId, owner, runLockLease)
 	if err != nil {
-		logger.Warn("failed to get last server knowledge", zap.Error(err))
+		return errors.Wrap(err, "failed to acquire lock, is another run in progress?")
 	}
+	defer func() {
+		if releaseErr := storageAdapter.ReleaseLock(ctx, budget.BudgetId, owner); releaseErr != nil {
+			logger.Warn("failed to release lock", zap.Error(releaseErr))
+		}
+	}()
 
-	transactionsResponse, err := client.FetchTransactions(ctx, cfg.BudgetId, serverKnowledge)
+	r := &budgetRun{
+		cfg:            cfg,
+		budget:         budget,
+		storageAdapter: storageAdapter,
+		client:         client,
+		result:         result,
+	}
+	r.theirLine, err = theirShareLine(ctx, client, budget)
 	if err != nil {
-		return errors.Wrap(err, "failed to fetch transactions from YNAB")
+		return err
+	}
+	r.mirror, err = newMirror(logger, budget)
+	if err != nil {
+		return err
 	}
 
-	updatedServerKnowledge := transactionsResponse.JSON200.Data.ServerKnowledge
-	filteredTransactions := filterTransactions(transactionsResponse.JSON200.Data.Transactions, cfg)
-	logger.Info("finished filtering transactions", zap.Int("count", len(filteredTransactions)))
+	err = j(ctx, logger, r)
+	if err != nil {
+		return err
+	}
 
-	if len(filteredTransactions) == 0 {
-		logger.Info("no transactions to update, exiting")
-		err = storageAdapter.SetLastServerKnowledge(ctx, cfg.BudgetId, updatedServerKnowledge)
+	if result.Failed > 0 {
+		return errors.Errorf("failed to process %d of %d transactions", result.Failed, result.Matched)
+	}
+	if result.MirrorFailed > 0 {
+		return errors.Errorf("failed to mirror %d transactions", result.MirrorFailed)
+	}
+
+	logger.Info("run complete, program finished successfully")
+	return nil
+}
+
+func runIncremental(ctx context.Context, logger *zap.Logger, r *budgetRun) error {
+	for _, c := range newCursors(r.budget, r.storageAdapter, r.client) {
+		err := r.runCursor(ctx, logger.With(zap.String("cursor", c.name)), c)
 		if err != nil {
-			logger.Warn("failed to set new server knowledge", zap.Error(err))
+			return err
 		}
-		return nil
 	}
 
-	updatedTransactions := splitTransactions(filteredTransactions, cfg.SplitCategoryId)
+	// Fund after splitting, so the balance reflects this run's splits
+	now := time.Now()
+	if err := r.fundSplitCategory(ctx, logger, now); err != nil {
+		return err
+	}
+	r.checkAlerts(ctx, logger, now)
+	return nil
+}
+
+// runCursor processes the transactions which changed since the cursor's stored server knowledge, then advances it.
+func (r *budgetRun) runCursor(ctx context.Context, logger *zap.Logger, c cursor) error {
+	logger.Info("getting last server knowledge")
+	serverKnowledge, err := c.get(ctx)
+	firstRun := errors.Is(err, storage.ErrNotFound)
+	if err != nil && !firstRun {
+		// We'll process more transactions than we need to, but don't need to exit.
+		logger.Warn("failed to get last server knowledge", zap.Error(err))
+	}
+	// YNAB's server knowledge is a single counter across the whole budget, so the latest cursor describes the run
+	r.result.ServerKnowledgeBefore = max(r.result.ServerKnowledgeBefore, serverKnowledge)
+	r.result.ServerKnowledgeAfter = max(r.result.ServerKnowledgeAfter, serverKnowledge)
+
+	since := r.cfg.initialSinceDate(time.Now())
+	if firstRun && r.cfg.FirstRun == FirstRunRecordOnly {
+		// We only need the server knowledge, so fetch as few transactions as possible
+		since = time.Now()
+	}
 
-	err = client.UpdateTransactions(ctx, cfg.BudgetId, updatedTransactions)
+	transactions, updatedServerKnowledge, err := c.fetch(ctx, serverKnowledge, since)
 	if err != nil {
-		return errors.Wrap(err, "failed to update transactions in YNAB")
+		return errors.Wrap(err, "failed to fetch transactions from YNAB")
+	}
+
+	if firstRun && r.cfg.FirstRun == FirstRunRecordOnly {
+		logger.Info("first run, recording server knowledge without splitting any transactions")
+		r.result.Fetched += len(transactions)
+		r.result.Skipped += len(transactions)
+	} else {
+		transientFailures := r.transientFailures
+		r.processTransactions(ctx, logger, transactions)
+		if r.transientFailures > transientFailures {
+			// Fetch the same transactions again next run, so those which failed are retried. Those which succeeded
+			// are already split or recorded, so they're skipped.
+			logger.Warn("some transactions failed but may succeed later, keeping server knowledge to retry them",
+				zap.Int("failed", r.transientFailures-transientFailures))
+			return nil
+		}
 	}
 
+	// Advance server knowledge even if YNAB rejected some transactions. They're reported in the result rather than
+	// retried forever, since a transaction YNAB rejects as invalid once will be rejected again.
 	logger.Info("setting server knowledge", zap.Int64("serverKnowledge", updatedServerKnowledge))
-	err = storageAdapter.SetLastServerKnowledge(ctx, cfg.BudgetId, updatedServerKnowledge)
-	if err != nil {
+	err = c.set(ctx, updatedServerKnowledge)
+	switch {
+	case errors.Is(err, storage.ErrServerKnowledgeRegression):
+		// Shouldn't happen while we hold the lock, unless our lease expired and another run started
+		logger.Error("another run stored a later server knowledge, leaving it in place",
+			zap.Int64("serverKnowledge", updatedServerKnowledge))
+		r.result.ServerKnowledgeConflict = true
+	case err != nil:
 		logger.Warn("failed to set new server knowledge", zap.Error(err))
+	default:
+		r.result.ServerKnowledgeAfter = max(r.result.ServerKnowledgeAfter, updatedServerKnowledge)
 	}
 
-	logger.Info("run complete, program finished successfully")
 	return nil
 }
 
-func filterTransactions(transactions []ynab.TransactionDetail, cfg *Config) []splitTransaction {
-	acctConfigs := make(map[uuid.UUID]*accountConfig, len(cfg.Accounts))
-	for _, acct := range cfg.Accounts {
+// processTransactions records repayments, splits the transactions which match the configured rules, and mirrors the
+// results, recording the outcome of each in the run's result.
+func (r *budgetRun) processTransactions(ctx context.Context, logger *zap.Logger, transactions []ynab.TransactionDetail) {
+	settlements := settlementCandidates(transactions, r.budget)
+	settlementIds := make(map[string]bool, len(settlements))
+	for _, t := range settlements {
+		settlementIds[t.Id] = true
+	}
+	splittable := slices.DeleteFunc(slices.Clone(transactions), func(t ynab.TransactionDetail) bool {
+		return settlementIds[t.Id]
+	})
+
+	filteredTransactions := filterTransactions(splittable, r.budget)
+	logger.Info("finished filtering transactions",
+		zap.Int("count", len(filteredTransactions)),
+		zap.Int("settlements", len(settlements)))
+	r.result.Fetched += len(transactions)
+	r.result.Matched += len(filteredTransactions) + len(settlements)
+	r.result.Skipped += len(transactions) - len(filteredTransactions) - len(settlements)
+
+	latest := r.splitAndVerify(ctx, logger, transactions, filteredTransactions)
+	// Settle after splitting, so a repayment can cover splits fetched in the same run
+	r.settle(ctx, logger, settlements)
+
+	if r.mirror != nil {
+		r.mirror.sync(ctx, logger, latest, r.result)
+	}
+}
+
+// splitAndVerify splits filteredTransactions, verifies YNAB saved them as expected, and records them in the ledger.
+// It returns the latest known state of each of transactions.
+func (r *budgetRun) splitAndVerify(
+	ctx context.Context,
+	logger *zap.Logger,
+	transactions []ynab.TransactionDetail,
+	filteredTransactions []splitTransaction,
+) []ynab.TransactionDetail {
+	if len(filteredTransactions) == 0 {
+		logger.Info("no transactions to split")
+		return transactions
+	}
+
+	updatedTransactions := splitTransactions(filteredTransactions, r.theirLine)
+
+	latest := slices.Clone(transactions)
+	indexes := make(map[string]int, len(transactions))
+	for i, t := range transactions {
+		indexes[t.Id] = i
+	}
+
+	splitRecords := make([]storage.SplitRecord, 0, len(filteredTransactions))
+	results := r.client.UpdateTransactions(ctx, r.budget.BudgetId, updatedTransactions, r.cfg.UpdateChunkSize)
+	for i, res := range results {
+		if res.Err != nil {
+			logger.Error("failed to split transaction",
+				zap.String("transactionId", res.TransactionId),
+				zap.Error(res.Err))
+			r.result.addOutcome(filteredTransactions[i], updatedTransactions[i], TransactionStatusFailed, res.Err, nil)
+			r.countFailure(res.Err)
+			continue
+		}
+
+		saved := res.Saved
+		if saved == nil {
+			var err error
+			saved, err = r.client.GetTransaction(ctx, r.budget.BudgetId, res.TransactionId)
+			if err != nil {
+				logger.Warn("failed to fetch saved transaction, unable to verify split",
+					zap.String("transactionId", res.TransactionId),
+					zap.Error(err))
+				r.result.addOutcome(filteredTransactions[i], updatedTransactions[i], TransactionStatusUnverified, err, nil)
+				latest[indexes[res.TransactionId]] = withSplit(*filteredTransactions[i].transaction, updatedTransactions[i])
+				splitRecords = append(splitRecords, newSplitRecord(filteredTransactions[i], updatedTransactions[i], r.result.RunId))
+				continue
+			}
+		}
+		latest[indexes[res.TransactionId]] = *saved
+
+		if mismatches := verifySplit(updatedTransactions[i], saved); len(mismatches) > 0 {
+			logger.Error("transaction was not saved as split",
+				zap.String("transactionId", res.TransactionId),
+				zap.Strings("mismatches", mismatches))
+			r.result.addOutcome(filteredTransactions[i], updatedTransactions[i], TransactionStatusMismatched, nil, mismatches)
+			continue
+		}
+
+		r.result.addOutcome(filteredTransactions[i], updatedTransactions[i], TransactionStatusSplit, nil, nil)
+		splitRecords = append(splitRecords, newSplitRecord(filteredTransactions[i], updatedTransactions[i], r.result.RunId))
+	}
+
+	if len(splitRecords) > 0 {
+		if err := r.storageAdapter.PutSplitRecords(ctx, r.budget.BudgetId, splitRecords); err != nil {
+			logger.Warn("failed to record split transactions in ledger", zap.Error(err))
+		}
+	}
+
+	return latest
+}
+
+// countFailure records a failed update which may succeed if retried, so the cursor isn't advanced past it.
+func (r *budgetRun) countFailure(err error) {
+	if !errors.Is(err, ynab.ErrRejected) {
+		r.transientFailures++
+	}
+}
+
+// withSplit returns t as it would be after YNAB saved split, for when the saved transaction couldn't be read back.
+func withSplit(t ynab.TransactionDetail, split ynab.SaveTransactionWithId) ynab.TransactionDetail {
+	t.CategoryId = nil
+	t.Subtransactions = make([]ynab.SubTransaction, len(*split.Subtransactions))
+	for i, sub := range *split.Subtransactions {
+		t.Subtransactions[i] = ynab.SubTransaction{
+			TransactionId: t.Id,
+			Amount:        sub.Amount,
+			CategoryId:    sub.CategoryId,
+			PayeeId:       sub.PayeeId,
+		}
+	}
+	return t
+}
+
+func filterTransactions(transactions []ynab.TransactionDetail, budget *BudgetConfig) []splitTransaction {
+	acctConfigs := make(map[uuid.UUID]*accountConfig, len(budget.Accounts))
+	for _, acct := range budget.Accounts {
 		copy := acct
 		acctConfigs[acct.Id] = &copy
 	}
 
-	splitFlags := make(map[ynab.TransactionFlagColor]*flagConfig, len(cfg.Flags))
-	for _, f := range cfg.Flags {
+	splitFlags := make(map[ynab.TransactionFlagColor]*flagConfig, len(budget.Flags))
+	for _, f := range budget.Flags {
 		copy := f
 		splitFlags[f.Color] = &copy
 	}
@@ -83,7 +409,9 @@ func filterTransactions(transactions []ynab.TransactionDetail, cfg *Config) []sp
 		if t.Deleted ||
 			t.Amount == 0 ||
 			t.CategoryId == nil || // Example: credit card payments
-			*t.CategoryId == cfg.SplitCategoryId || // Don't re-split already-split transactions
+			*t.CategoryId == budget.SplitCategoryId || // Don't re-split already-split transactions
+			t.AccountId == budget.IouAccountId || // Don't split what they owe
+			isSplitwiseImport(t) || // Already our share of someone else's expense
 			len(t.Subtransactions) != 0 || // Don't re-split already-split transactions
 			t.Cleared == ynab.Reconciled {
 			continue
@@ -91,6 +419,7 @@ func filterTransactions(transactions []ynab.TransactionDetail, cfg *Config) []sp
 
 		shouldAdd := false
 		theirShare := 0
+		rule := ""
 
 		var flagColor ynab.TransactionFlagColor
 		if t.FlagColor == nil {
@@ -104,6 +433,7 @@ func filterTransactions(transactions []ynab.TransactionDetail, cfg *Config) []sp
 			if len(acctConfig.ExceptFlags) == 0 || !slices.Contains(acctConfig.ExceptFlags, flagColor) {
 				shouldAdd = true
 				theirShare = *acctConfig.DefaultPercentTheirShare
+				rule = fmt.Sprintf("account:%v", acctConfig.Id)
 			}
 		}
 
@@ -111,6 +441,7 @@ func filterTransactions(transactions []ynab.TransactionDetail, cfg *Config) []sp
 		if flagConfig != nil {
 			shouldAdd = true
 			theirShare = *flagConfig.PercentTheirShare
+			rule = fmt.Sprintf("flag:%v", flagConfig.Color)
 		}
 
 		if shouldAdd {
@@ -122,6 +453,7 @@ func filterTransactions(transactions []ynab.TransactionDetail, cfg *Config) []sp
 			filtered = append(filtered, splitTransaction{
 				transaction:   &transactionCopy,
 				pctTheirShare: theirShare,
+				rule:          rule,
 			})
 		}
 	}
@@ -129,7 +461,24 @@ func filterTransactions(transactions []ynab.TransactionDetail, cfg *Config) []sp
 	return filtered
 }
 
-func splitTransactions(transactions []splitTransaction, splitCategoryId uuid.UUID) []ynab.SaveTransactionWithId {
+// theirShareLine returns the subtransaction, without an amount, which holds their share of each split: either in the
+// split category, or a transfer to the IOU account.
+func theirShareLine(ctx context.Context, client ynabClient, budget *BudgetConfig) (ynab.SaveSubTransaction, error) {
+	if budget.IouAccountId == uuid.Nil {
+		splitCategoryId := budget.SplitCategoryId
+		return ynab.SaveSubTransaction{CategoryId: &splitCategoryId}, nil
+	}
+
+	payeeId, err := client.GetTransferPayeeId(ctx, budget.BudgetId, budget.IouAccountId)
+	if err != nil {
+		return ynab.SaveSubTransaction{}, errors.Wrap(err, "failed to find transfer payee of IOU account")
+	}
+	return ynab.SaveSubTransaction{PayeeId: &payeeId}, nil
+}
+
+// splitTransactions builds the updates which split each transaction in two. The first subtransaction of each is our
+// share, in the transaction's original category, and the second is their share, built from theirLine.
+func splitTransactions(transactions []splitTransaction, theirLine ynab.SaveSubTransaction) []ynab.SaveTransactionWithId {
 	split := make([]ynab.SaveTransactionWithId, len(transactions))
 
 	for i, splitTransaction := range transactions {
@@ -171,7 +520,8 @@ func splitTransactions(transactions []splitTransaction, splitCategoryId uuid.UUI
 				},
 				{
 					Amount:     theirShare,
-					CategoryId: &splitCategoryId,
+					CategoryId: theirLine.CategoryId,
+					PayeeId:    theirLine.PayeeId,
 				},
 			},
 		}
@@ -179,3 +529,11 @@ func splitTransactions(transactions []splitTransaction, splitCategoryId uuid.UUI
 
 	return split
 }
+
+// theirShareOf returns the amount of a split built by splitTransactions which was assigned to the other person.
+func theirShareOf(split ynab.SaveTransactionWithId) int64 {
+	if split.Subtransactions == nil || len(*split.Subtransactions) < 2 {
+		return 0
+	}
+	return (*split.Subtransactions)[1].Amount
+}
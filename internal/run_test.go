@@ -1,12 +1,17 @@
 package internal
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/google/uuid"
+	"github.com/samshadwell/split-ynab/internal/storage"
 	"github.com/samshadwell/split-ynab/internal/ynab"
+	"go.uber.org/zap"
 )
 
 func int64Less(a, b int64) bool {
@@ -21,13 +26,15 @@ func TestFilterTransactions(t *testing.T) {
 	categoryId := uuid.New()
 	splitAcctId1 := uuid.New()
 	splitAcctId2 := uuid.New()
+	iouAcctId := uuid.New()
 
 	splitCategory := uuid.New()
 	twenty := 20
 	thirty := 30
 	fifty := 50
-	cfg := Config{
+	budget := BudgetConfig{
 		SplitCategoryId: splitCategory,
+		IouAccountId:    iouAcctId,
 		Accounts: []accountConfig{
 			{Id: splitAcctId1, DefaultPercentTheirShare: &twenty},
 			{Id: splitAcctId2, DefaultPercentTheirShare: &thirty, ExceptFlags: []ynab.TransactionFlagColor{ynab.TransactionFlagColorRed}},
@@ -42,10 +49,12 @@ func TestFilterTransactions(t *testing.T) {
 	greenFlag := ynab.TransactionFlagColorGreen
 	purpleFlag := ynab.TransactionFlagColorPurple
 	redFlag := ynab.TransactionFlagColorRed
+	splitwiseImportId := "SPLITWISE:1234"
 
 	type testCase struct {
 		shouldKeep     bool
 		wantTheirShare int
+		wantRule       string
 		transaction    ynab.TransactionDetail
 	}
 	testCases := []testCase{
@@ -53,6 +62,7 @@ func TestFilterTransactions(t *testing.T) {
 		{
 			shouldKeep:     true,
 			wantTheirShare: 20,
+			wantRule:       "account:" + splitAcctId1.String(),
 			transaction: ynab.TransactionDetail{
 				Id:         "00000000-0000-0000-0000-000000000001",
 				AccountId:  splitAcctId1,
@@ -64,6 +74,7 @@ func TestFilterTransactions(t *testing.T) {
 		{
 			shouldKeep:     true,
 			wantTheirShare: 50,
+			wantRule:       "flag:blue",
 			transaction: ynab.TransactionDetail{
 				Id:         "00000000-0000-0000-0000-000000000002",
 				AccountId:  splitAcctId1,
@@ -87,6 +98,7 @@ func TestFilterTransactions(t *testing.T) {
 		{
 			shouldKeep:     true,
 			wantTheirShare: 30,
+			wantRule:       "account:" + splitAcctId2.String(),
 			transaction: ynab.TransactionDetail{
 				Id:         "00000000-0000-0000-0000-000000000004",
 				AccountId:  splitAcctId2,
@@ -109,6 +121,7 @@ func TestFilterTransactions(t *testing.T) {
 		{
 			shouldKeep:     true,
 			wantTheirShare: 50,
+			wantRule:       "flag:blue",
 			transaction: ynab.TransactionDetail{
 				Id:         "00000000-0000-0000-0000-000000000006",
 				AccountId:  uuid.New(),
@@ -121,6 +134,7 @@ func TestFilterTransactions(t *testing.T) {
 		{
 			shouldKeep:     true,
 			wantTheirShare: 30,
+			wantRule:       "flag:purple",
 			transaction: ynab.TransactionDetail{
 				Id:         "00000000-0000-0000-0000-000000000007",
 				AccountId:  uuid.New(),
@@ -184,16 +198,39 @@ func TestFilterTransactions(t *testing.T) {
 				Cleared:    ynab.Reconciled,
 			},
 		},
+		// In the IOU account, even with an included flag
+		{
+			shouldKeep: false,
+			transaction: ynab.TransactionDetail{
+				Id:         "00000000-0000-0000-0000-00000000000d",
+				AccountId:  iouAcctId,
+				FlagColor:  &blueFlag,
+				Amount:     -10_000,
+				CategoryId: &categoryId,
+			},
+		},
+		// Imported from Splitwise, even in a split account
+		{
+			shouldKeep: false,
+			transaction: ynab.TransactionDetail{
+				Id:         "00000000-0000-0000-0000-00000000000e",
+				AccountId:  splitAcctId1,
+				Amount:     -10_000,
+				CategoryId: &categoryId,
+				ImportId:   &splitwiseImportId,
+			},
+		},
 	}
 
 	type idTheirSharePairs struct {
 		Id            string
 		PctTheirShare int
+		Rule          string
 	}
 	want := make([]idTheirSharePairs, 0)
 	for _, tc := range testCases {
 		if tc.shouldKeep {
-			want = append(want, idTheirSharePairs{tc.transaction.Id, tc.wantTheirShare})
+			want = append(want, idTheirSharePairs{tc.transaction.Id, tc.wantTheirShare, tc.wantRule})
 		}
 	}
 
@@ -202,10 +239,10 @@ func TestFilterTransactions(t *testing.T) {
 		transactions[i] = tc.transaction
 	}
 
-	got := filterTransactions(transactions, &cfg)
+	got := filterTransactions(transactions, &budget)
 	gotPairs := make([]idTheirSharePairs, len(got))
 	for i, t := range got {
-		gotPairs[i] = idTheirSharePairs{t.transaction.Id, t.pctTheirShare}
+		gotPairs[i] = idTheirSharePairs{t.transaction.Id, t.pctTheirShare, t.rule}
 	}
 
 	if diff := cmp.Diff(want, gotPairs); diff != "" {
@@ -240,7 +277,7 @@ func TestSplitTransactionsEvenSplit(t *testing.T) {
 			},
 		}
 
-		got := splitTransactions(originalTransactions, splitCategory)
+		got := splitTransactions(originalTransactions, ynab.SaveSubTransaction{CategoryId: &splitCategory})
 		if len(got) != 1 {
 			t.Fatalf("want 1 transaction, got %d", len(got))
 		}
@@ -289,7 +326,7 @@ func TestSplitTransactionsUnevenSplit(t *testing.T) {
 		},
 	}
 
-	got := splitTransactions(originalTransactions, splitCategory)
+	got := splitTransactions(originalTransactions, ynab.SaveSubTransaction{CategoryId: &splitCategory})
 
 	var gotTheirAmount, gotOurAmount int64
 	for i, sub := range *got[0].Subtransactions {
@@ -328,7 +365,7 @@ func TestSplitTransactionsUnevenSplitWithRemainder(t *testing.T) {
 		},
 	}
 
-	got := splitTransactions(originalTransactions, splitCategory)
+	got := splitTransactions(originalTransactions, ynab.SaveSubTransaction{CategoryId: &splitCategory})
 
 	var gotTheirAmount, gotOurAmount int64
 	for i, sub := range *got[0].Subtransactions {
@@ -355,3 +392,122 @@ func TestSplitTransactionsUnevenSplitWithRemainder(t *testing.T) {
 		t.Fatalf("want total amount to be -10_010, got %d", gotTheirAmount+gotOurAmount)
 	}
 }
+
+// fakeTransferClient knows the transfer payee of each account in transferPayees. Other client methods aren't used by
+// these tests.
+type fakeTransferClient struct {
+	ynabClient
+	transferPayees map[uuid.UUID]uuid.UUID
+}
+
+func (f *fakeTransferClient) GetTransferPayeeId(
+	ctx context.Context,
+	budgetId uuid.UUID,
+	accountId uuid.UUID,
+) (uuid.UUID, error) {
+	payeeId, ok := f.transferPayees[accountId]
+	if !ok {
+		return uuid.Nil, errors.New("account not found")
+	}
+	return payeeId, nil
+}
+
+func TestTheirShareLineIouAccount(t *testing.T) {
+	iouAcctId := uuid.New()
+	transferPayeeId := uuid.New()
+	categoryId := uuid.New()
+	budget := &BudgetConfig{BudgetId: uuid.New(), IouAccountId: iouAcctId}
+	client := &fakeTransferClient{transferPayees: map[uuid.UUID]uuid.UUID{iouAcctId: transferPayeeId}}
+
+	theirLine, err := theirShareLine(context.Background(), client, budget)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if theirLine.CategoryId != nil || theirLine.PayeeId == nil || *theirLine.PayeeId != transferPayeeId {
+		t.Fatalf("want their share to be a transfer to the IOU account, got %+v", theirLine)
+	}
+
+	got := splitTransactions([]splitTransaction{
+		{
+			transaction:   &ynab.TransactionDetail{Id: uuid.New().String(), Amount: -10_000, CategoryId: &categoryId},
+			pctTheirShare: 50,
+		},
+	}, theirLine)
+	theirs := (*got[0].Subtransactions)[1]
+	if theirs.CategoryId != nil || theirs.PayeeId == nil || *theirs.PayeeId != transferPayeeId {
+		t.Errorf("want their subtransaction to be a transfer to the IOU account, got %+v", theirs)
+	}
+
+	budget.IouAccountId = uuid.New()
+	if _, err := theirShareLine(context.Background(), client, budget); err == nil {
+		t.Errorf("want error when the IOU account's transfer payee can't be found, got nil")
+	}
+}
+
+func TestRunCursorKeepsServerKnowledgeOnTransientFailure(t *testing.T) {
+	t.Chdir(t.TempDir())
+	accountId := uuid.New()
+	categoryId := uuid.New()
+	splitCategoryId := uuid.New()
+	fifty := 50
+	budget := &BudgetConfig{
+		BudgetId:        uuid.New(),
+		SplitCategoryId: splitCategoryId,
+		Accounts:        []accountConfig{{Id: accountId, DefaultPercentTheirShare: &fifty}},
+	}
+	transactions := []ynab.TransactionDetail{
+		{Id: "split", AccountId: accountId, Amount: -10_000, CategoryId: &categoryId},
+		{Id: "failed", AccountId: accountId, Amount: -20_000, CategoryId: &categoryId},
+	}
+
+	tests := []struct {
+		name      string
+		client    *fakeUpdateClient
+		wantStore bool
+	}{
+		{"rejected", &fakeUpdateClient{rejected: map[string]bool{"failed": true}}, true},
+		{"unavailable", &fakeUpdateClient{unavailable: map[string]bool{"failed": true}}, false},
+	}
+	for _, tt := range tests {
+		tt.client.transactions = make(map[string]ynab.TransactionDetail)
+		for _, tr := range transactions {
+			tt.client.transactions[tr.Id] = tr
+		}
+		var stored []int64
+		c := cursor{
+			name: "test",
+			get: func(ctx context.Context) (int64, error) {
+				return 10, nil
+			},
+			set: func(ctx context.Context, serverKnowledge int64) error {
+				stored = append(stored, serverKnowledge)
+				return nil
+			},
+			fetch: func(ctx context.Context, serverKnowledge int64, since time.Time) ([]ynab.TransactionDetail, int64, error) {
+				return transactions, 20, nil
+			},
+		}
+		r := &budgetRun{
+			cfg:            &Config{},
+			budget:         budget,
+			storageAdapter: storage.NewLocalStorageAdapter(),
+			client:         tt.client,
+			theirLine:      ynab.SaveSubTransaction{CategoryId: &splitCategoryId},
+			result:         newRunResult(budget.BudgetId, RunKindIncremental),
+		}
+
+		if err := r.runCursor(context.Background(), zap.NewNop(), c); err != nil {
+			t.Fatalf("%v: want nil error, got %v", tt.name, err)
+		}
+		if r.result.Split != 1 || r.result.Failed != 1 {
+			t.Errorf("%v: want 1 split and 1 failed, got %d and %d", tt.name, r.result.Split, r.result.Failed)
+		}
+		if tt.wantStore {
+			if diff := cmp.Diff([]int64{20}, stored); diff != "" {
+				t.Errorf("%v: want the new server knowledge stored. Diff (-want +got):\n%s", tt.name, diff)
+			}
+		} else if len(stored) != 0 || r.result.ServerKnowledgeAfter != 10 {
+			t.Errorf("%v: want server knowledge left at 10 so the failure is retried, stored %v", tt.name, stored)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The shortest interval allowed between scheduled runs, to stay well within YNAB's rate limit.
+const minScheduleInterval = time.Minute
+
+// How far ahead to look for the next time matching a cron expression. Any valid expression matches within this, except
+// for impossible dates like February 30th.
+const cronSearchYears = 5
+
+// schedule decides when `serve` runs.
+type schedule interface {
+	// next returns the first time strictly after t to run, or the zero time if there is none
+	next(t time.Time) time.Time
+}
+
+// intervalSchedule runs every interval, starting from the end of the previous run.
+type intervalSchedule time.Duration
+
+func (s intervalSchedule) next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+// cronSchedule runs at the times matching a standard five-field cron expression, in the local time zone.
+type cronSchedule struct {
+	// Bit i of each field is set if value i matches
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	// Whether the day of month or day of week was "*". Cron matches a day if either field does, unless one of them is
+	// "*", in which case only the other is used
+	dayOfMonthAny, dayOfWeekAny bool
+}
+
+// Shorthands for common cron expressions.
+var cronMacros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// parseCron parses a cron expression with five fields: minute, hour, day of month, month, and day of week. Each field
+// is "*", a value, a range like "1-5", or a list of these separated by commas, optionally followed by a step like "/15".
+// Sunday is 0 or 7. The macros @hourly, @daily, @weekly, and @monthly are also accepted.
+func parseCron(expr string) (*cronSchedule, error) {
+	if macro, ok := cronMacros[strings.TrimSpace(expr)]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression must have 5 fields, got %d: %q", len(fields), expr)
+	}
+
+	s := &cronSchedule{
+		dayOfMonthAny: fields[2] == "*",
+		dayOfWeekAny:  fields[4] == "*",
+	}
+	bounds := []struct {
+		name     string
+		min, max int
+		bits     *uint64
+	}{
+		{"minute", 0, 59, &s.minute},
+		{"hour", 0, 23, &s.hour},
+		{"day of month", 1, 31, &s.dayOfMonth},
+		{"month", 1, 12, &s.month},
+		{"day of week", 0, 7, &s.dayOfWeek},
+	}
+	for i, b := range bounds {
+		bits, err := parseCronField(fields[i], b.min, b.max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %v in cron expression %q: %w", b.name, expr, err)
+		}
+		*b.bits = bits
+	}
+
+	// Sunday may be written as 7
+	if s.dayOfWeek&(1<<7) != 0 {
+		s.dayOfWeek |= 1
+	}
+	return s, nil
+}
+
+func parseCronField(field string, min int, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+		}
+
+		low, high := min, max
+		if rangePart != "*" {
+			lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			low, err = strconv.Atoi(lowPart)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", lowPart)
+			}
+			high = low
+			if isRange {
+				high, err = strconv.Atoi(highPart)
+				if err != nil {
+					return 0, fmt.Errorf("invalid value %q", highPart)
+				}
+			} else if hasStep {
+				// "5/15" means every 15 starting at 5
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("%q is out of range %d-%d", rangePart, min, max)
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (s *cronSchedule) next(t time.Time) time.Time {
+	// Cron has minute resolution, so start from the next whole minute
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(cronSearchYears, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<int(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<t.Hour()) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<t.Minute()) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *cronSchedule) matchesDay(t time.Time) bool {
+	dayOfMonth := s.dayOfMonth&(1<<t.Day()) != 0
+	dayOfWeek := s.dayOfWeek&(1<<int(t.Weekday())) != 0
+	switch {
+	case s.dayOfMonthAny:
+		return dayOfWeek
+	case s.dayOfWeekAny:
+		return dayOfMonth
+	default:
+		return dayOfMonth || dayOfWeek
+	}
+}
+
+// newSchedule returns the schedule described by the config, which must have been validated.
+func (s *scheduleConfig) newSchedule() (schedule, error) {
+	if s.Cron != "" {
+		return parseCron(s.Cron)
+	}
+	return intervalSchedule(s.Interval), nil
+}
+
+func (s *scheduleConfig) validate() error {
+	if (s.Cron == "") == (s.Interval == 0) {
+		return fmt.Errorf("exactly one of `cron` and `interval` must be set")
+	}
+	if s.Cron != "" {
+		_, err := parseCron(s.Cron)
+		return err
+	}
+	if s.Interval < minScheduleInterval {
+		return fmt.Errorf("`interval` must be at least %v: %v", minScheduleInterval, s.Interval)
+	}
+	return nil
+}
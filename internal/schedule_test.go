@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	// A Sunday
+	start := time.Date(2026, 10, 18, 9, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 10, 18, 9, 31, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2026, 10, 18, 9, 40, 0, 0, time.UTC)},
+		{"5/15 * * * *", time.Date(2026, 10, 18, 9, 35, 0, 0, time.UTC)},
+		{"0 8-10 * * *", time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)},
+		{"0 7 * * *", time.Date(2026, 10, 19, 7, 0, 0, 0, time.UTC)},
+		{"0 7 * * 1-5", time.Date(2026, 10, 19, 7, 0, 0, 0, time.UTC)},
+		{"0 7 * * 6", time.Date(2026, 10, 24, 7, 0, 0, 0, time.UTC)},
+		{"30 9 * * 7", time.Date(2026, 10, 25, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 1 *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Either the day of month or the day of week may match
+		{"0 12 25 * 3", time.Date(2026, 10, 21, 12, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := parseCron(tt.expr)
+		if err != nil {
+			t.Errorf("%q: want nil error, got %v", tt.expr, err)
+			continue
+		}
+		if got := s.next(start); !got.Equal(tt.want) {
+			t.Errorf("%q: want next run at %v, got %v", tt.expr, tt.want, got)
+		}
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"@yearly",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("%q: want error, got nil", expr)
+		}
+	}
+}
+
+func TestScheduleConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  scheduleConfig
+		wantErr bool
+	}{
+		{"cron", scheduleConfig{Cron: "0 * * * *"}, false},
+		{"interval", scheduleConfig{Interval: 30 * time.Minute}, false},
+		{"neither", scheduleConfig{}, true},
+		{"both", scheduleConfig{Cron: "0 * * * *", Interval: time.Hour}, true},
+		{"invalid cron", scheduleConfig{Cron: "every hour"}, true},
+		{"short interval", scheduleConfig{Interval: time.Second}, true},
+	}
+	for _, tt := range tests {
+		err := tt.config.validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: want error %v, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package internal
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"go.uber.org/zap"
+)
+
+// How often to check whether the config file has changed.
+const configPollInterval = 10 * time.Second
+
+// How long to wait for API requests in progress to finish when stopping. Runs started by a request are always waited
+// for, even past this.
+const apiShutdownTimeout = 30 * time.Second
+
+// runGroup tracks the runs started through the API, so Serve can wait for them to finish before returning.
+type runGroup struct {
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// add records that a run is starting, and reports false if the group is closed, in which case it must not start.
+func (g *runGroup) add() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return false
+	}
+	g.wg.Add(1)
+	return true
+}
+
+// done records that a run started by add has finished.
+func (g *runGroup) done() {
+	g.wg.Done()
+}
+
+// closeAndWait stops any more runs from starting, and waits for those in progress to finish.
+func (g *runGroup) closeAndWait() {
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+	g.wg.Wait()
+}
+
+// server holds the state of a long-lived process started by Serve.
+type server struct {
+	configPath string
+	// Guards cfg and nextRun, which the API reads
+	mu       sync.Mutex
+	cfg      *Config
+	nextRun  time.Time
+	schedule schedule
+	// The modification time and size of the config file when it was last loaded, to notice when it changes
+	configModTime time.Time
+	configSize    int64
+}
+
+// Serve runs every configured budget on the schedule in the config file at configPath, until ctx is done. A run which
+// is in progress when ctx is done is finished first. The config file is reloaded whenever it changes. If the new config
+// is invalid, the error is logged and the previous config is kept. Every run uses the same storageAdapter. If the
+// config sets `api`, the HTTP API is served until ctx is done too, and runs it started are also finished first.
+func Serve(ctx context.Context, logger *zap.Logger, configPath string, storageAdapter storage.StorageAdapter) error {
+	s := &server{configPath: configPath}
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	if api := s.config().Api; api != nil {
+		stopApi, err := s.serveApi(logger, storageAdapter, api)
+		if err != nil {
+			return err
+		}
+		defer stopApi()
+	}
+
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	for {
+		next := s.schedule.next(time.Now())
+		if next.IsZero() {
+			return errors.New("`schedule` never matches a time to run")
+		}
+		s.mu.Lock()
+		s.nextRun = next
+		s.mu.Unlock()
+		logger.Info("waiting for next run", zap.Time("next", next))
+
+		if !s.wait(ctx, logger, ticker.C, next) {
+			logger.Info("stopping")
+			return nil
+		}
+		if time.Now().Before(next) {
+			// The config changed, so the schedule may have too
+			continue
+		}
+
+		// Finish the run even if asked to stop partway through, so the stored server knowledge and ledger stay in
+		// step with what was split
+		_, err := Run(context.WithoutCancel(ctx), logger, s.config(), storageAdapter)
+		if err != nil {
+			logger.Error("run failed", zap.Error(err))
+		}
+		if ctx.Err() != nil {
+			logger.Info("stopping")
+			return nil
+		}
+	}
+}
+
+// wait blocks until next, or until the config file changes, and reports true. If ctx is done first, it reports false.
+func (s *server) wait(ctx context.Context, logger *zap.Logger, poll <-chan time.Time, next time.Time) bool {
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-timer.C:
+			return true
+		case <-poll:
+			if s.reloadIfChanged(logger) {
+				return true
+			}
+		}
+	}
+}
+
+// reloadIfChanged reloads the config file if it has changed since it was last loaded, and reports whether the new
+// config is now in use.
+func (s *server) reloadIfChanged(logger *zap.Logger) bool {
+	info, err := os.Stat(s.configPath)
+	if err != nil {
+		logger.Warn("failed to check config file for changes", zap.Error(err))
+		return false
+	}
+	if info.ModTime().Equal(s.configModTime) && info.Size() == s.configSize {
+		return false
+	}
+
+	if err := s.load(); err != nil {
+		// Remember the broken file, so it's only reported once
+		s.configModTime, s.configSize = info.ModTime(), info.Size()
+		logger.Error("failed to reload changed config file, keeping the previous config", zap.Error(err))
+		return false
+	}
+	logger.Info("reloaded changed config file")
+	return true
+}
+
+// load reads and validates the config file, and replaces the current config and schedule with it.
+func (s *server) load() error {
+	f, err := os.Open(s.configPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to open config file")
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	info, err := f.Stat()
+	if err != nil {
+		return errors.Wrap(err, "failed to read config file")
+	}
+	cfg, err := LoadConfig(f)
+	if err != nil {
+		return errors.Wrap(err, "failed to load config")
+	}
+	if cfg.Schedule == nil {
+		return errors.New("`schedule` must be set in the config to serve")
+	}
+	sched, err := cfg.Schedule.newSchedule()
+	if err != nil {
+		return errors.Wrap(err, "invalid `schedule`")
+	}
+
+	s.mu.Lock()
+	s.cfg, s.schedule = cfg, sched
+	s.mu.Unlock()
+	s.configModTime, s.configSize = info.ModTime(), info.Size()
+	return nil
+}
+
+func (s *server) config() *Config {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg
+}
+
+func (s *server) next() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nextRun
+}
+
+// serveApi starts serving the HTTP API in the background, returning a function which stops it.
+func (s *server) serveApi(
+	logger *zap.Logger,
+	storageAdapter storage.StorageAdapter,
+	api *apiConfig,
+) (func(), error) {
+	logger = logger.With(zap.String("address", api.Address))
+	if api.Token == "" {
+		logger.Warn("serving API without a bearer token, anyone who can reach it can trigger runs")
+	}
+
+	listener, err := net.Listen("tcp", api.Address)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to listen for API requests")
+	}
+	runs := &runGroup{}
+	httpServer := &http.Server{
+		Handler:           newApiHandler(logger, storageAdapter, s.config, s.next, runs, api.Token),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		logger.Info("serving API")
+		if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("API server failed", zap.Error(err))
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), apiShutdownTimeout)
+		defer cancel()
+		if err := httpServer.Shutdown(ctx); err != nil {
+			logger.Warn("failed to stop API server cleanly", zap.Error(err))
+		}
+		// Shutdown gives up on requests which take too long, but runs they started must still finish, so the stored
+		// server knowledge and ledger stay in step with what was split
+		logger.Info("waiting for runs started through the API to finish")
+		runs.closeAndWait()
+	}, nil
+}
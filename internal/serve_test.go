@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestServerReloadIfChanged(t *testing.T) {
+	t.Chdir(t.TempDir())
+	base := `---
+ynabToken: "my-fake-token"
+budgetId: "00000000-0000-0000-0000-000000000001"
+splitCategoryId: "00000000-0000-0000-0000-000000000002"
+flags:
+  - color: "orange"
+`
+	write := func(contents string, modTime time.Time) {
+		if err := os.WriteFile("config.yml", []byte(contents), 0o600); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+		if err := os.Chtimes("config.yml", modTime, modTime); err != nil {
+			t.Fatalf("failed to set config modification time: %v", err)
+		}
+	}
+	modTime := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+
+	write(base, modTime)
+	s := &server{configPath: "config.yml"}
+	if err := s.load(); err == nil {
+		t.Fatalf("want error loading config without schedule, got nil")
+	}
+
+	write(base+"schedule:\n  interval: 1h\n", modTime)
+	if err := s.load(); err != nil {
+		t.Fatalf("want nil error loading config, got %v", err)
+	}
+	if s.schedule != intervalSchedule(time.Hour) {
+		t.Fatalf("want hourly interval schedule, got %#v", s.schedule)
+	}
+
+	if s.reloadIfChanged(zap.NewNop()) {
+		t.Errorf("want no reload of unchanged config")
+	}
+
+	modTime = modTime.Add(time.Minute)
+	write(base+"schedule:\n  cron: \"@daily\"\n", modTime)
+	if !s.reloadIfChanged(zap.NewNop()) {
+		t.Fatalf("want reload of changed config")
+	}
+	if _, ok := s.schedule.(*cronSchedule); !ok {
+		t.Fatalf("want cron schedule after reload, got %#v", s.schedule)
+	}
+
+	modTime = modTime.Add(time.Minute)
+	write(base+"schedule:\n  cron: \"whenever\"\n", modTime)
+	if s.reloadIfChanged(zap.NewNop()) {
+		t.Errorf("want no reload of invalid config")
+	}
+	if _, ok := s.schedule.(*cronSchedule); !ok {
+		t.Errorf("want previous schedule kept after invalid config, got %#v", s.schedule)
+	}
+}
+
+func TestRunGroupWaitsForRuns(t *testing.T) {
+	runs := &runGroup{}
+	if !runs.add() {
+		t.Fatal("want run to start before closing")
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		runs.closeAndWait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		t.Fatal("want closeAndWait to block while a run is in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	runs.done()
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("want closeAndWait to return once the run finished")
+	}
+
+	if runs.add() {
+		t.Error("want no run to start once closed")
+	}
+}
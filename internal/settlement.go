@@ -0,0 +1,281 @@
+package internal
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+	"go.uber.org/zap"
+)
+
+// settlementCandidates returns the inflows which match one of the budget's settlement rules and haven't already been
+// recorded against their share.
+func settlementCandidates(transactions []ynab.TransactionDetail, budget *BudgetConfig) []ynab.TransactionDetail {
+	candidates := make([]ynab.TransactionDetail, 0)
+	if len(budget.Settlements) == 0 {
+		return candidates
+	}
+
+	for _, t := range transactions {
+		if t.Deleted ||
+			t.Amount <= 0 ||
+			len(t.Subtransactions) != 0 ||
+			t.TransferAccountId != nil || // Includes repayments already transferred from the IOU account
+			t.AccountId == budget.IouAccountId ||
+			(t.CategoryId != nil && *t.CategoryId == budget.SplitCategoryId) { // Already recorded
+			continue
+		}
+
+		for _, rule := range budget.Settlements {
+			if rule.matches(t) {
+				candidates = append(candidates, t)
+				break
+			}
+		}
+	}
+	return candidates
+}
+
+func (rule *settlementRule) matches(t ynab.TransactionDetail) bool {
+	if rule.AccountId != uuid.Nil && t.AccountId != rule.AccountId {
+		return false
+	}
+	if rule.Payee != "" && (t.PayeeName == nil || !containsFold(*t.PayeeName, rule.Payee)) {
+		return false
+	}
+	if rule.Memo != "" && (t.Memo == nil || !containsFold(*t.Memo, rule.Memo)) {
+		return false
+	}
+	return true
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// settle records each of settlements against their share: in the ledger, by marking the oldest unsettled splits it
+// covers, and in YNAB, by moving it to the split category or making it a transfer from the IOU account. The ledger is
+// written first, since once a repayment is recorded in YNAB it's no longer a candidate, and a repayment missing from
+// the ledger would never be recorded. A settlement which can't be written to the ledger is left alone in YNAB, and
+// reported as failed so the next run tries again.
+func (r *budgetRun) settle(ctx context.Context, logger *zap.Logger, settlements []ynab.TransactionDetail) {
+	if len(settlements) == 0 {
+		return
+	}
+
+	updates := make([]ynab.SaveTransactionWithId, len(settlements))
+	for i, t := range settlements {
+		updates[i] = settlementUpdate(t, r.theirLine)
+	}
+
+	splits, err := r.storageAdapter.ListSplitRecords(ctx, r.budget.BudgetId)
+	var recorded []storage.SettlementRecord
+	if err == nil {
+		recorded, err = r.storageAdapter.ListSettlementRecords(ctx, r.budget.BudgetId)
+	}
+	if err != nil {
+		err = errors.Wrap(err, "failed to read ledger")
+		for i := range settlements {
+			logger.Error("failed to record settlement",
+				zap.String("transactionId", settlements[i].Id),
+				zap.Error(err))
+			r.result.addOutcome(splitTransaction{transaction: &settlements[i], rule: "settlement"}, updates[i],
+				TransactionStatusFailed, err, nil)
+			r.countFailure(err)
+		}
+		return
+	}
+
+	// A run which stopped between writing the covered splits and the settlement record left those splits marked, so
+	// release them to be covered again
+	recordedIds := make(map[string]bool, len(recorded))
+	for _, s := range recorded {
+		recordedIds[s.TransactionId] = true
+	}
+	released := make(map[string][]int)
+	for _, t := range settlements {
+		released[t.Id] = nil
+	}
+	for i := range splits {
+		if _, ok := released[splits[i].SettledBy]; ok && !recordedIds[splits[i].SettledBy] {
+			released[splits[i].SettledBy] = append(released[splits[i].SettledBy], i)
+			splits[i].SettledBy = ""
+		}
+	}
+
+	toUpdate := make([]int, 0, len(settlements))
+	credit := ledgerCredit(splits, recorded)
+	var ledgerErr error
+	for i, t := range settlements {
+		if recordedIds[t.Id] {
+			// An earlier run recorded it in the ledger, but failed to record it in YNAB
+			toUpdate = append(toUpdate, i)
+			continue
+		}
+
+		if ledgerErr == nil {
+			record, covered := coverSplits(splits, credit, t)
+			for _, j := range released[t.Id] {
+				if splits[j].SettledBy == "" {
+					// No longer covered, so store it as unsettled again
+					covered = append(covered, splits[j])
+				}
+			}
+			ledgerErr = r.recordSettlement(ctx, record, covered)
+			if ledgerErr == nil {
+				credit = record.Unapplied
+				toUpdate = append(toUpdate, i)
+				continue
+			}
+		}
+
+		// After a failed write, later repayments are left for the next run too, so they cover splits in order
+		logger.Error("failed to record settlement",
+			zap.String("transactionId", t.Id),
+			zap.Error(ledgerErr))
+		r.result.addOutcome(splitTransaction{transaction: &settlements[i], rule: "settlement"}, updates[i],
+			TransactionStatusFailed, ledgerErr, nil)
+		r.countFailure(ledgerErr)
+	}
+
+	batch := make([]ynab.SaveTransactionWithId, len(toUpdate))
+	for j, i := range toUpdate {
+		batch[j] = updates[i]
+	}
+	results := r.client.UpdateTransactions(ctx, r.budget.BudgetId, batch, r.cfg.UpdateChunkSize)
+	for j, res := range results {
+		i := toUpdate[j]
+		st := splitTransaction{transaction: &settlements[i], rule: "settlement"}
+		if res.Err != nil {
+			// It's in the ledger, so next run only needs to record it in YNAB
+			logger.Error("failed to record settlement",
+				zap.String("transactionId", res.TransactionId),
+				zap.Error(res.Err))
+			r.result.addOutcome(st, updates[i], TransactionStatusFailed, res.Err, nil)
+			r.countFailure(res.Err)
+			continue
+		}
+		r.result.addOutcome(st, updates[i], TransactionStatusSettled, nil, nil)
+	}
+}
+
+// recordSettlement writes a repayment and the splits it changed to the ledger. The splits are written first, so the
+// settlement record is only there once everything it covers is.
+func (r *budgetRun) recordSettlement(
+	ctx context.Context,
+	record storage.SettlementRecord,
+	splits []storage.SplitRecord,
+) error {
+	if len(splits) > 0 {
+		if err := r.storageAdapter.PutSplitRecords(ctx, r.budget.BudgetId, splits); err != nil {
+			return errors.Wrap(err, "failed to mark settled splits in ledger")
+		}
+	}
+	if err := r.storageAdapter.PutSettlementRecord(ctx, r.budget.BudgetId, record); err != nil {
+		return errors.Wrap(err, "failed to record settlement in ledger")
+	}
+	return nil
+}
+
+// settlementUpdate builds the update which records t against their share, using the same category or transfer as the
+// their-share line of each split.
+func settlementUpdate(t ynab.TransactionDetail, theirLine ynab.SaveSubTransaction) ynab.SaveTransactionWithId {
+	id := t.Id
+	payeeId := t.PayeeId
+	if theirLine.PayeeId != nil {
+		payeeId = theirLine.PayeeId
+	}
+	return ynab.SaveTransactionWithId{
+		Id:         &id,
+		PayeeId:    payeeId,
+		CategoryId: theirLine.CategoryId,
+		Memo:       t.Memo,
+		FlagColor:  t.FlagColor,
+		ImportId:   t.ImportId,
+	}
+}
+
+// readLedgerBalance returns the budget's split records, oldest first, and the credit left over from earlier
+// repayments. If the ledger can't be read, the failure is logged and it returns no splits and no credit, so that
+// repayments are still recorded and what they owe stays correct, even if we can't say which splits were covered.
+func readLedgerBalance(
+	ctx context.Context,
+	logger *zap.Logger,
+	storageAdapter storage.StorageAdapter,
+	budgetId uuid.UUID,
+) ([]storage.SplitRecord, int64) {
+	splits, err := storageAdapter.ListSplitRecords(ctx, budgetId)
+	if err != nil {
+		logger.Warn("failed to read ledger, unable to record which splits were settled", zap.Error(err))
+		return nil, 0
+	}
+	settlements, err := storageAdapter.ListSettlementRecords(ctx, budgetId)
+	if err != nil {
+		logger.Warn("failed to read repayments from ledger, ignoring any credit left over from them", zap.Error(err))
+		return splits, 0
+	}
+	return splits, ledgerCredit(splits, settlements)
+}
+
+// ledgerCredit returns how much of the recorded repayments hasn't gone towards covering a split yet: everything
+// repaid, less their share of every settled split. This is the running balance which the next repayment adds to.
+func ledgerCredit(splits []storage.SplitRecord, settlements []storage.SettlementRecord) int64 {
+	var credit int64
+	for _, s := range settlements {
+		credit += s.Amount
+	}
+	for _, s := range splits {
+		if s.SettledBy != "" {
+			// Their share of an expense is negative, so this takes away what the split cost them
+			credit += s.TheirShare
+		}
+	}
+	// Splits may have been settled by repayments which aren't in the ledger, so never count that as a debt
+	return max(credit, 0)
+}
+
+// coverSplits applies a repayment, together with credit left over from earlier repayments, to the oldest unsettled
+// splits in splits, which must be ordered oldest first. Splits are covered in order until the next one would cost more
+// than what's left. Covered splits are updated in place, and also returned so they can be stored. The returned
+// record's Unapplied is the credit left to carry over to the next repayment.
+func coverSplits(
+	splits []storage.SplitRecord,
+	credit int64,
+	t ynab.TransactionDetail,
+) (storage.SettlementRecord, []storage.SplitRecord) {
+	record := storage.SettlementRecord{
+		TransactionId:         t.Id,
+		Date:                  t.Date.String(),
+		AccountName:           t.AccountName,
+		Amount:                t.Amount,
+		CoveredTransactionIds: make([]string, 0),
+		RecordedAt:            time.Now(),
+	}
+	if t.PayeeName != nil {
+		record.PayeeName = *t.PayeeName
+	}
+
+	remaining := credit + t.Amount
+	covered := make([]storage.SplitRecord, 0)
+	for i := range splits {
+		if splits[i].SettledBy != "" {
+			continue
+		}
+		// Their share of an expense is negative, and of a refund positive, so this is what they owe for the split
+		owed := -splits[i].TheirShare
+		if owed > remaining {
+			break
+		}
+		remaining -= owed
+		splits[i].SettledBy = t.Id
+		covered = append(covered, splits[i])
+		record.CoveredTransactionIds = append(record.CoveredTransactionIds, splits[i].TransactionId)
+	}
+	record.Unapplied = remaining
+
+	return record, covered
+}
@@ -0,0 +1,212 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	"github.com/oapi-codegen/runtime/types"
+	"github.com/samshadwell/split-ynab/internal/storage"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+	"go.uber.org/zap"
+)
+
+func TestSettlementCandidates(t *testing.T) {
+	checkingId := uuid.New()
+	splitCategory := uuid.New()
+	otherCategory := uuid.New()
+	venmo := "Venmo Cashout"
+	otherPayee := "Paycheck"
+	memo := "Split for March"
+
+	budget := BudgetConfig{
+		SplitCategoryId: splitCategory,
+		Settlements: []settlementRule{
+			{Payee: "venmo", AccountId: checkingId},
+			{Memo: "split for"},
+		},
+	}
+
+	transactions := []ynab.TransactionDetail{
+		// Matches the first rule
+		{Id: "1", AccountId: checkingId, Amount: 20_000, PayeeName: &venmo},
+		// Right payee, wrong account
+		{Id: "2", AccountId: uuid.New(), Amount: 20_000, PayeeName: &venmo},
+		// Matches the second rule
+		{Id: "3", AccountId: uuid.New(), Amount: 20_000, PayeeName: &otherPayee, Memo: &memo},
+		// Not an inflow
+		{Id: "4", AccountId: checkingId, Amount: -20_000, PayeeName: &venmo},
+		// Already recorded
+		{Id: "5", AccountId: checkingId, Amount: 20_000, PayeeName: &venmo, CategoryId: &splitCategory},
+		// Doesn't match any rule
+		{Id: "6", AccountId: checkingId, Amount: 20_000, PayeeName: &otherPayee, CategoryId: &otherCategory},
+		// Deleted
+		{Id: "7", AccountId: checkingId, Amount: 20_000, PayeeName: &venmo, Deleted: true},
+	}
+
+	got := settlementCandidates(transactions, &budget)
+	gotIds := make([]string, len(got))
+	for i, c := range got {
+		gotIds[i] = c.Id
+	}
+
+	if diff := cmp.Diff([]string{"1", "3"}, gotIds); diff != "" {
+		t.Errorf("settlement candidates did not match expected. Diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestCoverSplits(t *testing.T) {
+	splits := []storage.SplitRecord{
+		{TransactionId: "already-settled", TheirShare: -5_000, SettledBy: "earlier"},
+		{TransactionId: "a", TheirShare: -10_000},
+		{TransactionId: "refund", TheirShare: 2_000},
+		{TransactionId: "b", TheirShare: -10_000},
+		{TransactionId: "c", TheirShare: -10_000},
+	}
+	payment := ynab.TransactionDetail{
+		Id:     "payment",
+		Date:   types.Date{Time: time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)},
+		Amount: 25_000,
+	}
+
+	record, covered := coverSplits(splits, 0, payment)
+
+	if diff := cmp.Diff([]string{"a", "refund", "b"}, record.CoveredTransactionIds); diff != "" {
+		t.Errorf("covered transactions did not match expected. Diff (-want +got):\n%s", diff)
+	}
+	if record.Unapplied != 7_000 {
+		t.Errorf("want 7_000 unapplied, got %d", record.Unapplied)
+	}
+	if len(covered) != 3 {
+		t.Fatalf("want 3 covered splits, got %d", len(covered))
+	}
+	for _, s := range covered {
+		if s.SettledBy != "payment" {
+			t.Errorf("want split %q to be settled by the payment, got %q", s.TransactionId, s.SettledBy)
+		}
+	}
+	if splits[4].SettledBy != "" {
+		t.Errorf("want split which wasn't covered to remain unsettled, got %q", splits[4].SettledBy)
+	}
+}
+
+func TestCoverSplitsCarriesCreditBetweenPartialPayments(t *testing.T) {
+	splits := []storage.SplitRecord{
+		{TransactionId: "a", TheirShare: -50_000},
+		{TransactionId: "b", TheirShare: -50_000},
+	}
+	var settlements []storage.SettlementRecord
+
+	first, covered := coverSplits(splits, ledgerCredit(splits, settlements), ynab.TransactionDetail{Id: "first", Amount: 60_000})
+	settlements = append(settlements, first)
+	if diff := cmp.Diff([]string{"a"}, first.CoveredTransactionIds); diff != "" {
+		t.Errorf("first payment covered transactions did not match expected. Diff (-want +got):\n%s", diff)
+	}
+	if first.Unapplied != 10_000 || len(covered) != 1 {
+		t.Errorf("want first payment to cover 1 split leaving 10_000, got %d splits leaving %d", len(covered), first.Unapplied)
+	}
+	if credit := ledgerCredit(splits, settlements); credit != 10_000 {
+		t.Errorf("want 10_000 credit after first payment, got %d", credit)
+	}
+
+	second, _ := coverSplits(splits, ledgerCredit(splits, settlements), ynab.TransactionDetail{Id: "second", Amount: 40_000})
+	settlements = append(settlements, second)
+	if diff := cmp.Diff([]string{"b"}, second.CoveredTransactionIds); diff != "" {
+		t.Errorf("second payment covered transactions did not match expected. Diff (-want +got):\n%s", diff)
+	}
+	if second.Unapplied != 0 {
+		t.Errorf("want nothing left after second payment, got %d", second.Unapplied)
+	}
+	if credit := ledgerCredit(splits, settlements); credit != 0 {
+		t.Errorf("want no credit after both payments, got %d", credit)
+	}
+	for _, s := range splits {
+		if s.SettledBy == "" {
+			t.Errorf("want split %q to be settled", s.TransactionId)
+		}
+	}
+}
+
+// failingSettlementStorage fails to record settlements while failing is set.
+type failingSettlementStorage struct {
+	storage.StorageAdapter
+	failing bool
+}
+
+func (s *failingSettlementStorage) PutSettlementRecord(
+	ctx context.Context,
+	budgetId uuid.UUID,
+	record storage.SettlementRecord,
+) error {
+	if s.failing {
+		return errors.New("disk full")
+	}
+	return s.StorageAdapter.PutSettlementRecord(ctx, budgetId, record)
+}
+
+func TestSettleWritesLedgerBeforeYnab(t *testing.T) {
+	t.Chdir(t.TempDir())
+	ctx := context.Background()
+	splitCategoryId := uuid.New()
+	budget := &BudgetConfig{BudgetId: uuid.New(), SplitCategoryId: splitCategoryId}
+	payment := ynab.TransactionDetail{Id: "payment", Amount: 50_000}
+	storageAdapter := &failingSettlementStorage{StorageAdapter: storage.NewLocalStorageAdapter(), failing: true}
+	if err := storageAdapter.PutSplitRecords(ctx, budget.BudgetId, []storage.SplitRecord{
+		{TransactionId: "dinner", Date: "2026-03-01", TheirShare: -50_000},
+	}); err != nil {
+		t.Fatalf("want nil error putting split record, got %v", err)
+	}
+	client := &fakeUpdateClient{
+		transactions: map[string]ynab.TransactionDetail{payment.Id: payment},
+		unavailable:  map[string]bool{payment.Id: true},
+	}
+	newRun := func() *budgetRun {
+		return &budgetRun{
+			cfg:            &Config{},
+			budget:         budget,
+			storageAdapter: storageAdapter,
+			client:         client,
+			theirLine:      ynab.SaveSubTransaction{CategoryId: &splitCategoryId},
+			result:         newRunResult(budget.BudgetId, RunKindIncremental),
+		}
+	}
+
+	// The ledger write fails, so it's left alone in YNAB, and the split it covered is released on the next attempt
+	r := newRun()
+	r.settle(ctx, zap.NewNop(), []ynab.TransactionDetail{payment})
+	if r.result.Failed != 1 || r.result.Settled != 0 || r.transientFailures != 1 {
+		t.Errorf("want 1 transient failure when the ledger write fails, got %+v and %d transient",
+			r.result, r.transientFailures)
+	}
+
+	// The ledger write succeeds, but YNAB can't be reached
+	storageAdapter.failing = false
+	r = newRun()
+	r.settle(ctx, zap.NewNop(), []ynab.TransactionDetail{payment})
+	if r.result.Failed != 1 || r.transientFailures != 1 {
+		t.Errorf("want 1 transient failure when YNAB can't be reached, got %+v and %d transient",
+			r.result, r.transientFailures)
+	}
+	settlements, err := storageAdapter.ListSettlementRecords(ctx, budget.BudgetId)
+	if err != nil || len(settlements) != 1 {
+		t.Fatalf("want the settlement recorded in the ledger, got %v and error %v", settlements, err)
+	}
+	if diff := cmp.Diff([]string{"dinner"}, settlements[0].CoveredTransactionIds); diff != "" {
+		t.Errorf("covered transactions did not match expected. Diff (-want +got):\n%s", diff)
+	}
+
+	// Retrying only records it in YNAB, without recording it in the ledger a second time
+	client.unavailable = nil
+	r = newRun()
+	r.settle(ctx, zap.NewNop(), []ynab.TransactionDetail{payment})
+	if r.result.Failed != 0 || r.result.Settled != 1 {
+		t.Errorf("want the retried settlement recorded in YNAB, got %+v", r.result)
+	}
+	settlements, err = storageAdapter.ListSettlementRecords(ctx, budget.BudgetId)
+	if err != nil || len(settlements) != 1 {
+		t.Errorf("want the settlement recorded in the ledger once, got %v and error %v", settlements, err)
+	}
+}
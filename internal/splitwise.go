@@ -0,0 +1,235 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/oapi-codegen/runtime/types"
+	"github.com/pkg/errors"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+	"go.uber.org/zap"
+)
+
+// Prefix of the import ID given to transactions imported from Splitwise. YNAB limits import IDs to 36 characters.
+const splitwiseImportIdPrefix = "SPLITWISE:"
+
+// The leading columns of Splitwise's CSV export. They're followed by a column for each member of the group, holding how
+// each expense changed that member's balance: positive if they're owed money, negative if they owe it.
+var splitwiseCsvHeader = []string{"Date", "Description", "Category", "Cost", "Currency"}
+
+// WriteSplitwiseCSV writes rows to w in the format of Splitwise's group export, as expenses we paid and split with the
+// other person. Amounts are in currency, which should be the budget's.
+func WriteSplitwiseCSV(w io.Writer, rows []ExportRow, splitwise *splitwiseConfig, currency string) error {
+	if splitwise == nil || splitwise.PartnerName == "" {
+		return errors.New("`splitwise` in the config must set `name` and `partnerName` to export")
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(slices.Concat(splitwiseCsvHeader, []string{splitwise.Name, splitwise.PartnerName})); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		// Their share of an expense is negative, and what they owe us is the opposite
+		err := cw.Write([]string{
+			r.Date,
+			r.PayeeName,
+			r.CategoryName,
+			formatMilliunits(-r.Amount),
+			currency,
+			formatMilliunits(-r.TheirShare),
+			formatMilliunits(r.TheirShare),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// splitwiseExpense is an expense from a Splitwise export which someone else paid, at least partly on our behalf.
+type splitwiseExpense struct {
+	Date        time.Time
+	Description string
+	Category    string
+	Cost        Milliunits
+	// How much of the expense we owe, which is positive
+	OurShare Milliunits
+	// How many identical expenses come before this one in the export, so that each gets its own import ID
+	Occurrence int
+}
+
+// key identifies e by its contents, which identical expenses share.
+func (e splitwiseExpense) key() string {
+	return fmt.Sprintf("%v|%v|%v|%v", e.Date.Format(time.DateOnly), e.Description, int64(e.Cost), int64(e.OurShare))
+}
+
+// importId returns the import ID of the transaction recording e, which is the same each time e is imported. Exports
+// list a group's whole history in the same order each time, so Occurrence is stable too.
+func (e splitwiseExpense) importId() string {
+	return hashedImportId(splitwiseImportIdPrefix, e.key(), e.Occurrence)
+}
+
+// hashedImportId returns an import ID of at most 36 characters, YNAB's limit, made of prefix and a hash of key. The
+// first occurrence of key is hashed on its own, and later ones with their occurrence, like YNAB's own import IDs.
+func hashedImportId(prefix string, key string, occurrence int) string {
+	if occurrence > 0 {
+		key = fmt.Sprintf("%v|%d", key, occurrence)
+	}
+	sum := sha256.Sum256([]byte(key))
+	return prefix + hex.EncodeToString(sum[:])[:36-len(prefix)]
+}
+
+// parseSplitwiseCSV reads a Splitwise group export, returning the expenses in which we, the member with the given name,
+// owe money. Payments between members and the closing total balance are skipped.
+func parseSplitwiseCSV(r io.Reader, name string) ([]splitwiseExpense, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read Splitwise CSV")
+	}
+	if len(records) == 0 {
+		return nil, errors.New("Splitwise CSV is empty")
+	}
+
+	header := records[0]
+	if len(header) <= len(splitwiseCsvHeader) {
+		return nil, errors.Errorf("Splitwise CSV header has no member columns: %v", header)
+	}
+	ourColumn := -1
+	for i := len(splitwiseCsvHeader); i < len(header); i++ {
+		if strings.EqualFold(strings.TrimSpace(header[i]), name) {
+			ourColumn = i
+			break
+		}
+	}
+	if ourColumn == -1 {
+		return nil, errors.Errorf("no column for %q in Splitwise CSV, found %v", name, header[len(splitwiseCsvHeader):])
+	}
+
+	expenses := make([]splitwiseExpense, 0)
+	occurrences := make(map[string]int)
+	for line, record := range records[1:] {
+		if len(record) <= ourColumn {
+			continue
+		}
+		description := strings.TrimSpace(record[1])
+		category := strings.TrimSpace(record[2])
+		if description == "Total balance" || strings.EqualFold(category, "Payment") {
+			continue
+		}
+
+		date, err := time.Parse(time.DateOnly, strings.TrimSpace(record[0]))
+		if err != nil {
+			return nil, errors.Errorf("invalid date on line %d of Splitwise CSV: %q", line+2, record[0])
+		}
+		cost, err := parseMilliunits(strings.TrimSpace(record[3]))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid cost on line %d of Splitwise CSV", line+2)
+		}
+		ours, err := parseMilliunits(strings.TrimSpace(record[ourColumn]))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid amount for %v on line %d of Splitwise CSV", name, line+2)
+		}
+		if ours >= 0 {
+			// We paid, so the expense is already in our budget
+			continue
+		}
+
+		e := splitwiseExpense{
+			Date:        date,
+			Description: description,
+			Category:    category,
+			Cost:        cost,
+			OurShare:    -ours,
+		}
+		e.Occurrence = occurrences[e.key()]
+		occurrences[e.key()]++
+		expenses = append(expenses, e)
+	}
+	return expenses, nil
+}
+
+// isSplitwiseImport reports whether t was created by importing from Splitwise.
+func isSplitwiseImport(t ynab.TransactionDetail) bool {
+	return t.ImportId != nil && strings.HasPrefix(*t.ImportId, splitwiseImportIdPrefix)
+}
+
+// splitwiseTransaction builds the transaction recording our share of e. Our share is taken from the mapped category,
+// the reverse of a split, and the account's balance goes down by what we owe.
+func splitwiseTransaction(e splitwiseExpense, splitwise *splitwiseConfig) ynab.SaveTransaction {
+	categoryId := splitwise.DefaultCategoryId
+	if mapped, ok := splitwise.Categories[e.Category]; ok {
+		categoryId = &mapped
+	}
+
+	memo := fmt.Sprintf("Splitwise: our share of %v", e.Cost)
+	return ourShareTransaction(splitwise.AccountId, types.Date{Time: e.Date}, e.Description, memo, categoryId,
+		int64(e.OurShare), e.importId())
+}
+
+// ImportSplitwise reads a Splitwise group export from r, and creates a transaction in the given budget for our share
+// of each expense someone else paid. Importing the same expense again doesn't create a duplicate. If dryRun is set,
+// the transactions are logged instead of created.
+func ImportSplitwise(
+	ctx context.Context,
+	logger *zap.Logger,
+	budget *BudgetConfig,
+	r io.Reader,
+	dryRun bool,
+) (*ImportResult, error) {
+	splitwise := budget.Splitwise
+	if splitwise == nil || splitwise.AccountId == uuid.Nil {
+		return nil, errors.New("`splitwise` in the config must set `name` and `accountId` to import")
+	}
+
+	expenses, err := parseSplitwiseCSV(r, splitwise.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := ynab.NewYnabAdapter(logger, budget.YnabToken)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to construct client")
+	}
+
+	result := &ImportResult{}
+	for _, e := range expenses {
+		t := splitwiseTransaction(e, splitwise)
+		logger := logger.With(
+			zap.String("date", e.Date.Format(time.DateOnly)),
+			zap.String("description", e.Description),
+			zap.Int64("ourShare", int64(e.OurShare)))
+		if dryRun {
+			logger.Info("would create transaction for Splitwise expense")
+			result.Created++
+			continue
+		}
+
+		_, err := client.CreateTransaction(ctx, budget.BudgetId, t)
+		switch {
+		case errors.Is(err, ynab.ErrDuplicateImportId):
+			result.Duplicates++
+		case err != nil:
+			logger.Error("failed to create transaction for Splitwise expense", zap.Error(err))
+			result.Failed++
+		default:
+			logger.Info("created transaction for Splitwise expense")
+			result.Created++
+		}
+	}
+
+	if result.Failed > 0 {
+		return result, errors.Errorf("failed to import %d of %d expenses", result.Failed, len(expenses))
+	}
+	return result, nil
+}
@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+)
+
+const splitwiseExport = `Date,Description,Category,Cost,Currency,Sam,Alex,Jo
+2026-09-01,Cabin,Rent,300.00,USD,-100.00,200.00,-100.00
+2026-09-02,Groceries,Groceries,60.00,USD,40.00,-20.00,-20.00
+2026-09-03,Settle up,Payment,100.00,USD,100.00,-100.00,0.00
+2026-09-04,Dinner,Dining out,45.50,USD,-15.17,-15.16,30.33
+
+2026-09-05,Total balance, , ,USD,24.83,64.84,-89.67
+`
+
+func TestParseSplitwiseCSV(t *testing.T) {
+	got, err := parseSplitwiseCSV(strings.NewReader(splitwiseExport), "sam")
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	want := []splitwiseExpense{
+		{Date: time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC), Description: "Cabin", Category: "Rent", Cost: 300_000, OurShare: 100_000},
+		{Date: time.Date(2026, 9, 4, 0, 0, 0, 0, time.UTC), Description: "Dinner", Category: "Dining out", Cost: 45_500, OurShare: 15_170},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("parsed expenses did not match expected. Diff (-want +got):\n%s", diff)
+	}
+
+	_, err = parseSplitwiseCSV(strings.NewReader(splitwiseExport), "Nobody")
+	if err == nil {
+		t.Errorf("want error for a name not in the group, got nil")
+	}
+}
+
+func TestSplitwiseTransaction(t *testing.T) {
+	dining := uuid.New()
+	splitwise := &splitwiseConfig{
+		Name:       "Sam",
+		AccountId:  uuid.New(),
+		Categories: map[string]uuid.UUID{"Dining out": dining},
+	}
+	expense := splitwiseExpense{
+		Date:        time.Date(2026, 9, 4, 0, 0, 0, 0, time.UTC),
+		Description: "Dinner",
+		Category:    "Dining out",
+		Cost:        45_500,
+		OurShare:    15_170,
+	}
+
+	got := splitwiseTransaction(expense, splitwise)
+	if *got.Amount != -15_170 || *got.CategoryId != dining || *got.AccountId != splitwise.AccountId {
+		t.Errorf("want -15.17 in dining from the Splitwise account, got %d in %v from %v", *got.Amount, *got.CategoryId, *got.AccountId)
+	}
+	if len(*got.ImportId) > 36 || *got.ImportId != *splitwiseTransaction(expense, splitwise).ImportId {
+		t.Errorf("want a stable import ID of at most 36 characters, got %q", *got.ImportId)
+	}
+
+	expense.Category = "Unmapped"
+	if got := splitwiseTransaction(expense, splitwise); got.CategoryId != nil {
+		t.Errorf("want unmapped category to be left uncategorized, got %v", *got.CategoryId)
+	}
+}
+
+func TestWriteSplitwiseCSV(t *testing.T) {
+	rows := []ExportRow{{Date: "2026-09-02", PayeeName: "Trader Joe's", CategoryName: "Groceries", Amount: -30_000, TheirShare: -15_000}}
+
+	var b strings.Builder
+	err := WriteSplitwiseCSV(&b, rows, &splitwiseConfig{Name: "Sam", PartnerName: "Alex"}, "USD")
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	want := "Date,Description,Category,Cost,Currency,Sam,Alex\n" +
+		"2026-09-02,Trader Joe's,Groceries,30.00,USD,15.00,-15.00\n"
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Errorf("Splitwise CSV did not match expected. Diff (-want +got):\n%s", diff)
+	}
+
+	// Exporting the result back in as the other person finds what they owe
+	expenses, err := parseSplitwiseCSV(strings.NewReader(b.String()), "Alex")
+	if err != nil || len(expenses) != 1 || expenses[0].OurShare != 15_000 {
+		t.Errorf("want round trip to find 15.00 owed by Alex, got %+v and %v", expenses, err)
+	}
+}
+
+func TestSplitwiseIdenticalExpenses(t *testing.T) {
+	export := `Date,Description,Category,Cost,Currency,Sam,Alex
+2026-09-04,Coffee,Dining out,8.00,USD,-4.00,4.00
+2026-09-04,Coffee,Dining out,8.00,USD,-4.00,4.00
+`
+	got, err := parseSplitwiseCSV(strings.NewReader(export), "Sam")
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if len(got) != 2 || got[0].Occurrence != 0 || got[1].Occurrence != 1 {
+		t.Fatalf("want two expenses numbered 0 and 1, got %+v", got)
+	}
+
+	splitwise := &splitwiseConfig{Name: "Sam", AccountId: uuid.New()}
+	first, second := splitwiseTransaction(got[0], splitwise), splitwiseTransaction(got[1], splitwise)
+	if *first.ImportId == *second.ImportId {
+		t.Errorf("want identical expenses to get different import IDs, both got %q", *first.ImportId)
+	}
+	if len(*second.ImportId) > 36 {
+		t.Errorf("want import ID of at most 36 characters, got %q", *second.ImportId)
+	}
+}
@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samshadwell/split-ynab/internal/storage"
+)
+
+// Statement lists the transactions split in a single month, for sharing with the other person. Amounts are in YNAB
+// milliunits, and are positive for spending and for what they owe.
+type Statement struct {
+	Budget string
+	// The month covered, e.g. "2026-09"
+	Month string
+	Lines []StatementLine
+	// Their share of every transaction in the month
+	Total int64
+}
+
+// StatementLine is a single split transaction in a statement.
+type StatementLine struct {
+	Date       string
+	Payee      string
+	Category   string
+	Amount     int64
+	TheirShare int64
+	// Their share of this and every earlier transaction in the month
+	RunningTotal int64
+}
+
+// BuildStatement builds the statement of the given budget's split transactions dated in the month containing month,
+// from the ledger.
+func BuildStatement(
+	ctx context.Context,
+	budget *BudgetConfig,
+	storageAdapter storage.StorageAdapter,
+	month time.Time,
+) (*Statement, error) {
+	splits, err := storageAdapter.ListSplitRecords(ctx, budget.BudgetId)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read split transactions from ledger")
+	}
+	return newStatement(budget, month, splits), nil
+}
+
+func newStatement(budget *BudgetConfig, month time.Time, splits []storage.SplitRecord) *Statement {
+	s := &Statement{
+		Budget: budget.displayName(),
+		Month:  month.Format(monthFormat),
+		Lines:  make([]StatementLine, 0),
+	}
+
+	inStatement := slices.DeleteFunc(slices.Clone(splits), func(split storage.SplitRecord) bool {
+		return !inMonth(split.Date, s.Month)
+	})
+	slices.SortStableFunc(inStatement, func(a, b storage.SplitRecord) int {
+		return cmp.Compare(a.Date, b.Date)
+	})
+
+	for _, split := range inStatement {
+		s.Total += -split.TheirShare
+		s.Lines = append(s.Lines, StatementLine{
+			Date:         split.Date,
+			Payee:        split.PayeeName,
+			Category:     split.CategoryName,
+			Amount:       -split.Amount,
+			TheirShare:   -split.TheirShare,
+			RunningTotal: s.Total,
+		})
+	}
+	return s
+}
+
+// WriteMarkdown writes the statement to w as a Markdown table.
+func (s *Statement) WriteMarkdown(w io.Writer) error {
+	escape := strings.NewReplacer("|", `\|`, "\n", " ")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Shared expenses for %v\n\n", s.Month)
+	if len(s.Lines) == 0 {
+		fmt.Fprintln(&b, "No shared expenses this month.")
+	} else {
+		fmt.Fprintln(&b, "| Date | Payee | Category | Total | Your share | Running total |")
+		fmt.Fprintln(&b, "| --- | --- | --- | ---: | ---: | ---: |")
+		for _, l := range s.Lines {
+			fmt.Fprintf(&b, "| %v | %v | %v | %v | %v | %v |\n",
+				l.Date,
+				escape.Replace(l.Payee),
+				escape.Replace(l.Category),
+				formatMilliunits(l.Amount),
+				formatMilliunits(l.TheirShare),
+				formatMilliunits(l.RunningTotal))
+		}
+	}
+	fmt.Fprintf(&b, "\n**Total: %v**\n", formatMilliunits(s.Total))
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteHTML writes the statement to w as a standalone HTML page, with no external stylesheets or scripts.
+func (s *Statement) WriteHTML(w io.Writer) error {
+	return statementTemplate.Execute(w, s)
+}
+
+var statementTemplate = template.Must(template.New("statement").
+	Funcs(template.FuncMap{"money": formatMilliunits}).
+	Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Shared expenses for {{.Month}}</title>
+<style>
+  body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2rem auto; max-width: 56rem; padding: 0 1rem; color: #222; }
+  table { border-collapse: collapse; width: 100%; }
+  th, td { padding: 0.4rem 0.6rem; border-bottom: 1px solid #ddd; text-align: left; }
+  th { background: #f5f5f5; }
+  .amount { text-align: right; font-variant-numeric: tabular-nums; white-space: nowrap; }
+  tfoot td { font-weight: bold; border-bottom: none; }
+</style>
+</head>
+<body>
+<h1>Shared expenses for {{.Month}}</h1>
+{{- if .Lines}}
+<table>
+<thead>
+<tr><th>Date</th><th>Payee</th><th>Category</th><th class="amount">Total</th><th class="amount">Your share</th><th class="amount">Running total</th></tr>
+</thead>
+<tbody>
+{{- range .Lines}}
+<tr><td>{{.Date}}</td><td>{{.Payee}}</td><td>{{.Category}}</td><td class="amount">{{money .Amount}}</td><td class="amount">{{money .TheirShare}}</td><td class="amount">{{money .RunningTotal}}</td></tr>
+{{- end}}
+</tbody>
+<tfoot>
+<tr><td colspan="4">Total</td><td class="amount">{{money .Total}}</td><td></td></tr>
+</tfoot>
+</table>
+{{- else}}
+<p>No shared expenses this month.</p>
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	"github.com/samshadwell/split-ynab/internal/storage"
+)
+
+func TestNewStatement(t *testing.T) {
+	splits := []storage.SplitRecord{
+		{Date: "2026-09-05", PayeeName: "Pizza | Pasta", CategoryName: "Restaurants", Amount: -60_000, TheirShare: -30_000},
+		{Date: "2026-08-31", PayeeName: "Trader Joe's", CategoryName: "Groceries", Amount: -10_000, TheirShare: -5_000},
+		{Date: "2026-09-02", PayeeName: "<Market>", CategoryName: "Groceries", Amount: -20_000, TheirShare: -10_000},
+		{Date: "2026-09-06", PayeeName: "Refund", CategoryName: "Groceries", Amount: 4_000, TheirShare: 2_000},
+	}
+
+	got := newStatement(&BudgetConfig{BudgetId: uuid.New()}, time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC), splits)
+
+	want := []StatementLine{
+		{Date: "2026-09-02", Payee: "<Market>", Category: "Groceries", Amount: 20_000, TheirShare: 10_000, RunningTotal: 10_000},
+		{Date: "2026-09-05", Payee: "Pizza | Pasta", Category: "Restaurants", Amount: 60_000, TheirShare: 30_000, RunningTotal: 40_000},
+		{Date: "2026-09-06", Payee: "Refund", Category: "Groceries", Amount: -4_000, TheirShare: -2_000, RunningTotal: 38_000},
+	}
+	if diff := cmp.Diff(want, got.Lines); diff != "" {
+		t.Errorf("statement lines did not match expected. Diff (-want +got):\n%s", diff)
+	}
+	if got.Total != 38_000 {
+		t.Errorf("want total of 38.00, got %v", formatMilliunits(got.Total))
+	}
+
+	var markdown strings.Builder
+	if err := got.WriteMarkdown(&markdown); err != nil {
+		t.Fatalf("want nil error writing markdown, got %v", err)
+	}
+	if !strings.Contains(markdown.String(), `| 2026-09-05 | Pizza \| Pasta | Restaurants | 60.00 | 30.00 | 40.00 |`) {
+		t.Errorf("want markdown to contain escaped row, got:\n%s", markdown.String())
+	}
+
+	var html strings.Builder
+	if err := got.WriteHTML(&html); err != nil {
+		t.Fatalf("want nil error writing HTML, got %v", err)
+	}
+	if !strings.Contains(html.String(), "&lt;Market&gt;") {
+		t.Errorf("want HTML to escape payee names, got:\n%s", html.String())
+	}
+}
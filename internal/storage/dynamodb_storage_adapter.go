@@ -2,7 +2,10 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
@@ -12,6 +15,29 @@ import (
 	"go.uber.org/zap"
 )
 
+// Name of the global secondary index used to list the items in a collection, e.g. run records, in order.
+// See deployments/aws/aws.go for its definition.
+const collectionIndexName = "byCollection"
+
+const (
+	collectionAttribute = "collection"
+	sortKeyAttribute    = "sortKey"
+	// DynamoDB deletes items once the time in this attribute, in seconds since the epoch, has passed
+	expiresAtAttribute = "expiresAt"
+	ownerAttribute     = "owner"
+
+	runsCollection = "RUNS"
+
+	sortableTimeFormat = "2006-01-02T15:04:05.000000000Z"
+)
+
+const (
+	// The largest item DynamoDB will store
+	maxItemSize = 400 * 1024
+	// Run records are kept a little under maxItemSize, in case itemSize is off
+	maxRunRecordSize = maxItemSize - 10*1024
+)
+
 type dynamoDbStorageAdapter struct {
 	client    dynamodb.Client
 	logger    *zap.Logger
@@ -33,7 +59,41 @@ func NewDynamoDbStorageAdapter(logger *zap.Logger, awsConfig *aws.Config, tableN
 func (d *dynamoDbStorageAdapter) GetLastServerKnowledge(ctx context.Context, budgetId uuid.UUID) (int64, error) {
 	d.logger.Info("getting last server knowledge from DynamoDB",
 		zap.String("budgetId", budgetId.String()))
-	key := serverKnowledgeKey(budgetId)
+	return d.getServerKnowledge(ctx, serverKnowledgeKey(budgetId))
+}
+
+func (d *dynamoDbStorageAdapter) SetLastServerKnowledge(ctx context.Context, budgetId uuid.UUID, serverKnowledge int64) error {
+	d.logger.Info("setting last server knowledge in DynamoDB",
+		zap.String("budgetId", budgetId.String()),
+		zap.Int64("lastServerKnowledge", serverKnowledge))
+	return d.setServerKnowledge(ctx, serverKnowledgeKey(budgetId), serverKnowledge)
+}
+
+func (d *dynamoDbStorageAdapter) GetAccountServerKnowledge(
+	ctx context.Context,
+	budgetId uuid.UUID,
+	accountId uuid.UUID,
+) (int64, error) {
+	d.logger.Info("getting account server knowledge from DynamoDB",
+		zap.String("budgetId", budgetId.String()),
+		zap.String("accountId", accountId.String()))
+	return d.getServerKnowledge(ctx, accountServerKnowledgeKey(budgetId, accountId))
+}
+
+func (d *dynamoDbStorageAdapter) SetAccountServerKnowledge(
+	ctx context.Context,
+	budgetId uuid.UUID,
+	accountId uuid.UUID,
+	serverKnowledge int64,
+) error {
+	d.logger.Info("setting account server knowledge in DynamoDB",
+		zap.String("budgetId", budgetId.String()),
+		zap.String("accountId", accountId.String()),
+		zap.Int64("lastServerKnowledge", serverKnowledge))
+	return d.setServerKnowledge(ctx, accountServerKnowledgeKey(budgetId, accountId), serverKnowledge)
+}
+
+func (d *dynamoDbStorageAdapter) getServerKnowledge(ctx context.Context, key *map[string]types.AttributeValue) (int64, error) {
 	response, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: &d.tableName,
 		Key:       *key,
@@ -42,6 +102,9 @@ func (d *dynamoDbStorageAdapter) GetLastServerKnowledge(ctx context.Context, bud
 	if err != nil {
 		return 0, fmt.Errorf("failed to get last server knowledge: %w", err)
 	}
+	if len(response.Item) == 0 {
+		return 0, ErrNotFound
+	}
 
 	responseDoc := ServerKnowledgeDocument{}
 	err = attributevalue.UnmarshalMap(response.Item, &responseDoc)
@@ -53,21 +116,32 @@ func (d *dynamoDbStorageAdapter) GetLastServerKnowledge(ctx context.Context, bud
 	return int64(responseDoc.LastServerKnowledge), nil
 }
 
-func (d *dynamoDbStorageAdapter) SetLastServerKnowledge(ctx context.Context, budgetId uuid.UUID, serverKnowledge int64) error {
-	d.logger.Info("setting last server knowledge in DynamoDB",
-		zap.String("budgetId", budgetId.String()),
-		zap.Int64("lastServerKnowledge", serverKnowledge))
-
-	item := *serverKnowledgeKey(budgetId)
+func (d *dynamoDbStorageAdapter) setServerKnowledge(
+	ctx context.Context,
+	key *map[string]types.AttributeValue,
+	serverKnowledge int64,
+) error {
+	item := *key
 	item["lastServerKnowledge"] = &types.AttributeValueMemberN{
 		Value: fmt.Sprintf("%d", serverKnowledge),
 	}
 
 	_, err := d.client.PutItem(ctx, &dynamodb.PutItemInput{
-		TableName: &d.tableName,
-		Item:      item,
+		TableName:           &d.tableName,
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(#lastServerKnowledge) OR #lastServerKnowledge <= :serverKnowledge"),
+		ExpressionAttributeNames: map[string]string{
+			"#lastServerKnowledge": "lastServerKnowledge",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":serverKnowledge": item["lastServerKnowledge"],
+		},
 	})
 
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return ErrServerKnowledgeRegression
+	}
 	if err != nil {
 		return fmt.Errorf("failed to put item: %w", err)
 	}
@@ -76,6 +150,15 @@ func (d *dynamoDbStorageAdapter) SetLastServerKnowledge(ctx context.Context, bud
 	return nil
 }
 
+func accountServerKnowledgeKey(budgetId uuid.UUID, accountId uuid.UUID) *map[string]types.AttributeValue {
+	key := fmt.Sprintf("%v#%v#SERVER_KNOWLEDGE", budgetId, accountId)
+	return &map[string]types.AttributeValue{
+		"key": &types.AttributeValueMemberS{
+			Value: key,
+		},
+	}
+}
+
 func serverKnowledgeKey(budgetId uuid.UUID) *map[string]types.AttributeValue {
 	key := fmt.Sprintf("%v#SERVER_KNOWLEDGE", budgetId)
 	return &map[string]types.AttributeValue{
@@ -84,3 +167,478 @@ func serverKnowledgeKey(budgetId uuid.UUID) *map[string]types.AttributeValue {
 		},
 	}
 }
+
+func (d *dynamoDbStorageAdapter) AppendRunRecord(ctx context.Context, record RunRecord) error {
+	d.logger.Info("appending run record in DynamoDB", zap.String("runId", record.RunId.String()))
+
+	item, omitted, err := runRecordItem(record)
+	if err != nil {
+		return err
+	}
+	if omitted > 0 {
+		d.logger.Warn("run record is too large for DynamoDB, leaving out some transaction outcomes",
+			zap.Int("omitted", omitted),
+			zap.Int("transactions", len(record.Transactions)))
+	}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: &d.tableName,
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put item: %w", err)
+	}
+
+	d.logger.Info("successfully appended run record in DynamoDB")
+	return nil
+}
+
+// runRecordItem builds the item storing record. If it would be larger than maxRunRecordSize, transaction outcomes are
+// left out, keeping failed and mismatched ones first since they're what someone looking at the run needs, and listing
+// them first. The number left out is stored in TransactionsOmitted and returned.
+func runRecordItem(record RunRecord) (map[string]types.AttributeValue, int, error) {
+	item, err := runRecordItemWith(record, record.Transactions)
+	if err != nil {
+		return nil, 0, err
+	}
+	if itemSize(item) <= maxRunRecordSize {
+		return item, 0, nil
+	}
+
+	outcomes := make([]TransactionRecord, 0, len(record.Transactions))
+	for _, t := range record.Transactions {
+		if t.Error != "" || len(t.Mismatches) > 0 {
+			outcomes = append(outcomes, t)
+		}
+	}
+	for _, t := range record.Transactions {
+		if t.Error == "" && len(t.Mismatches) == 0 {
+			outcomes = append(outcomes, t)
+		}
+	}
+
+	// Measure what's left with every outcome omitted, then add outcomes back while they fit
+	record.TransactionsOmitted = len(outcomes)
+	base, err := runRecordItemWith(record, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	size := itemSize(base)
+	kept := 0
+	for _, t := range outcomes {
+		outcome, err := marshalRecord(t)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to marshal transaction record: %w", err)
+		}
+		size += 1 + attributeSize(&types.AttributeValueMemberM{Value: outcome})
+		if size > maxRunRecordSize {
+			break
+		}
+		kept++
+	}
+
+	record.TransactionsOmitted = len(outcomes) - kept
+	item, err = runRecordItemWith(record, outcomes[:kept])
+	if err != nil {
+		return nil, 0, err
+	}
+	return item, record.TransactionsOmitted, nil
+}
+
+func runRecordItemWith(record RunRecord, transactions []TransactionRecord) (map[string]types.AttributeValue, error) {
+	if transactions == nil {
+		transactions = make([]TransactionRecord, 0)
+	}
+	record.Transactions = transactions
+	item, err := marshalRecord(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal run record: %w", err)
+	}
+	for k, v := range *runRecordKey(record.RunId) {
+		item[k] = v
+	}
+	item[collectionAttribute] = &types.AttributeValueMemberS{Value: runsCollection}
+	item[sortKeyAttribute] = &types.AttributeValueMemberS{Value: timeSortKey(record.StartedAt, record.RunId.String())}
+	item[expiresAtAttribute] = &types.AttributeValueMemberN{
+		Value: fmt.Sprintf("%d", record.StartedAt.Add(runRecordRetention).Unix()),
+	}
+	return item, nil
+}
+
+// itemSize returns an item's size as DynamoDB counts it against maxItemSize: the length of each attribute's name and
+// value. Numbers are counted at their largest, so this never underestimates.
+func itemSize(item map[string]types.AttributeValue) int {
+	size := 0
+	for name, v := range item {
+		size += len(name) + attributeSize(v)
+	}
+	return size
+}
+
+func attributeSize(v types.AttributeValue) int {
+	switch v := v.(type) {
+	case *types.AttributeValueMemberS:
+		return len(v.Value)
+	case *types.AttributeValueMemberN:
+		return 21
+	case *types.AttributeValueMemberB:
+		return len(v.Value)
+	case *types.AttributeValueMemberBOOL, *types.AttributeValueMemberNULL:
+		return 1
+	case *types.AttributeValueMemberSS:
+		size := 0
+		for _, s := range v.Value {
+			size += len(s)
+		}
+		return size
+	case *types.AttributeValueMemberNS:
+		return 21 * len(v.Value)
+	case *types.AttributeValueMemberL:
+		size := 3
+		for _, e := range v.Value {
+			size += 1 + attributeSize(e)
+		}
+		return size
+	case *types.AttributeValueMemberM:
+		size := 3
+		for name, e := range v.Value {
+			size += 1 + len(name) + attributeSize(e)
+		}
+		return size
+	default:
+		panic(fmt.Sprintf("programmer error, unknown attribute value type %T", v))
+	}
+}
+
+func (d *dynamoDbStorageAdapter) ListRunRecords(ctx context.Context, limit int) ([]RunRecord, error) {
+	items, err := d.queryCollection(ctx, runsCollection, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]RunRecord, len(items))
+	for i, item := range items {
+		if err := unmarshalRecord(item, &records[i]); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal run record: %w", err)
+		}
+	}
+	return records, nil
+}
+
+func (d *dynamoDbStorageAdapter) GetRunRecord(ctx context.Context, runId uuid.UUID) (*RunRecord, error) {
+	response, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: &d.tableName,
+		Key:       *runRecordKey(runId),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get run record: %w", err)
+	}
+	if len(response.Item) == 0 {
+		return nil, ErrNotFound
+	}
+
+	record := RunRecord{}
+	if err := unmarshalRecord(response.Item, &record); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal run record: %w", err)
+	}
+	return &record, nil
+}
+
+func (d *dynamoDbStorageAdapter) PutSplitRecords(ctx context.Context, budgetId uuid.UUID, records []SplitRecord) error {
+	d.logger.Info("putting split records in DynamoDB",
+		zap.String("budgetId", budgetId.String()),
+		zap.Int("count", len(records)))
+
+	for _, r := range records {
+		err := d.putLedgerRecord(ctx, r, ledgerKey(budgetId, "SPLIT", r.TransactionId),
+			ledgerCollection(budgetId, "SPLITS"), ledgerSortKey(r.Date, r.TransactionId))
+		if err != nil {
+			return fmt.Errorf("failed to put split record: %w", err)
+		}
+	}
+
+	d.logger.Info("successfully put split records in DynamoDB")
+	return nil
+}
+
+func (d *dynamoDbStorageAdapter) ListSplitRecords(ctx context.Context, budgetId uuid.UUID) ([]SplitRecord, error) {
+	items, err := d.queryCollection(ctx, ledgerCollection(budgetId, "SPLITS"), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]SplitRecord, len(items))
+	for i, item := range items {
+		if err := unmarshalRecord(item, &records[i]); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal split record: %w", err)
+		}
+	}
+	// Collections are returned newest first
+	slices.Reverse(records)
+	return records, nil
+}
+
+func (d *dynamoDbStorageAdapter) PutSettlementRecord(ctx context.Context, budgetId uuid.UUID, record SettlementRecord) error {
+	d.logger.Info("putting settlement record in DynamoDB",
+		zap.String("budgetId", budgetId.String()),
+		zap.String("transactionId", record.TransactionId))
+
+	err := d.putLedgerRecord(ctx, record, ledgerKey(budgetId, "SETTLEMENT", record.TransactionId),
+		ledgerCollection(budgetId, "SETTLEMENTS"), ledgerSortKey(record.Date, record.TransactionId))
+	if err != nil {
+		return fmt.Errorf("failed to put settlement record: %w", err)
+	}
+
+	d.logger.Info("successfully put settlement record in DynamoDB")
+	return nil
+}
+
+func (d *dynamoDbStorageAdapter) ListSettlementRecords(ctx context.Context, budgetId uuid.UUID) ([]SettlementRecord, error) {
+	items, err := d.queryCollection(ctx, ledgerCollection(budgetId, "SETTLEMENTS"), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]SettlementRecord, len(items))
+	for i, item := range items {
+		if err := unmarshalRecord(item, &records[i]); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal settlement record: %w", err)
+		}
+	}
+	slices.Reverse(records)
+	return records, nil
+}
+
+// putLedgerRecord stores a ledger record under key, in the given collection. Unlike run records, ledger records
+// never expire.
+func (d *dynamoDbStorageAdapter) putLedgerRecord(
+	ctx context.Context,
+	record any,
+	key *map[string]types.AttributeValue,
+	collection string,
+	sortKey string,
+) error {
+	item, err := marshalRecord(record)
+	if err != nil {
+		return err
+	}
+	for k, v := range *key {
+		item[k] = v
+	}
+	item[collectionAttribute] = &types.AttributeValueMemberS{Value: collection}
+	item[sortKeyAttribute] = &types.AttributeValueMemberS{Value: sortKey}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: &d.tableName,
+		Item:      item,
+	})
+	return err
+}
+
+func ledgerKey(budgetId uuid.UUID, kind string, transactionId string) *map[string]types.AttributeValue {
+	return &map[string]types.AttributeValue{
+		"key": &types.AttributeValueMemberS{
+			Value: fmt.Sprintf("%v#%v#%v", budgetId, kind, transactionId),
+		},
+	}
+}
+
+func ledgerCollection(budgetId uuid.UUID, kind string) string {
+	return fmt.Sprintf("%v#%v", budgetId, kind)
+}
+
+// ledgerSortKey orders ledger records by their transaction's date, using its ID to break ties.
+func ledgerSortKey(date string, transactionId string) string {
+	return fmt.Sprintf("%v#%v", date, transactionId)
+}
+
+// queryCollection returns up to limit items in the given collection, newest first. A limit of zero or less returns
+// every item.
+func (d *dynamoDbStorageAdapter) queryCollection(
+	ctx context.Context,
+	collection string,
+	limit int,
+) ([]map[string]types.AttributeValue, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              &d.tableName,
+		IndexName:              aws.String(collectionIndexName),
+		KeyConditionExpression: aws.String("#collection = :collection"),
+		ExpressionAttributeNames: map[string]string{
+			"#collection": collectionAttribute,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":collection": &types.AttributeValueMemberS{Value: collection},
+		},
+		ScanIndexForward: aws.Bool(false),
+	}
+
+	items := make([]map[string]types.AttributeValue, 0)
+	paginator := dynamodb.NewQueryPaginator(&d.client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query %v: %w", collection, err)
+		}
+		items = append(items, page.Items...)
+		if limit > 0 && len(items) >= limit {
+			return items[:limit], nil
+		}
+	}
+	return items, nil
+}
+
+func runRecordKey(runId uuid.UUID) *map[string]types.AttributeValue {
+	return &map[string]types.AttributeValue{
+		"key": &types.AttributeValueMemberS{
+			Value: fmt.Sprintf("RUN#%v", runId),
+		},
+	}
+}
+
+// timeSortKey builds a sort key which orders items by time, using id to break ties. Times are formatted with a fixed
+// width so they sort lexicographically.
+func timeSortKey(t time.Time, id string) string {
+	return fmt.Sprintf("%v#%v", t.UTC().Format(sortableTimeFormat), id)
+}
+
+// Records are stored using the same attribute names as their JSON representation.
+func marshalRecord(record any) (map[string]types.AttributeValue, error) {
+	return attributevalue.MarshalMapWithOptions(record, func(o *attributevalue.EncoderOptions) {
+		o.TagKey = "json"
+	})
+}
+
+func unmarshalRecord(item map[string]types.AttributeValue, out any) error {
+	return attributevalue.UnmarshalMapWithOptions(item, out, func(o *attributevalue.DecoderOptions) {
+		o.TagKey = "json"
+	})
+}
+
+func (d *dynamoDbStorageAdapter) AcquireLock(ctx context.Context, budgetId uuid.UUID, owner string, lease time.Duration) error {
+	d.logger.Info("acquiring lock in DynamoDB",
+		zap.String("budgetId", budgetId.String()),
+		zap.String("owner", owner),
+		zap.Duration("lease", lease))
+
+	now := time.Now()
+	item := *lockKey(budgetId)
+	item[ownerAttribute] = &types.AttributeValueMemberS{Value: owner}
+	// Doubles as the lock's TTL, so DynamoDB cleans up locks which are never released
+	item[expiresAtAttribute] = &types.AttributeValueMemberN{
+		Value: fmt.Sprintf("%d", now.Add(lease).Unix()),
+	}
+
+	// DynamoDB doesn't delete expired items immediately, so treat an expired lease the same as a missing lock
+	_, err := d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           &d.tableName,
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(#key) OR #expiresAt < :now OR #owner = :owner"),
+		ExpressionAttributeNames: map[string]string{
+			"#key":       "key",
+			"#expiresAt": expiresAtAttribute,
+			"#owner":     ownerAttribute,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now":   &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", now.Unix())},
+			":owner": &types.AttributeValueMemberS{Value: owner},
+		},
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return ErrLockHeld
+	}
+	if err != nil {
+		return fmt.Errorf("failed to put lock: %w", err)
+	}
+
+	d.logger.Info("successfully acquired lock in DynamoDB")
+	return nil
+}
+
+func (d *dynamoDbStorageAdapter) ReleaseLock(ctx context.Context, budgetId uuid.UUID, owner string) error {
+	d.logger.Info("releasing lock in DynamoDB",
+		zap.String("budgetId", budgetId.String()),
+		zap.String("owner", owner))
+
+	_, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           &d.tableName,
+		Key:                 *lockKey(budgetId),
+		ConditionExpression: aws.String("#owner = :owner"),
+		ExpressionAttributeNames: map[string]string{
+			"#owner": ownerAttribute,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":owner": &types.AttributeValueMemberS{Value: owner},
+		},
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return fmt.Errorf("lock is no longer held by %v, its lease may have expired", owner)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete lock: %w", err)
+	}
+
+	d.logger.Info("successfully released lock in DynamoDB")
+	return nil
+}
+
+func lockKey(budgetId uuid.UUID) *map[string]types.AttributeValue {
+	return &map[string]types.AttributeValue{
+		"key": &types.AttributeValueMemberS{
+			Value: fmt.Sprintf("%v#LOCK", budgetId),
+		},
+	}
+}
+
+func (d *dynamoDbStorageAdapter) ClaimMarker(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	item := *markerKey(name)
+	item[expiresAtAttribute] = &types.AttributeValueMemberN{
+		Value: fmt.Sprintf("%d", now.Add(ttl).Unix()),
+	}
+
+	// DynamoDB doesn't delete expired items immediately, so treat an expired marker the same as a missing one
+	_, err := d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           &d.tableName,
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(#key) OR #expiresAt < :now"),
+		ExpressionAttributeNames: map[string]string{
+			"#key":       "key",
+			"#expiresAt": expiresAtAttribute,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", now.Unix())},
+		},
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to put marker: %w", err)
+	}
+	return true, nil
+}
+
+func (d *dynamoDbStorageAdapter) DeleteMarker(ctx context.Context, name string) error {
+	_, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: &d.tableName,
+		Key:       *markerKey(name),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete marker: %w", err)
+	}
+	return nil
+}
+
+func markerKey(name string) *map[string]types.AttributeValue {
+	return &map[string]types.AttributeValue{
+		"key": &types.AttributeValueMemberS{
+			Value: fmt.Sprintf("MARKER#%v", name),
+		},
+	}
+}
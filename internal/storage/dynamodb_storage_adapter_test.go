@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+)
+
+func TestRunRecordItem(t *testing.T) {
+	record := RunRecord{
+		RunId:     uuid.New(),
+		BudgetId:  uuid.New(),
+		StartedAt: time.Now().Truncate(time.Second),
+		Split:     1,
+		Transactions: []TransactionRecord{
+			{TransactionId: "t1", Amount: -10_000, TheirShare: -5_000, Status: "split"},
+		},
+	}
+
+	item, omitted, err := runRecordItem(record)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if omitted != 0 {
+		t.Errorf("want nothing omitted from a small run, got %d", omitted)
+	}
+	var got RunRecord
+	if err := unmarshalRecord(item, &got); err != nil {
+		t.Fatalf("want nil error unmarshalling run record, got %v", err)
+	}
+	if diff := cmp.Diff(record, got); diff != "" {
+		t.Errorf("stored run mismatch (-want +got):\n%v", diff)
+	}
+}
+
+func TestRunRecordItemSizeLimit(t *testing.T) {
+	record := RunRecord{RunId: uuid.New(), BudgetId: uuid.New(), StartedAt: time.Now()}
+	payee := strings.Repeat("p", 200)
+	const total = 5_000
+	for i := range total {
+		tr := TransactionRecord{
+			TransactionId: uuid.New().String(),
+			Date:          "2026-10-18",
+			AccountName:   "Checking",
+			PayeeName:     payee,
+			Amount:        -10_000,
+			TheirShare:    -5_000,
+			Rule:          "flag:blue",
+			Status:        "split",
+		}
+		if i%1_000 == 999 {
+			tr.Status = "failed"
+			tr.Error = fmt.Sprintf("failed to update transaction %d", i)
+		}
+		record.Transactions = append(record.Transactions, tr)
+	}
+	if item, _ := runRecordItemWith(record, record.Transactions); itemSize(item) <= maxItemSize {
+		t.Fatalf("want test run larger than DynamoDB's item size limit, got %d bytes", itemSize(item))
+	}
+
+	item, omitted, err := runRecordItem(record)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if size := itemSize(item); size > maxRunRecordSize {
+		t.Errorf("want item within %d bytes, got %d", maxRunRecordSize, size)
+	}
+
+	var got RunRecord
+	if err := unmarshalRecord(item, &got); err != nil {
+		t.Fatalf("want nil error unmarshalling run record, got %v", err)
+	}
+	if omitted == 0 || got.TransactionsOmitted != omitted || len(got.Transactions)+omitted != total {
+		t.Errorf("want omitted outcomes counted, got %d kept and %d omitted (%d stored)",
+			len(got.Transactions), omitted, got.TransactionsOmitted)
+	}
+	for i, tr := range got.Transactions[:total/1_000] {
+		if tr.Status != "failed" {
+			t.Errorf("want failed outcomes kept first, got %q at %d", tr.Status, i)
+		}
+	}
+}
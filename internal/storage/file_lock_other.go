@@ -0,0 +1,16 @@
+//go:build !unix
+
+package storage
+
+import "os"
+
+// lockFileExclusive is a no-op on platforms without flock. Runs in separate processes are not protected from each
+// other, but runs within this process still are.
+func lockFileExclusive(f *os.File) error {
+	return nil
+}
+
+// lockFileWait is a no-op on platforms without flock, like lockFileExclusive.
+func lockFileWait(f *os.File) error {
+	return nil
+}
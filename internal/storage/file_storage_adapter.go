@@ -2,107 +2,519 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"gopkg.in/yaml.v3"
 )
 
-type localStorageAdapter struct{}
+type localStorageAdapter struct {
+	// Guards reading and writing the storage files, since several budgets may be processed at once. Other processes
+	// sharing the files are kept out by withFileLock.
+	filesMu sync.Mutex
+	mu      sync.Mutex
+	// Open lock files, keyed by budget. Closing the file releases the lock.
+	locks map[uuid.UUID]*os.File
+}
 
-const storageFile = "storage.yml"
+const (
+	storageFile = "storage.yml"
+	runsFile    = "runs.yml"
+	ledgerFile  = "ledger.yml"
+	markersFile = "markers.yml"
+)
 
 type budgetData struct {
-	BudgetId            uuid.UUID `yaml:"budgetId"`
+	BudgetId            uuid.UUID     `yaml:"budgetId"`
+	LastServerKnowledge int64         `yaml:"lastServerKnowledge"`
+	Accounts            []accountData `yaml:"accounts,omitempty"`
+}
+
+type accountData struct {
+	AccountId           uuid.UUID `yaml:"accountId"`
 	LastServerKnowledge int64     `yaml:"lastServerKnowledge"`
 }
 
+type ledgerData struct {
+	BudgetId    uuid.UUID          `yaml:"budgetId"`
+	Splits      []SplitRecord      `yaml:"splits,omitempty"`
+	Settlements []SettlementRecord `yaml:"settlements,omitempty"`
+}
+
+type markerData struct {
+	Name      string    `yaml:"name"`
+	ExpiresAt time.Time `yaml:"expiresAt"`
+}
+
 // Creates a StorageAdapter which stores data in a yaml file. Intended mostly for prototyping or running in environments
 // without "proper" KV storage mechanisms.
 func NewLocalStorageAdapter() StorageAdapter {
-	return &localStorageAdapter{}
+	return &localStorageAdapter{
+		locks: make(map[uuid.UUID]*os.File),
+	}
 }
 
 func (l *localStorageAdapter) GetLastServerKnowledge(ctx context.Context, budgetId uuid.UUID) (int64, error) {
-	data, err := l.readData()
+	budget, err := l.findBudget(budgetId)
 	if err != nil {
 		return 0, err
 	}
+	return budget.LastServerKnowledge, nil
+}
+
+func (l *localStorageAdapter) SetLastServerKnowledge(ctx context.Context, budgetId uuid.UUID, serverKnowledge int64) error {
+	return l.updateBudget(budgetId, func(budget *budgetData) error {
+		if budget.LastServerKnowledge > serverKnowledge {
+			return ErrServerKnowledgeRegression
+		}
+		budget.LastServerKnowledge = serverKnowledge
+		return nil
+	})
+}
+
+func (l *localStorageAdapter) GetAccountServerKnowledge(
+	ctx context.Context,
+	budgetId uuid.UUID,
+	accountId uuid.UUID,
+) (int64, error) {
+	budget, err := l.findBudget(budgetId)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, a := range budget.Accounts {
+		if a.AccountId == accountId {
+			return a.LastServerKnowledge, nil
+		}
+	}
+	return 0, ErrNotFound
+}
+
+func (l *localStorageAdapter) SetAccountServerKnowledge(
+	ctx context.Context,
+	budgetId uuid.UUID,
+	accountId uuid.UUID,
+	serverKnowledge int64,
+) error {
+	return l.updateBudget(budgetId, func(budget *budgetData) error {
+		for i, a := range budget.Accounts {
+			if a.AccountId == accountId {
+				if a.LastServerKnowledge > serverKnowledge {
+					return ErrServerKnowledgeRegression
+				}
+				budget.Accounts[i].LastServerKnowledge = serverKnowledge
+				return nil
+			}
+		}
+
+		budget.Accounts = append(budget.Accounts, accountData{
+			AccountId:           accountId,
+			LastServerKnowledge: serverKnowledge,
+		})
+		return nil
+	})
+}
+
+// findBudget returns the stored data for a budget, or ErrNotFound.
+func (l *localStorageAdapter) findBudget(budgetId uuid.UUID) (*budgetData, error) {
+	l.filesMu.Lock()
+	defer l.filesMu.Unlock()
+
+	data, err := l.readData()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
 
 	for _, d := range data {
 		if d.BudgetId == budgetId {
-			return d.LastServerKnowledge, nil
+			return &d, nil
 		}
 	}
+	return nil, ErrNotFound
+}
+
+// updateBudget applies update to the stored data for a budget, creating it if needed, and writes the result. Nothing
+// is written if update returns an error. update runs under the file lock, so checks it makes against the stored data,
+// like rejecting server knowledge regressions, hold against other processes too.
+func (l *localStorageAdapter) updateBudget(budgetId uuid.UUID, update func(budget *budgetData) error) error {
+	return l.withFileLock(storageFile, func() error {
+		var data []budgetData
+
+		if _, err := os.Stat(storageFile); err == nil {
+			data, err = l.readData()
+			if err != nil {
+				return err
+			}
+		}
+
+		idx := slices.IndexFunc(data, func(d budgetData) bool {
+			return d.BudgetId == budgetId
+		})
+		if idx < 0 {
+			data = append(data, budgetData{BudgetId: budgetId})
+			idx = len(data) - 1
+		}
+
+		if err := update(&data[idx]); err != nil {
+			return err
+		}
 
-	return 0, fmt.Errorf("no budget found with id %v", budgetId)
+		return writeYaml(storageFile, data)
+	})
 }
 
-func (l *localStorageAdapter) SetLastServerKnowledge(ctx context.Context, budgetId uuid.UUID, serverKnowledge int64) (err error) {
+func (l *localStorageAdapter) readData() ([]budgetData, error) {
 	var data []budgetData
+	if err := readYaml(storageFile, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
 
-	if _, err := os.Stat(storageFile); err == nil {
-		data, err = l.readData()
+func (l *localStorageAdapter) AppendRunRecord(ctx context.Context, record RunRecord) error {
+	return l.withFileLock(runsFile, func() error {
+		records, err := l.readRunRecords()
 		if err != nil {
 			return err
 		}
+
+		// Prune old records so the file doesn't grow forever, mirroring the TTL used in DynamoDB
+		cutoff := time.Now().Add(-runRecordRetention)
+		records = slices.DeleteFunc(records, func(r RunRecord) bool {
+			return r.StartedAt.Before(cutoff)
+		})
+		records = append(records, record)
+
+		return writeYaml(runsFile, records)
+	})
+}
+
+func (l *localStorageAdapter) ListRunRecords(ctx context.Context, limit int) ([]RunRecord, error) {
+	l.filesMu.Lock()
+	defer l.filesMu.Unlock()
+
+	records, err := l.readRunRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(records, func(a, b RunRecord) int {
+		return b.StartedAt.Compare(a.StartedAt)
+	})
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
+
+func (l *localStorageAdapter) GetRunRecord(ctx context.Context, runId uuid.UUID) (*RunRecord, error) {
+	l.filesMu.Lock()
+	defer l.filesMu.Unlock()
+
+	records, err := l.readRunRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range records {
+		if r.RunId == runId {
+			return &r, nil
+		}
 	}
+	return nil, ErrNotFound
+}
+
+// readRunRecords returns all stored run records, or an empty slice if none have been stored yet.
+func (l *localStorageAdapter) readRunRecords() ([]RunRecord, error) {
+	var records []RunRecord
+	err := readYaml(runsFile, &records)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (l *localStorageAdapter) PutSplitRecords(ctx context.Context, budgetId uuid.UUID, records []SplitRecord) error {
+	return l.updateLedger(budgetId, func(ledger *ledgerData) {
+		for _, r := range records {
+			ledger.Splits = upsertLedgerRecord(ledger.Splits, r, func(s SplitRecord) string { return s.TransactionId })
+		}
+	})
+}
+
+func (l *localStorageAdapter) ListSplitRecords(ctx context.Context, budgetId uuid.UUID) ([]SplitRecord, error) {
+	ledger, err := l.findLedger(budgetId)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortStableFunc(ledger.Splits, func(a, b SplitRecord) int {
+		return compareLedgerOrder(a.Date, a.TransactionId, b.Date, b.TransactionId)
+	})
+	return ledger.Splits, nil
+}
+
+func (l *localStorageAdapter) PutSettlementRecord(ctx context.Context, budgetId uuid.UUID, record SettlementRecord) error {
+	return l.updateLedger(budgetId, func(ledger *ledgerData) {
+		ledger.Settlements = upsertLedgerRecord(ledger.Settlements, record,
+			func(s SettlementRecord) string { return s.TransactionId })
+	})
+}
+
+func (l *localStorageAdapter) ListSettlementRecords(ctx context.Context, budgetId uuid.UUID) ([]SettlementRecord, error) {
+	ledger, err := l.findLedger(budgetId)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortStableFunc(ledger.Settlements, func(a, b SettlementRecord) int {
+		return compareLedgerOrder(a.Date, a.TransactionId, b.Date, b.TransactionId)
+	})
+	return ledger.Settlements, nil
+}
 
-	found := false
-	for i, d := range data {
+// findLedger returns the stored ledger for a budget, which is empty if nothing has been stored yet.
+func (l *localStorageAdapter) findLedger(budgetId uuid.UUID) (ledgerData, error) {
+	l.filesMu.Lock()
+	defer l.filesMu.Unlock()
+
+	var data []ledgerData
+	err := readYaml(ledgerFile, &data)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return ledgerData{}, err
+	}
+
+	for _, d := range data {
 		if d.BudgetId == budgetId {
-			data[i].LastServerKnowledge = serverKnowledge
-			found = true
-			break
+			return d, nil
 		}
 	}
-	if !found {
-		data = append(data, budgetData{
-			BudgetId:            budgetId,
-			LastServerKnowledge: serverKnowledge,
+	return ledgerData{BudgetId: budgetId}, nil
+}
+
+// updateLedger applies update to the stored ledger for a budget, creating it if needed, and writes the result.
+func (l *localStorageAdapter) updateLedger(budgetId uuid.UUID, update func(ledger *ledgerData)) error {
+	return l.withFileLock(ledgerFile, func() error {
+		var data []ledgerData
+		err := readYaml(ledgerFile, &data)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		idx := slices.IndexFunc(data, func(d ledgerData) bool {
+			return d.BudgetId == budgetId
 		})
+		if idx < 0 {
+			data = append(data, ledgerData{BudgetId: budgetId})
+			idx = len(data) - 1
+		}
+
+		update(&data[idx])
+		return writeYaml(ledgerFile, data)
+	})
+}
+
+// upsertLedgerRecord replaces the record in records with the same ID as record, or appends it if there isn't one.
+func upsertLedgerRecord[T any](records []T, record T, id func(T) string) []T {
+	idx := slices.IndexFunc(records, func(r T) bool {
+		return id(r) == id(record)
+	})
+	if idx < 0 {
+		return append(records, record)
+	}
+	records[idx] = record
+	return records
+}
+
+// compareLedgerOrder orders ledger records by date, oldest first, using their transaction ID to break ties.
+func compareLedgerOrder(aDate, aId, bDate, bId string) int {
+	if c := strings.Compare(aDate, bDate); c != 0 {
+		return c
 	}
+	return strings.Compare(aId, bId)
+}
 
-	f, err := os.Create(storageFile)
+func (l *localStorageAdapter) ClaimMarker(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	claimed := false
+	err := l.withFileLock(markersFile, func() error {
+		var markers []markerData
+		err := readYaml(markersFile, &markers)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		now := time.Now()
+		// Forget expired markers, so the file doesn't grow forever
+		markers = slices.DeleteFunc(markers, func(m markerData) bool {
+			return !m.ExpiresAt.After(now)
+		})
+		if slices.ContainsFunc(markers, func(m markerData) bool { return m.Name == name }) {
+			return nil
+		}
+
+		markers = append(markers, markerData{Name: name, ExpiresAt: now.Add(ttl)})
+		if err := writeYaml(markersFile, markers); err != nil {
+			return err
+		}
+		claimed = true
+		return nil
+	})
+	return claimed, err
+}
+
+func (l *localStorageAdapter) DeleteMarker(ctx context.Context, name string) error {
+	return l.withFileLock(markersFile, func() error {
+		var markers []markerData
+		err := readYaml(markersFile, &markers)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		remaining := slices.DeleteFunc(slices.Clone(markers), func(m markerData) bool {
+			return m.Name == name
+		})
+		if len(remaining) == len(markers) {
+			return nil
+		}
+		return writeYaml(markersFile, remaining)
+	})
+}
+
+// withFileLock runs update, which reads, changes, and writes the storage file at path, while holding both filesMu
+// and an exclusive flock on a lock file beside it. The storage files are shared by every budget, so this stops another
+// process, like a manual run alongside `serve`, from writing in between and losing one of the changes. Reading without
+// the lock is safe, since writeYaml replaces files whole.
+func (l *localStorageAdapter) withFileLock(path string, update func() error) (err error) {
+	l.filesMu.Lock()
+	defer l.filesMu.Unlock()
+
+	dir, name := filepath.Split(path)
+	f, err := os.OpenFile(filepath.Join(dir, "."+name+".lock"), os.O_CREATE|os.O_RDWR, 0o644)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to open lock file: %w", err)
 	}
+	// Closing the file releases the lock
 	defer func() {
 		if closeErr := f.Close(); err == nil && closeErr != nil {
-			err = fmt.Errorf("failed to close storage file: %w", closeErr)
+			err = fmt.Errorf("failed to close lock file: %w", closeErr)
 		}
 	}()
 
-	encoder := yaml.NewEncoder(f)
+	if err := lockFileWait(f); err != nil {
+		return err
+	}
+	return update()
+}
+
+func readYaml(path string, out any) (err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
 	defer func() {
-		if closeErr := encoder.Close(); err == nil && closeErr != nil {
-			err = fmt.Errorf("failed to close YAML encoder: %w", closeErr)
+		if closeErr := f.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("failed to close storage file: %w", closeErr)
 		}
 	}()
 
-	if err = encoder.Encode(data); err != nil {
-		return fmt.Errorf("failed to encode storage data: %w", err)
+	decoder := yaml.NewDecoder(f)
+	if err = decoder.Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return err
 	}
 
 	return nil
 }
 
-func (l *localStorageAdapter) readData() (data []budgetData, err error) {
-	f, err := os.Open(storageFile)
+// writeYaml replaces the file at path with data. It's written to a temporary file first and renamed into place, so
+// readers see either the old or the new contents, never a partly written file.
+func writeYaml(path string, data any) (err error) {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := os.CreateTemp(dir, "."+name+".tmp-*")
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer func() {
-		if closeErr := f.Close(); err == nil && closeErr != nil {
-			err = fmt.Errorf("failed to close storage file: %w", closeErr)
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
 		}
 	}()
 
-	decoder := yaml.NewDecoder(f)
-	if err = decoder.Decode(&data); err != nil {
-		return nil, err
+	encoder := yaml.NewEncoder(f)
+	if err = encoder.Encode(data); err != nil {
+		return fmt.Errorf("failed to encode storage data: %w", err)
+	}
+	if err = encoder.Close(); err != nil {
+		return fmt.Errorf("failed to close YAML encoder: %w", err)
+	}
+	// CreateTemp makes the file readable only by us, but the storage files have always been readable by others
+	if err = f.Chmod(0o644); err != nil {
+		return fmt.Errorf("failed to set storage file permissions: %w", err)
 	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("failed to close storage file: %w", err)
+	}
+	return os.Rename(f.Name(), path)
+}
 
-	return data, nil
+// AcquireLock takes an exclusive flock on a per-budget lock file. The operating system releases the lock if the
+// process exits, so the lease is not needed and is ignored.
+func (l *localStorageAdapter) AcquireLock(ctx context.Context, budgetId uuid.UUID, owner string, lease time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.locks[budgetId]; ok {
+		return ErrLockHeld
+	}
+
+	f, err := os.OpenFile(lockFile(budgetId), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	if err := lockFileExclusive(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	l.locks[budgetId] = f
+	return nil
+}
+
+func (l *localStorageAdapter) ReleaseLock(ctx context.Context, budgetId uuid.UUID, owner string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, ok := l.locks[budgetId]
+	if !ok {
+		return fmt.Errorf("lock for budget %v is not held", budgetId)
+	}
+	delete(l.locks, budgetId)
+
+	// Closing the file releases the lock
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close lock file: %w", err)
+	}
+	return nil
+}
+
+func lockFile(budgetId uuid.UUID) string {
+	return fmt.Sprintf(".split-ynab-%v.lock", budgetId)
 }
@@ -0,0 +1,303 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+)
+
+func TestLocalStorageAdapterLock(t *testing.T) {
+	t.Chdir(t.TempDir())
+	ctx := context.Background()
+	budgetId := uuid.New()
+
+	first := NewLocalStorageAdapter()
+	second := NewLocalStorageAdapter()
+
+	if err := first.AcquireLock(ctx, budgetId, "first", time.Minute); err != nil {
+		t.Fatalf("want nil error acquiring unheld lock, got %v", err)
+	}
+
+	if err := second.AcquireLock(ctx, budgetId, "second", time.Minute); !errors.Is(err, ErrLockHeld) {
+		t.Fatalf("want ErrLockHeld acquiring held lock, got %v", err)
+	}
+
+	if err := second.AcquireLock(ctx, uuid.New(), "second", time.Minute); err != nil {
+		t.Fatalf("want nil error acquiring lock for another budget, got %v", err)
+	}
+
+	if err := first.ReleaseLock(ctx, budgetId, "first"); err != nil {
+		t.Fatalf("want nil error releasing lock, got %v", err)
+	}
+
+	if err := second.AcquireLock(ctx, budgetId, "second", time.Minute); err != nil {
+		t.Fatalf("want nil error acquiring released lock, got %v", err)
+	}
+}
+
+func TestLocalStorageAdapterServerKnowledgeRegression(t *testing.T) {
+	t.Chdir(t.TempDir())
+	ctx := context.Background()
+	budgetId := uuid.New()
+	adapter := NewLocalStorageAdapter()
+
+	if _, err := adapter.GetLastServerKnowledge(ctx, budgetId); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("want ErrNotFound before server knowledge is stored, got %v", err)
+	}
+
+	if err := adapter.SetLastServerKnowledge(ctx, budgetId, 10); err != nil {
+		t.Fatalf("want nil error setting initial server knowledge, got %v", err)
+	}
+
+	if err := adapter.SetLastServerKnowledge(ctx, budgetId, 5); !errors.Is(err, ErrServerKnowledgeRegression) {
+		t.Fatalf("want ErrServerKnowledgeRegression moving server knowledge backwards, got %v", err)
+	}
+
+	if err := adapter.SetLastServerKnowledge(ctx, budgetId, 10); err != nil {
+		t.Fatalf("want nil error setting unchanged server knowledge, got %v", err)
+	}
+
+	got, err := adapter.GetLastServerKnowledge(ctx, budgetId)
+	if err != nil {
+		t.Fatalf("want nil error getting server knowledge, got %v", err)
+	}
+	if got != 10 {
+		t.Fatalf("want server knowledge to be 10, got %d", got)
+	}
+}
+
+func TestLocalStorageAdapterServerKnowledgeRegressionAcrossAdapters(t *testing.T) {
+	t.Chdir(t.TempDir())
+	ctx := context.Background()
+	budgetId := uuid.New()
+	accountId := uuid.New()
+	const max = 40
+
+	// Two adapters stand in for two processes, like a scheduled run overlapping a manual one. Each stores every other
+	// value, so without the check running under the file lock, a lower value could overwrite a higher one
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*max)
+	for start := range 2 {
+		adapter := NewLocalStorageAdapter()
+		wg.Go(func() {
+			for sk := int64(start + 1); sk <= max; sk += 2 {
+				for _, err := range []error{
+					adapter.SetLastServerKnowledge(ctx, budgetId, sk),
+					adapter.SetAccountServerKnowledge(ctx, budgetId, accountId, sk),
+				} {
+					if err != nil && !errors.Is(err, ErrServerKnowledgeRegression) {
+						errs <- err
+					}
+				}
+			}
+		})
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("want nil error or ErrServerKnowledgeRegression, got %v", err)
+	}
+
+	reader := NewLocalStorageAdapter()
+	if got, err := reader.GetLastServerKnowledge(ctx, budgetId); err != nil || got != max {
+		t.Errorf("want server knowledge %d, got %d, %v", max, got, err)
+	}
+	if got, err := reader.GetAccountServerKnowledge(ctx, budgetId, accountId); err != nil || got != max {
+		t.Errorf("want account server knowledge %d, got %d, %v", max, got, err)
+	}
+}
+
+func TestLocalStorageAdapterRunRecords(t *testing.T) {
+	t.Chdir(t.TempDir())
+	ctx := context.Background()
+	adapter := NewLocalStorageAdapter()
+	now := time.Now().Truncate(time.Second)
+
+	expired := RunRecord{RunId: uuid.New(), StartedAt: now.Add(-runRecordRetention - time.Hour)}
+	oldest := RunRecord{RunId: uuid.New(), StartedAt: now.Add(-2 * time.Hour), Split: 1}
+	newest := RunRecord{
+		RunId:     uuid.New(),
+		BudgetId:  uuid.New(),
+		StartedAt: now,
+		Split:     2,
+		Transactions: []TransactionRecord{
+			{TransactionId: "t1", Amount: -10_000, TheirShare: -5_000, Status: "split"},
+		},
+		Error: "boom",
+	}
+	middle := RunRecord{RunId: uuid.New(), StartedAt: now.Add(-time.Hour), Split: 3}
+
+	if _, err := adapter.GetRunRecord(ctx, uuid.New()); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("want ErrNotFound before any run is stored, got %v", err)
+	}
+	got, err := adapter.ListRunRecords(ctx, 10)
+	if err != nil || len(got) != 0 {
+		t.Fatalf("want no runs before any run is stored, got %v, %v", got, err)
+	}
+
+	// Appended out of order, to check they're listed by start time
+	for _, r := range []RunRecord{expired, oldest, newest, middle} {
+		if err := adapter.AppendRunRecord(ctx, r); err != nil {
+			t.Fatalf("want nil error appending run record, got %v", err)
+		}
+	}
+
+	got, err = adapter.ListRunRecords(ctx, 10)
+	if err != nil {
+		t.Fatalf("want nil error listing run records, got %v", err)
+	}
+	gotIds := make([]uuid.UUID, len(got))
+	for i, r := range got {
+		gotIds[i] = r.RunId
+	}
+	wantIds := []uuid.UUID{newest.RunId, middle.RunId, oldest.RunId}
+	if diff := cmp.Diff(wantIds, gotIds); diff != "" {
+		t.Errorf("want runs newest first, without the expired run (-want +got):\n%v", diff)
+	}
+
+	got, err = adapter.ListRunRecords(ctx, 2)
+	if err != nil || len(got) != 2 || got[0].RunId != newest.RunId || got[1].RunId != middle.RunId {
+		t.Errorf("want the 2 newest runs with limit 2, got %v, %v", got, err)
+	}
+
+	record, err := adapter.GetRunRecord(ctx, newest.RunId)
+	if err != nil {
+		t.Fatalf("want nil error getting stored run, got %v", err)
+	}
+	if diff := cmp.Diff(newest, *record); diff != "" {
+		t.Errorf("stored run mismatch (-want +got):\n%v", diff)
+	}
+
+	if _, err := adapter.GetRunRecord(ctx, expired.RunId); !errors.Is(err, ErrNotFound) {
+		t.Errorf("want ErrNotFound for expired run, got %v", err)
+	}
+}
+
+func TestLocalStorageAdapterLedger(t *testing.T) {
+	t.Chdir(t.TempDir())
+	ctx := context.Background()
+	budgetId := uuid.New()
+	adapter := NewLocalStorageAdapter()
+
+	splits, err := adapter.ListSplitRecords(ctx, budgetId)
+	if err != nil || len(splits) != 0 {
+		t.Fatalf("want empty ledger before anything is stored, got %v and error %v", splits, err)
+	}
+
+	err = adapter.PutSplitRecords(ctx, budgetId, []SplitRecord{
+		{TransactionId: "b", Date: "2026-03-02", TheirShare: -5_000},
+		{TransactionId: "a", Date: "2026-03-01", TheirShare: -3_000},
+	})
+	if err != nil {
+		t.Fatalf("want nil error putting split records, got %v", err)
+	}
+	err = adapter.PutSplitRecords(ctx, budgetId, []SplitRecord{
+		{TransactionId: "b", Date: "2026-03-02", TheirShare: -5_000, SettledBy: "payment"},
+	})
+	if err != nil {
+		t.Fatalf("want nil error replacing split record, got %v", err)
+	}
+	if err := adapter.PutSplitRecords(ctx, uuid.New(), []SplitRecord{{TransactionId: "other"}}); err != nil {
+		t.Fatalf("want nil error putting split record for another budget, got %v", err)
+	}
+
+	splits, err = adapter.ListSplitRecords(ctx, budgetId)
+	if err != nil {
+		t.Fatalf("want nil error listing split records, got %v", err)
+	}
+	if len(splits) != 2 || splits[0].TransactionId != "a" || splits[1].SettledBy != "payment" {
+		t.Errorf("want the budget's two splits oldest first, with the replacement stored, got %v", splits)
+	}
+
+	if err := adapter.PutSettlementRecord(ctx, budgetId, SettlementRecord{TransactionId: "payment"}); err != nil {
+		t.Fatalf("want nil error putting settlement record, got %v", err)
+	}
+	settlements, err := adapter.ListSettlementRecords(ctx, budgetId)
+	if err != nil || len(settlements) != 1 {
+		t.Errorf("want 1 settlement record, got %v and error %v", settlements, err)
+	}
+}
+
+func TestLocalStorageAdapterSharedFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	ctx := context.Background()
+	const writes = 20
+
+	// Separate adapters don't share filesMu, like separate processes, so only the file lock keeps their writes apart
+	var wg sync.WaitGroup
+	budgetIds := []uuid.UUID{uuid.New(), uuid.New()}
+	errs := make(chan error, len(budgetIds)*writes)
+	for _, budgetId := range budgetIds {
+		adapter := NewLocalStorageAdapter()
+		wg.Go(func() {
+			for i := range writes {
+				record := SplitRecord{TransactionId: fmt.Sprintf("%v-%d", budgetId, i), Date: "2026-09-01"}
+				if err := adapter.PutSplitRecords(ctx, budgetId, []SplitRecord{record}); err != nil {
+					errs <- err
+				}
+			}
+		})
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("want nil error writing ledger, got %v", err)
+	}
+
+	reader := NewLocalStorageAdapter()
+	for _, budgetId := range budgetIds {
+		splits, err := reader.ListSplitRecords(ctx, budgetId)
+		if err != nil {
+			t.Fatalf("want nil error reading ledger, got %v", err)
+		}
+		if len(splits) != writes {
+			t.Errorf("want %d splits stored for budget %v, got %d", writes, budgetId, len(splits))
+		}
+	}
+
+	temps, err := filepath.Glob(".*.tmp-*")
+	if err != nil {
+		t.Fatalf("want nil error listing temporary files, got %v", err)
+	}
+	if len(temps) != 0 {
+		t.Errorf("want no temporary files left behind, got %v", temps)
+	}
+}
+
+func TestLocalStorageAdapterMarkers(t *testing.T) {
+	t.Chdir(t.TempDir())
+	ctx := context.Background()
+	adapter := NewLocalStorageAdapter()
+
+	claimed, err := adapter.ClaimMarker(ctx, "digest", time.Hour)
+	if err != nil || !claimed {
+		t.Fatalf("want new marker claimed, got %v, %v", claimed, err)
+	}
+	claimed, err = adapter.ClaimMarker(ctx, "digest", time.Hour)
+	if err != nil || claimed {
+		t.Fatalf("want existing marker not claimed, got %v, %v", claimed, err)
+	}
+	claimed, err = adapter.ClaimMarker(ctx, "other", time.Hour)
+	if err != nil || !claimed {
+		t.Fatalf("want other marker claimed, got %v, %v", claimed, err)
+	}
+
+	if err := adapter.DeleteMarker(ctx, "digest"); err != nil {
+		t.Fatalf("want nil error deleting marker, got %v", err)
+	}
+	claimed, err = adapter.ClaimMarker(ctx, "digest", -time.Second)
+	if err != nil || !claimed {
+		t.Fatalf("want deleted marker claimed, got %v, %v", claimed, err)
+	}
+	claimed, err = adapter.ClaimMarker(ctx, "digest", time.Hour)
+	if err != nil || !claimed {
+		t.Fatalf("want expired marker claimed, got %v, %v", claimed, err)
+	}
+}
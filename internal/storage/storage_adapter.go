@@ -2,11 +2,137 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+// ErrNotFound is returned when the requested item does not exist in storage.
+var ErrNotFound = errors.New("not found")
+
+// ErrServerKnowledgeRegression is returned when trying to store a server knowledge lower than the one already stored,
+// which would cause already-processed transactions to be fetched again.
+var ErrServerKnowledgeRegression = errors.New("server knowledge would move backwards")
+
+// ErrLockHeld is returned when trying to acquire a lock which is already held by someone else.
+var ErrLockHeld = errors.New("lock is held by another owner")
+
+// How long run records are kept before they are removed from storage.
+const runRecordRetention = 90 * 24 * time.Hour
+
 type StorageAdapter interface {
+	// GetLastServerKnowledge returns the budget's stored server knowledge, or ErrNotFound if none has been stored.
 	GetLastServerKnowledge(ctx context.Context, budgetId uuid.UUID) (int64, error)
+	// SetLastServerKnowledge stores the budget's server knowledge, or returns ErrServerKnowledgeRegression without
+	// changing anything if the stored value is greater than serverKnowledge.
 	SetLastServerKnowledge(ctx context.Context, budgetId uuid.UUID, serverKnowledge int64) error
+	// GetAccountServerKnowledge and SetAccountServerKnowledge are equivalent to their budget counterparts, but track
+	// the server knowledge of a single account, for runs which fetch each account separately.
+	GetAccountServerKnowledge(ctx context.Context, budgetId uuid.UUID, accountId uuid.UUID) (int64, error)
+	SetAccountServerKnowledge(ctx context.Context, budgetId uuid.UUID, accountId uuid.UUID, serverKnowledge int64) error
+
+	// AppendRunRecord stores the record of a completed run.
+	AppendRunRecord(ctx context.Context, record RunRecord) error
+	// ListRunRecords returns up to limit of the most recent run records, across all budgets, newest first.
+	ListRunRecords(ctx context.Context, limit int) ([]RunRecord, error)
+	// GetRunRecord returns the record of the run with the given ID, or ErrNotFound.
+	GetRunRecord(ctx context.Context, runId uuid.UUID) (*RunRecord, error)
+
+	// PutSplitRecords stores records of split transactions in the budget's ledger, replacing any existing records for
+	// the same transactions.
+	PutSplitRecords(ctx context.Context, budgetId uuid.UUID, records []SplitRecord) error
+	// ListSplitRecords returns every split transaction in the budget's ledger, oldest first.
+	ListSplitRecords(ctx context.Context, budgetId uuid.UUID) ([]SplitRecord, error)
+	// PutSettlementRecord stores the record of a repayment in the budget's ledger, replacing any existing record for
+	// the same transaction.
+	PutSettlementRecord(ctx context.Context, budgetId uuid.UUID, record SettlementRecord) error
+	// ListSettlementRecords returns every repayment in the budget's ledger, oldest first.
+	ListSettlementRecords(ctx context.Context, budgetId uuid.UUID) ([]SettlementRecord, error)
+
+	// AcquireLock takes an exclusive lock on the budget for owner, or returns ErrLockHeld if another owner holds it.
+	// The lock is released by ReleaseLock, or automatically once the lease expires in case the owner crashes.
+	AcquireLock(ctx context.Context, budgetId uuid.UUID, owner string, lease time.Duration) error
+	// ReleaseLock releases a lock previously acquired by owner.
+	ReleaseLock(ctx context.Context, budgetId uuid.UUID, owner string) error
+
+	// ClaimMarker records that something identified by name has happened, e.g. that a digest was sent, and reports
+	// true. If it was already recorded and ttl hasn't passed since, it reports false without changing anything.
+	ClaimMarker(ctx context.Context, name string, ttl time.Duration) (bool, error)
+	// DeleteMarker removes a marker, e.g. because what it recorded failed after all.
+	DeleteMarker(ctx context.Context, name string) error
+}
+
+// RunRecord is the persisted form of a run's result.
+type RunRecord struct {
+	RunId                   uuid.UUID           `json:"runId" yaml:"runId"`
+	Kind                    string              `json:"kind" yaml:"kind"`
+	BudgetId                uuid.UUID           `json:"budgetId" yaml:"budgetId"`
+	StartedAt               time.Time           `json:"startedAt" yaml:"startedAt"`
+	FinishedAt              time.Time           `json:"finishedAt" yaml:"finishedAt"`
+	DurationMs              int64               `json:"durationMs" yaml:"durationMs"`
+	ServerKnowledgeBefore   int64               `json:"serverKnowledgeBefore" yaml:"serverKnowledgeBefore"`
+	ServerKnowledgeAfter    int64               `json:"serverKnowledgeAfter" yaml:"serverKnowledgeAfter"`
+	ServerKnowledgeConflict bool                `json:"serverKnowledgeConflict,omitempty" yaml:"serverKnowledgeConflict,omitempty"`
+	Fetched                 int                 `json:"fetched" yaml:"fetched"`
+	Matched                 int                 `json:"matched" yaml:"matched"`
+	Split                   int                 `json:"split" yaml:"split"`
+	Skipped                 int                 `json:"skipped" yaml:"skipped"`
+	Failed                  int                 `json:"failed" yaml:"failed"`
+	Settled                 int                 `json:"settled,omitempty" yaml:"settled,omitempty"`
+	Mirrored                int                 `json:"mirrored,omitempty" yaml:"mirrored,omitempty"`
+	MirrorFailed            int                 `json:"mirrorFailed,omitempty" yaml:"mirrorFailed,omitempty"`
+	Funded                  int64               `json:"funded,omitempty" yaml:"funded,omitempty"`
+	Transactions            []TransactionRecord `json:"transactions" yaml:"transactions"`
+	// How many transaction outcomes were left out of Transactions to keep the record within the store's size limit
+	TransactionsOmitted int    `json:"transactionsOmitted,omitempty" yaml:"transactionsOmitted,omitempty"`
+	Error               string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// TransactionRecord is the persisted outcome of a single transaction within a run.
+type TransactionRecord struct {
+	TransactionId string   `json:"transactionId" yaml:"transactionId"`
+	Date          string   `json:"date" yaml:"date"`
+	AccountName   string   `json:"accountName" yaml:"accountName"`
+	PayeeName     string   `json:"payeeName,omitempty" yaml:"payeeName,omitempty"`
+	Amount        int64    `json:"amount" yaml:"amount"`
+	TheirShare    int64    `json:"theirShare" yaml:"theirShare"`
+	Rule          string   `json:"rule" yaml:"rule"`
+	Status        string   `json:"status" yaml:"status"`
+	Error         string   `json:"error,omitempty" yaml:"error,omitempty"`
+	Mismatches    []string `json:"mismatches,omitempty" yaml:"mismatches,omitempty"`
+}
+
+// SplitRecord is the ledger entry for a single split transaction. Amounts are in YNAB milliunits.
+type SplitRecord struct {
+	TransactionId string    `json:"transactionId" yaml:"transactionId"`
+	Date          string    `json:"date" yaml:"date"`
+	AccountId     uuid.UUID `json:"accountId" yaml:"accountId"`
+	AccountName   string    `json:"accountName" yaml:"accountName"`
+	PayeeName     string    `json:"payeeName,omitempty" yaml:"payeeName,omitempty"`
+	CategoryName  string    `json:"categoryName,omitempty" yaml:"categoryName,omitempty"`
+	Memo          string    `json:"memo,omitempty" yaml:"memo,omitempty"`
+	Amount        int64     `json:"amount" yaml:"amount"`
+	TheirShare    int64     `json:"theirShare" yaml:"theirShare"`
+	Rule          string    `json:"rule" yaml:"rule"`
+	// The run which split the transaction
+	RunId   uuid.UUID `json:"runId" yaml:"runId"`
+	SplitAt time.Time `json:"splitAt" yaml:"splitAt"`
+	// The ID of the settlement transaction which covered this split, if it has been settled
+	SettledBy string `json:"settledBy,omitempty" yaml:"settledBy,omitempty"`
+}
+
+// SettlementRecord is the ledger entry for a repayment from the other person. Amounts are in YNAB milliunits.
+type SettlementRecord struct {
+	TransactionId string `json:"transactionId" yaml:"transactionId"`
+	Date          string `json:"date" yaml:"date"`
+	AccountName   string `json:"accountName" yaml:"accountName"`
+	PayeeName     string `json:"payeeName,omitempty" yaml:"payeeName,omitempty"`
+	Amount        int64  `json:"amount" yaml:"amount"`
+	// The split transactions this repayment covered, oldest first
+	CoveredTransactionIds []string `json:"coveredTransactionIds" yaml:"coveredTransactionIds"`
+	// The credit left over after covering whole split transactions with Amount and the credit left by earlier
+	// repayments, which counts towards the next repayment
+	Unapplied  int64     `json:"unapplied" yaml:"unapplied"`
+	RecordedAt time.Time `json:"recordedAt" yaml:"recordedAt"`
 }
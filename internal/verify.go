@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+)
+
+type subtransactionKey struct {
+	amount     int64
+	categoryId uuid.UUID
+	// Only set for transfers, e.g. to the IOU account
+	transferPayeeId uuid.UUID
+}
+
+func (k subtransactionKey) String() string {
+	if k.transferPayeeId != uuid.Nil {
+		return fmt.Sprintf("%d to payee %v", k.amount, k.transferPayeeId)
+	}
+	return fmt.Sprintf("%d to category %v", k.amount, k.categoryId)
+}
+
+// verifySplit compares a transaction as saved by YNAB with the split we asked it to save, returning a description of
+// each difference. YNAB silently ignores some updates (e.g. splitting credit card payments), so a successful response
+// alone doesn't mean the split took effect.
+func verifySplit(want ynab.SaveTransactionWithId, saved *ynab.TransactionDetail) []string {
+	wantSubs := make([]subtransactionKey, 0)
+	if want.Subtransactions != nil {
+		for _, s := range *want.Subtransactions {
+			wantSubs = append(wantSubs, newSubtransactionKey(s.Amount, s.CategoryId, s.PayeeId))
+		}
+	}
+
+	gotSubs := make([]subtransactionKey, 0, len(saved.Subtransactions))
+	for _, s := range saved.Subtransactions {
+		if s.Deleted {
+			continue
+		}
+		var transferPayeeId *uuid.UUID
+		if s.TransferAccountId != nil {
+			transferPayeeId = s.PayeeId
+		}
+		gotSubs = append(gotSubs, newSubtransactionKey(s.Amount, s.CategoryId, transferPayeeId))
+	}
+
+	if len(gotSubs) != len(wantSubs) {
+		return []string{fmt.Sprintf("want %d subtransactions, got %d", len(wantSubs), len(gotSubs))}
+	}
+
+	mismatches := make([]string, 0)
+	remaining := slices.Clone(gotSubs)
+	for _, w := range wantSubs {
+		idx := slices.Index(remaining, w)
+		if idx < 0 {
+			mismatches = append(mismatches, fmt.Sprintf("missing subtransaction of %v", w))
+			continue
+		}
+		remaining = slices.Delete(remaining, idx, idx+1)
+	}
+	for _, r := range remaining {
+		mismatches = append(mismatches, fmt.Sprintf("unexpected subtransaction of %v", r))
+	}
+
+	return mismatches
+}
+
+func newSubtransactionKey(amount int64, categoryId *uuid.UUID, transferPayeeId *uuid.UUID) subtransactionKey {
+	key := subtransactionKey{amount: amount}
+	if categoryId != nil {
+		key.categoryId = *categoryId
+	}
+	if transferPayeeId != nil {
+		key.transferPayeeId = *transferPayeeId
+	}
+	return key
+}
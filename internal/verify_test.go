@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/samshadwell/split-ynab/internal/ynab"
+)
+
+func TestVerifySplit(t *testing.T) {
+	id := uuid.New().String()
+	originalCategory := uuid.New()
+	splitCategory := uuid.New()
+	otherCategory := uuid.New()
+
+	want := ynab.SaveTransactionWithId{
+		Id: &id,
+		Subtransactions: &[]ynab.SaveSubTransaction{
+			{Amount: -7_000, CategoryId: &originalCategory},
+			{Amount: -3_000, CategoryId: &splitCategory},
+		},
+	}
+
+	type testCase struct {
+		name           string
+		saved          ynab.TransactionDetail
+		wantMismatches int
+	}
+	testCases := []testCase{
+		{
+			name: "matches in a different order",
+			saved: ynab.TransactionDetail{Id: id, Subtransactions: []ynab.SubTransaction{
+				{Amount: -3_000, CategoryId: &splitCategory},
+				{Amount: -7_000, CategoryId: &originalCategory},
+			}},
+			wantMismatches: 0,
+		},
+		{
+			name:           "split was ignored",
+			saved:          ynab.TransactionDetail{Id: id, Amount: -10_000, CategoryId: &originalCategory},
+			wantMismatches: 1,
+		},
+		{
+			name: "amounts differ",
+			saved: ynab.TransactionDetail{Id: id, Subtransactions: []ynab.SubTransaction{
+				{Amount: -5_000, CategoryId: &originalCategory},
+				{Amount: -5_000, CategoryId: &splitCategory},
+			}},
+			wantMismatches: 4,
+		},
+		{
+			name: "category differs",
+			saved: ynab.TransactionDetail{Id: id, Subtransactions: []ynab.SubTransaction{
+				{Amount: -7_000, CategoryId: &originalCategory},
+				{Amount: -3_000, CategoryId: &otherCategory},
+			}},
+			wantMismatches: 2,
+		},
+		{
+			name: "deleted subtransactions are ignored",
+			saved: ynab.TransactionDetail{Id: id, Subtransactions: []ynab.SubTransaction{
+				{Amount: -7_000, CategoryId: &originalCategory},
+				{Amount: -3_000, CategoryId: &splitCategory},
+				{Amount: -1_000, CategoryId: &otherCategory, Deleted: true},
+			}},
+			wantMismatches: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		got := verifySplit(want, &tc.saved)
+		if len(got) != tc.wantMismatches {
+			t.Errorf("%s: want %d mismatches, got %d: %v", tc.name, tc.wantMismatches, len(got), got)
+		}
+	}
+}
+
+func TestVerifySplitTransfer(t *testing.T) {
+	id := uuid.New().String()
+	originalCategory := uuid.New()
+	iouAccountId := uuid.New()
+	transferPayeeId := uuid.New()
+	otherPayeeId := uuid.New()
+
+	want := ynab.SaveTransactionWithId{
+		Id: &id,
+		Subtransactions: &[]ynab.SaveSubTransaction{
+			{Amount: -7_000, CategoryId: &originalCategory},
+			{Amount: -3_000, PayeeId: &transferPayeeId},
+		},
+	}
+
+	saved := ynab.TransactionDetail{Id: id, Subtransactions: []ynab.SubTransaction{
+		// YNAB may copy the parent's payee onto subtransactions which aren't transfers
+		{Amount: -7_000, CategoryId: &originalCategory, PayeeId: &otherPayeeId},
+		{Amount: -3_000, PayeeId: &transferPayeeId, TransferAccountId: &iouAccountId},
+	}}
+	if got := verifySplit(want, &saved); len(got) != 0 {
+		t.Errorf("want no mismatches, got %v", got)
+	}
+
+	notTransferred := ynab.TransactionDetail{Id: id, Subtransactions: []ynab.SubTransaction{
+		{Amount: -7_000, CategoryId: &originalCategory},
+		{Amount: -3_000},
+	}}
+	if got := verifySplit(want, &notTransferred); len(got) != 2 {
+		t.Errorf("want 2 mismatches when the transfer wasn't saved, got %v", got)
+	}
+}
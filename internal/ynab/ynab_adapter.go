@@ -2,8 +2,11 @@ package ynab
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,6 +17,16 @@ import (
 const ynabServer = "https://api.ynab.com/v1"
 const requestTimeout = 30 * time.Second
 
+// ErrDuplicateImportId is returned when creating a transaction whose import ID already exists in its account.
+var ErrDuplicateImportId = errors.New("a transaction with this import ID already exists")
+
+// ErrRejected is wrapped by the error returned when YNAB rejects an update as invalid. Sending the same update again
+// will fail the same way. Any other error, such as a network failure, rate limit, or server error, may succeed later.
+var ErrRejected = errors.New("YNAB rejected the update")
+
+// ErrRateLimited is wrapped by the error returned when YNAB refuses a request because too many have been made.
+var ErrRateLimited = errors.New("rate limited by YNAB")
+
 type ynabAdapter struct {
 	client ClientWithResponsesInterface
 	logger *zap.Logger
@@ -39,10 +52,13 @@ func NewYnabAdapter(logger *zap.Logger, authToken string) (*ynabAdapter, error)
 	}, nil
 }
 
+// FetchTransactions fetches the transactions which changed since serverKnowledge. If serverKnowledge is 0, it instead
+// fetches every transaction dated on or after since.
 func (y *ynabAdapter) FetchTransactions(
 	ctx context.Context,
 	budgetId uuid.UUID,
 	serverKnowledge int64,
+	since time.Time,
 ) (*GetTransactionsResponse, error) {
 	y.logger.Info("fetching transactions from YNAB",
 		zap.String("budgetId", budgetId.String()),
@@ -51,10 +67,7 @@ func (y *ynabAdapter) FetchTransactions(
 
 	transactionParams := GetTransactionsParams{}
 	if serverKnowledge == 0 {
-		// If we don't have any server knowledge, only update transactions from the last 30 days
-		today := time.Now()
-		thirtyDaysAgo := today.AddDate(0, 0, -30)
-		transactionParams.SinceDate = &types.Date{Time: thirtyDaysAgo}
+		transactionParams.SinceDate = &types.Date{Time: since}
 	} else {
 		transactionParams.LastKnowledgeOfServer = &serverKnowledge
 	}
@@ -67,7 +80,7 @@ func (y *ynabAdapter) FetchTransactions(
 	statusCode := resp.StatusCode()
 	if statusCode != http.StatusOK {
 		return nil, fmt.Errorf("non-200 status code %v from YNAB when fetching transactions: %v",
-			statusCode, resp.JSON400.Error.Detail)
+			statusCode, errorDetail(resp.JSON400))
 	}
 
 	y.logger.Info("successfully fetched transactions from YNAB",
@@ -76,31 +89,362 @@ func (y *ynabAdapter) FetchTransactions(
 	return resp, err
 }
 
+// FetchAccountTransactions fetches the transactions in a single account which changed since serverKnowledge. If
+// serverKnowledge is 0, it instead fetches every transaction in the account dated on or after since.
+func (y *ynabAdapter) FetchAccountTransactions(
+	ctx context.Context,
+	budgetId uuid.UUID,
+	accountId uuid.UUID,
+	serverKnowledge int64,
+	since time.Time,
+) (*GetTransactionsByAccountResponse, error) {
+	y.logger.Info("fetching account transactions from YNAB",
+		zap.String("budgetId", budgetId.String()),
+		zap.String("accountId", accountId.String()),
+		zap.Int64("lastKnowledgeOfServer", serverKnowledge),
+	)
+
+	transactionParams := GetTransactionsByAccountParams{}
+	if serverKnowledge == 0 {
+		transactionParams.SinceDate = &types.Date{Time: since}
+	} else {
+		transactionParams.LastKnowledgeOfServer = &serverKnowledge
+	}
+
+	resp, err := y.client.GetTransactionsByAccountWithResponse(ctx, budgetId.String(), accountId.String(),
+		&transactionParams)
+	if err != nil {
+		return nil, err
+	}
+
+	statusCode := resp.StatusCode()
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("non-200 status code %v from YNAB when fetching account transactions: %v",
+			statusCode, errorDetail(resp.JSON404))
+	}
+
+	y.logger.Info("successfully fetched account transactions from YNAB",
+		zap.Int("count", len(resp.JSON200.Data.Transactions)),
+	)
+	return resp, nil
+}
+
+// TransactionUpdateResult is the outcome of updating a single transaction. Err is set if the update failed. Otherwise
+// Saved is the transaction as saved by YNAB, or nil if YNAB reported success without returning it.
+type TransactionUpdateResult struct {
+	TransactionId string
+	Saved         *TransactionDetail
+	Err           error
+}
+
+// UpdateTransactions sends updatedTransactions to YNAB in chunks of at most chunkSize. If a chunk is rejected as
+// invalid, its transactions are retried one at a time so that a single bad transaction does not fail the rest of the
+// chunk. If a chunk fails for any other reason, every transaction in it fails with the same error, and once rate
+// limited, the remaining chunks fail without being sent. The returned results are in the same order as
+// updatedTransactions.
 func (y *ynabAdapter) UpdateTransactions(
 	ctx context.Context,
 	budgetId uuid.UUID,
 	updatedTransactions []SaveTransactionWithId,
-) error {
+	chunkSize int,
+) []TransactionUpdateResult {
 	y.logger.Info("updating transactions in YNAB",
-		zap.Int("count", len(updatedTransactions)))
+		zap.Int("count", len(updatedTransactions)),
+		zap.Int("chunkSize", chunkSize))
+
+	if chunkSize <= 0 {
+		chunkSize = len(updatedTransactions)
+	}
+
+	results := make([]TransactionUpdateResult, 0, len(updatedTransactions))
+	var rateLimited error
+	for chunk := range slices.Chunk(updatedTransactions, chunkSize) {
+		if rateLimited != nil {
+			// More requests would only be rate limited too
+			for _, t := range chunk {
+				results = append(results, TransactionUpdateResult{TransactionId: *t.Id, Err: rateLimited})
+			}
+			continue
+		}
+
+		saved, err := y.updateChunk(ctx, budgetId, chunk)
+		switch {
+		case err == nil:
+			for _, t := range chunk {
+				results = append(results, TransactionUpdateResult{
+					TransactionId: *t.Id,
+					Saved:         saved[*t.Id],
+				})
+			}
+		case errors.Is(err, ErrRejected):
+			y.logger.Warn("chunk of transactions was rejected, retrying individually",
+				zap.Int("count", len(chunk)),
+				zap.Error(err))
+			for _, t := range chunk {
+				results = append(results, y.updateOne(ctx, budgetId, t))
+			}
+		default:
+			y.logger.Warn("failed to update chunk of transactions",
+				zap.Int("count", len(chunk)),
+				zap.Error(err))
+			if errors.Is(err, ErrRateLimited) {
+				rateLimited = err
+			}
+			for _, t := range chunk {
+				results = append(results, TransactionUpdateResult{TransactionId: *t.Id, Err: err})
+			}
+		}
+	}
 
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	y.logger.Info("finished updating transactions in YNAB",
+		zap.Int("succeeded", len(results)-failed),
+		zap.Int("failed", failed))
+	return results
+}
+
+// updateChunk updates all transactions in a single request, returning the saved transactions keyed by ID. The map
+// may be missing entries if YNAB does not echo back the saved transactions.
+func (y *ynabAdapter) updateChunk(
+	ctx context.Context,
+	budgetId uuid.UUID,
+	chunk []SaveTransactionWithId,
+) (map[string]*TransactionDetail, error) {
 	resp, err := y.client.UpdateTransactionsWithResponse(
 		ctx,
 		budgetId.String(),
 		UpdateTransactionsJSONRequestBody{
-			Transactions: updatedTransactions,
+			Transactions: chunk,
 		},
 	)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	statusCode := resp.StatusCode()
+	// The spec documents a 209 but the API has been observed to respond with a plain 200
+	if statusCode != http.StatusOK && statusCode != 209 {
+		return nil, statusError(statusCode, "updating transactions", resp.JSON400)
+	}
+
+	saved := make(map[string]*TransactionDetail, len(chunk))
+	body := resp.JSON209
+	if body == nil {
+		body = &SaveTransactionsResponse{}
+		if err := json.Unmarshal(resp.Body, body); err != nil {
+			y.logger.Warn("failed to decode saved transactions from YNAB response", zap.Error(err))
+			return saved, nil
+		}
+	}
+	if body.Data.Transactions != nil {
+		for i, t := range *body.Data.Transactions {
+			saved[t.Id] = &(*body.Data.Transactions)[i]
+		}
+	}
+	return saved, nil
+}
+
+func (y *ynabAdapter) updateOne(ctx context.Context, budgetId uuid.UUID, t SaveTransactionWithId) TransactionUpdateResult {
+	result := TransactionUpdateResult{TransactionId: *t.Id}
+
+	saved, err := y.UpdateTransaction(ctx, budgetId, *t.Id, SaveTransaction{
+		AccountId:       t.AccountId,
+		Amount:          t.Amount,
+		Approved:        t.Approved,
+		CategoryId:      t.CategoryId,
+		Cleared:         t.Cleared,
+		Date:            t.Date,
+		FlagColor:       t.FlagColor,
+		ImportId:        t.ImportId,
+		Memo:            t.Memo,
+		PayeeId:         t.PayeeId,
+		PayeeName:       t.PayeeName,
+		Subtransactions: t.Subtransactions,
+	})
+	if err != nil {
+		y.logger.Warn("failed to update transaction",
+			zap.String("transactionId", *t.Id),
+			zap.Error(err))
+		result.Err = err
+		return result
+	}
+
+	result.Saved = saved
+	return result
+}
+
+// UpdateTransaction updates a single existing transaction, returning the transaction as saved by YNAB.
+func (y *ynabAdapter) UpdateTransaction(
+	ctx context.Context,
+	budgetId uuid.UUID,
+	transactionId string,
+	t SaveTransaction,
+) (*TransactionDetail, error) {
+	resp, err := y.client.UpdateTransactionWithResponse(ctx, budgetId.String(), transactionId,
+		UpdateTransactionJSONRequestBody{Transaction: t})
+	if err != nil {
+		return nil, err
 	}
 
 	statusCode := resp.StatusCode()
 	if statusCode != http.StatusOK {
-		return fmt.Errorf("non-200 status code %v from YNAB when updating transactions: %v",
-			statusCode, resp.JSON400.Error.Detail)
+		return nil, statusError(statusCode, "updating transaction", resp.JSON400)
+	}
+
+	return &resp.JSON200.Data.Transaction, nil
+}
+
+// CreateTransaction creates a single transaction, returning the transaction as saved by YNAB. If t has an import ID
+// which already exists in its account, YNAB rejects it and the returned error wraps ErrDuplicateImportId.
+func (y *ynabAdapter) CreateTransaction(ctx context.Context, budgetId uuid.UUID, t SaveTransaction) (*TransactionDetail, error) {
+	resp, err := y.client.CreateTransactionWithResponse(ctx, budgetId.String(), CreateTransactionJSONRequestBody{
+		Transaction: &t,
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	y.logger.Info("successfully updated transactions in YNAB")
+	statusCode := resp.StatusCode()
+	switch {
+	case statusCode == http.StatusConflict:
+		return nil, fmt.Errorf("%w: %v", ErrDuplicateImportId, errorDetail(resp.JSON409))
+	case statusCode != http.StatusCreated:
+		return nil, fmt.Errorf("non-201 status code %v from YNAB when creating transaction: %v",
+			statusCode, errorDetail(resp.JSON400))
+	case resp.JSON201.Data.Transaction == nil:
+		// YNAB doesn't report duplicate import IDs as an error when creating a single transaction, it just doesn't
+		// create it
+		return nil, ErrDuplicateImportId
+	}
+
+	return resp.JSON201.Data.Transaction, nil
+}
+
+// DeleteTransaction deletes a single transaction.
+func (y *ynabAdapter) DeleteTransaction(ctx context.Context, budgetId uuid.UUID, transactionId string) error {
+	resp, err := y.client.DeleteTransactionWithResponse(ctx, budgetId.String(), transactionId)
+	if err != nil {
+		return err
+	}
+
+	statusCode := resp.StatusCode()
+	if statusCode != http.StatusOK {
+		return fmt.Errorf("non-200 status code %v from YNAB when deleting transaction: %v",
+			statusCode, errorDetail(resp.JSON404))
+	}
 	return nil
 }
+
+// statusError returns the error for an unexpected status code from YNAB when doing action, wrapping ErrRejected or
+// ErrRateLimited if the status code means either.
+func statusError(statusCode int, action string, errResp *ErrorResponse) error {
+	err := fmt.Errorf("non-200 status code %v from YNAB when %v: %v", statusCode, action, errorDetail(errResp))
+	switch statusCode {
+	case http.StatusBadRequest:
+		return fmt.Errorf("%w: %w", ErrRejected, err)
+	case http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %w", ErrRateLimited, err)
+	default:
+		return err
+	}
+}
+
+func errorDetail(errResp *ErrorResponse) string {
+	if errResp == nil {
+		return "no error detail in response"
+	}
+	return errResp.Error.Detail
+}
+
+func (y *ynabAdapter) GetTransaction(ctx context.Context, budgetId uuid.UUID, transactionId string) (*TransactionDetail, error) {
+	resp, err := y.client.GetTransactionByIdWithResponse(ctx, budgetId.String(), transactionId)
+	if err != nil {
+		return nil, err
+	}
+
+	statusCode := resp.StatusCode()
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("non-200 status code %v from YNAB when fetching transaction: %v",
+			statusCode, errorDetail(resp.JSON404))
+	}
+
+	return &resp.JSON200.Data.Transaction, nil
+}
+
+// GetTransferPayeeId returns the ID of the payee used to transfer money to the given account.
+func (y *ynabAdapter) GetTransferPayeeId(ctx context.Context, budgetId uuid.UUID, accountId uuid.UUID) (uuid.UUID, error) {
+	resp, err := y.client.GetPayeesWithResponse(ctx, budgetId.String(), &GetPayeesParams{})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	statusCode := resp.StatusCode()
+	if statusCode != http.StatusOK {
+		return uuid.Nil, fmt.Errorf("non-200 status code %v from YNAB when fetching payees: %v",
+			statusCode, errorDetail(resp.JSON404))
+	}
+
+	for _, p := range resp.JSON200.Data.Payees {
+		if !p.Deleted && p.TransferAccountId != nil && *p.TransferAccountId == accountId.String() {
+			return p.Id, nil
+		}
+	}
+	return uuid.Nil, fmt.Errorf("no transfer payee found for account %v", accountId)
+}
+
+// GetMonthCategory returns a category's budgeted amount, activity, and balance for the month containing month.
+func (y *ynabAdapter) GetMonthCategory(
+	ctx context.Context,
+	budgetId uuid.UUID,
+	month time.Time,
+	categoryId uuid.UUID,
+) (*Category, error) {
+	resp, err := y.client.GetMonthCategoryByIdWithResponse(ctx, budgetId.String(), firstOfMonth(month),
+		categoryId.String())
+	if err != nil {
+		return nil, err
+	}
+
+	statusCode := resp.StatusCode()
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("non-200 status code %v from YNAB when fetching month category: %v",
+			statusCode, errorDetail(resp.JSON404))
+	}
+
+	return &resp.JSON200.Data.Category, nil
+}
+
+// SetMonthCategoryBudgeted sets the amount budgeted to a category for the month containing month, returning the
+// updated category.
+func (y *ynabAdapter) SetMonthCategoryBudgeted(
+	ctx context.Context,
+	budgetId uuid.UUID,
+	month time.Time,
+	categoryId uuid.UUID,
+	budgeted int64,
+) (*Category, error) {
+	resp, err := y.client.UpdateMonthCategoryWithResponse(ctx, budgetId.String(), firstOfMonth(month),
+		categoryId.String(), UpdateMonthCategoryJSONRequestBody{
+			Category: SaveMonthCategory{Budgeted: budgeted},
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	statusCode := resp.StatusCode()
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("non-200 status code %v from YNAB when updating month category: %v",
+			statusCode, errorDetail(resp.JSON400))
+	}
+
+	return &resp.JSON200.Data.Category, nil
+}
+
+func firstOfMonth(t time.Time) types.Date {
+	return types.Date{Time: time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)}
+}
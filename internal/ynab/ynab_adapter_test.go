@@ -0,0 +1,195 @@
+package ynab
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// fakeClient implements only the generated client methods the adapter uses. Calling any other method panics.
+type fakeClient struct {
+	ClientWithResponsesInterface
+
+	badIds []string
+	// If set, every bulk request fails with this status
+	bulkStatus       int
+	bulkRequestSizes []int
+	singleRequestIds []string
+}
+
+func (f *fakeClient) UpdateTransactionsWithResponse(
+	ctx context.Context,
+	budgetId string,
+	body UpdateTransactionsJSONRequestBody,
+	reqEditors ...RequestEditorFn,
+) (*UpdateTransactionsResponse, error) {
+	f.bulkRequestSizes = append(f.bulkRequestSizes, len(body.Transactions))
+	if f.bulkStatus != 0 {
+		return &UpdateTransactionsResponse{HTTPResponse: &http.Response{StatusCode: f.bulkStatus}}, nil
+	}
+	for _, t := range body.Transactions {
+		if slices.Contains(f.badIds, *t.Id) {
+			return &UpdateTransactionsResponse{
+				HTTPResponse: &http.Response{StatusCode: http.StatusBadRequest},
+				JSON400:      &ErrorResponse{Error: ErrorDetail{Detail: "bad transaction"}},
+			}, nil
+		}
+	}
+
+	saved := make([]TransactionDetail, len(body.Transactions))
+	for i, t := range body.Transactions {
+		saved[i] = TransactionDetail{Id: *t.Id}
+	}
+	resp := &UpdateTransactionsResponse{
+		HTTPResponse: &http.Response{StatusCode: 209},
+		JSON209:      &SaveTransactionsResponse{},
+	}
+	resp.JSON209.Data.Transactions = &saved
+	return resp, nil
+}
+
+func (f *fakeClient) UpdateTransactionWithResponse(
+	ctx context.Context,
+	budgetId string,
+	transactionId string,
+	body UpdateTransactionJSONRequestBody,
+	reqEditors ...RequestEditorFn,
+) (*UpdateTransactionResponse, error) {
+	f.singleRequestIds = append(f.singleRequestIds, transactionId)
+	if slices.Contains(f.badIds, transactionId) {
+		return &UpdateTransactionResponse{
+			HTTPResponse: &http.Response{StatusCode: http.StatusBadRequest},
+			JSON400:      &ErrorResponse{Error: ErrorDetail{Detail: "bad transaction"}},
+		}, nil
+	}
+
+	resp := &UpdateTransactionResponse{
+		HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+		JSON200:      &TransactionResponse{},
+	}
+	resp.JSON200.Data.Transaction = TransactionDetail{Id: transactionId}
+	return resp, nil
+}
+
+func TestUpdateTransactionsIsolatesFailures(t *testing.T) {
+	client := &fakeClient{badIds: []string{"4"}}
+	adapter := &ynabAdapter{client: client, logger: zap.NewNop()}
+
+	ids := []string{"1", "2", "3", "4", "5"}
+	transactions := make([]SaveTransactionWithId, len(ids))
+	for i := range ids {
+		transactions[i] = SaveTransactionWithId{Id: &ids[i]}
+	}
+
+	results := adapter.UpdateTransactions(context.Background(), uuid.New(), transactions, 2)
+
+	if diff := cmp.Diff([]int{2, 2, 1}, client.bulkRequestSizes); diff != "" {
+		t.Errorf("bulk request sizes did not match expected. Diff (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"3", "4"}, client.singleRequestIds); diff != "" {
+		t.Errorf("individually retried transactions did not match expected. Diff (-want +got):\n%s", diff)
+	}
+
+	if len(results) != len(ids) {
+		t.Fatalf("want %d results, got %d", len(ids), len(results))
+	}
+	for i, r := range results {
+		if r.TransactionId != ids[i] {
+			t.Errorf("want result %d to be for transaction %q, got %q", i, ids[i], r.TransactionId)
+		}
+
+		if ids[i] == "4" {
+			if r.Err == nil {
+				t.Errorf("want error for transaction %q, got nil", ids[i])
+			}
+			continue
+		}
+
+		if r.Err != nil {
+			t.Errorf("want no error for transaction %q, got %v", ids[i], r.Err)
+		}
+		if r.Saved == nil || r.Saved.Id != ids[i] {
+			t.Errorf("want saved transaction for %q, got %v", ids[i], r.Saved)
+		}
+	}
+}
+
+func TestUpdateTransactionsFailsChunkOnTransientError(t *testing.T) {
+	ids := []string{"1", "2", "3", "4", "5"}
+	transactions := make([]SaveTransactionWithId, len(ids))
+	for i := range ids {
+		transactions[i] = SaveTransactionWithId{Id: &ids[i]}
+	}
+
+	tests := []struct {
+		name             string
+		status           int
+		wantBulkRequests []int
+		wantErr          error
+	}{
+		// Once rate limited, later chunks aren't sent
+		{"rate limited", http.StatusTooManyRequests, []int{2}, ErrRateLimited},
+		{"server error", http.StatusServiceUnavailable, []int{2, 2, 1}, nil},
+	}
+	for _, tt := range tests {
+		client := &fakeClient{bulkStatus: tt.status}
+		adapter := &ynabAdapter{client: client, logger: zap.NewNop()}
+
+		results := adapter.UpdateTransactions(context.Background(), uuid.New(), transactions, 2)
+
+		if diff := cmp.Diff(tt.wantBulkRequests, client.bulkRequestSizes); diff != "" {
+			t.Errorf("%v: bulk request sizes did not match expected. Diff (-want +got):\n%s", tt.name, diff)
+		}
+		if len(client.singleRequestIds) != 0 {
+			t.Errorf("%v: want no transactions retried individually, got %v", tt.name, client.singleRequestIds)
+		}
+		if len(results) != len(ids) {
+			t.Fatalf("%v: want %d results, got %d", tt.name, len(ids), len(results))
+		}
+		for _, r := range results {
+			if r.Err == nil || errors.Is(r.Err, ErrRejected) {
+				t.Errorf("%v: want transaction %q to fail with a transient error, got %v", tt.name, r.TransactionId, r.Err)
+			}
+			if tt.wantErr != nil && !errors.Is(r.Err, tt.wantErr) {
+				t.Errorf("%v: want transaction %q to fail with %v, got %v", tt.name, r.TransactionId, tt.wantErr, r.Err)
+			}
+		}
+	}
+}
+
+func TestUpdateTransactionsRejectionIsPermanent(t *testing.T) {
+	client := &fakeClient{badIds: []string{"1"}}
+	adapter := &ynabAdapter{client: client, logger: zap.NewNop()}
+	id := "1"
+
+	results := adapter.UpdateTransactions(context.Background(), uuid.New(), []SaveTransactionWithId{{Id: &id}}, 2)
+	if len(results) != 1 || !errors.Is(results[0].Err, ErrRejected) {
+		t.Errorf("want the transaction to be rejected, got %+v", results)
+	}
+}
+
+func (f *fakeClient) GetTransactionsWithResponse(
+	ctx context.Context,
+	budgetId string,
+	params *GetTransactionsParams,
+	reqEditors ...RequestEditorFn,
+) (*GetTransactionsResponse, error) {
+	// YNAB sends no error body the generated client parses for statuses like 401 and 429
+	return &GetTransactionsResponse{HTTPResponse: &http.Response{StatusCode: http.StatusUnauthorized}}, nil
+}
+
+func TestFetchTransactionsWithoutErrorDetail(t *testing.T) {
+	adapter := &ynabAdapter{client: &fakeClient{}, logger: zap.NewNop()}
+
+	_, err := adapter.FetchTransactions(context.Background(), uuid.New(), 0, time.Now())
+	if err == nil {
+		t.Fatal("want error for non-200 status, got nil")
+	}
+}